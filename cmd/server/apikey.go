@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/config"
+	"casebrief/internal/db"
+	"casebrief/internal/models"
+	"casebrief/internal/repository"
+	"casebrief/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+const apiKeyUsage = "usage: orders-service apikey create -name NAME [-scopes orders:read,orders:write] [-tenant TENANT] [-expires-in DURATION]"
+
+// runAPIKey runs the apikey subcommand and returns the process exit code
+func runAPIKey(cfg *config.Config, appLogger *zap.Logger, args []string) int {
+	if len(args) == 0 || args[0] != "create" {
+		fmt.Fprintln(os.Stderr, apiKeyUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+	name := flags.String("name", "", "unique name of the client, logged as the caller")
+	scopes := flags.String("scopes", auth.ScopeOrdersRead, "comma-separated scopes granted to the key")
+	tenantID := flags.String("tenant", "", "tenant the key is bound to; keys without tenant need the "+auth.ScopeAnyTenant+" scope and select it with the "+tenant.Header+" header")
+	expiresIn := flags.Duration("expires-in", 0, "validity of the key, forever if 0")
+	if err := flags.Parse(args[1:]); err != nil || *name == "" || flags.NArg() > 0 || (*tenantID != "" && !tenant.Valid(*tenantID)) {
+		fmt.Fprintln(os.Stderr, apiKeyUsage)
+		return 2
+	}
+
+	key, err := auth.GenerateAPIKey()
+	if err != nil {
+		appLogger.Error("Failed to generate API key", zap.Error(err))
+		return 1
+	}
+	apiKey := &models.APIKey{
+		Name:     *name,
+		KeyHash:  auth.HashAPIKey(key),
+		Scopes:   strings.Split(*scopes, ","),
+		TenantID: *tenantID,
+	}
+	if *expiresIn > 0 {
+		expiresAt := time.Now().Add(*expiresIn)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	database, err := db.ConnectDB(cfg, appLogger)
+	if err != nil {
+		appLogger.Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+	defer database.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := repository.NewAPIKeyRepository(database, appLogger).CreateAPIKey(ctx, apiKey); err != nil {
+		return 1
+	}
+	appLogger.Info("API key created",
+		zap.String("api_key_id", apiKey.ID),
+		zap.String("api_key_name", apiKey.Name),
+		zap.Strings("scopes", apiKey.Scopes),
+		zap.String("tenant_id", apiKey.TenantID),
+	)
+
+	// The key is not stored and cannot be shown again
+	fmt.Println(key)
+	return 0
+}
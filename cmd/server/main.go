@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,24 +12,44 @@ import (
 	"time"
 
 	"casebrief/docs"
+	"casebrief/internal/auth"
 	"casebrief/internal/config"
 	"casebrief/internal/db"
 	"casebrief/internal/events"
+	"casebrief/internal/grpcserver"
 	"casebrief/internal/handler"
+	"casebrief/internal/janitor"
 	"casebrief/internal/logger"
 	"casebrief/internal/middleware"
+	"casebrief/internal/migrate"
+	"casebrief/internal/problem"
+	"casebrief/internal/ratelimit"
 	"casebrief/internal/repository"
 	"casebrief/internal/service"
+	"casebrief/internal/tenant"
 	"casebrief/internal/tracing"
+	"casebrief/migrations"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
 )
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description Static API key, created with `orders-service apikey create`
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT bearer token signed by a key of the configured JWKS, as "Bearer <token>"
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
@@ -39,6 +61,14 @@ func main() {
 	}
 	defer appLogger.Sync()
 
+	// Run the migrate or apikey subcommand instead of the server if requested
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, appLogger, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		os.Exit(runAPIKey(cfg, appLogger, os.Args[2:]))
+	}
+
 	appLogger.Info("Starting Orders microservice",
 		zap.String("port", cfg.ServerPort),
 	)
@@ -46,7 +76,7 @@ func main() {
 	// Initialize tracing
 	var shutdownTracing func()
 	if cfg.OTelEnabled {
-		shutdownTracing, err = tracing.InitTracing("orders-service", appLogger)
+		shutdownTracing, err = tracing.InitTracing(cfg, "orders-service", appLogger)
 		if err != nil {
 			appLogger.Warn("Failed to initialize tracing", zap.Error(err))
 		} else {
@@ -54,36 +84,151 @@ func main() {
 		}
 	}
 
-	// Connect to database
-	db, err := db.ConnectDB(cfg, appLogger)
-	if err != nil {
-		appLogger.Fatal("Failed to connect to database", zap.Error(err))
+	// Initialize repositories
+	var (
+		sqlDB            *sql.DB
+		orderStore       repository.OrderStore
+		outboxStore      repository.OutboxStore
+		idempotencyStore repository.IdempotencyStore
+		apiKeyStore      repository.APIKeyStore
+	)
+	if cfg.StorageBackend == config.StorageMemory {
+		appLogger.Warn("Using in-memory storage, data is lost on restart")
+		memoryStore := repository.NewMemoryStore()
+		orderStore, outboxStore, idempotencyStore, apiKeyStore = memoryStore, memoryStore, memoryStore, memoryStore
+	} else {
+		// Connect to database
+		sqlDB, err = db.ConnectDB(cfg, appLogger)
+		if err != nil {
+			appLogger.Fatal("Failed to connect to database", zap.Error(err))
+		}
+		defer sqlDB.Close()
+		prometheus.MustRegister(collectors.NewDBStatsCollector(sqlDB, cfg.DBName))
+
+		// Apply pending migrations before serving requests if enabled
+		if cfg.AutoMigrate {
+			applied, err := migrate.NewMigrator(sqlDB, migrations.FS, appLogger).Up(context.Background())
+			if err != nil {
+				appLogger.Fatal("Failed to migrate database", zap.Error(err))
+			}
+			appLogger.Info("Database migrated", zap.Int("applied", applied))
+		}
+
+		orderStore = repository.NewOrderRepository(sqlDB, appLogger)
+		outboxStore = repository.NewOutboxRepository(sqlDB, appLogger)
+		idempotencyStore = repository.NewIdempotencyRepository(sqlDB, appLogger)
+		apiKeyStore = repository.NewAPIKeyRepository(sqlDB, appLogger)
 	}
-	defer db.Close()
 
-	// Create event channel
-	eventChan := make(chan *events.OrderCreatedEvent, cfg.EventQueueSize)
+	// Initialize authentication
+	var authenticator *auth.Authenticator
+	if cfg.AuthEnabled {
+		var jwks *auth.JWKS
+		if cfg.JWKSFile != "" {
+			jwks, err = auth.LoadJWKS(cfg.JWKSFile)
+			if err != nil {
+				appLogger.Fatal("Failed to load JWKS", zap.Error(err))
+			}
+		}
+		authenticator = auth.NewAuthenticator(apiKeyStore, jwks, auth.JWTConfig{
+			Issuer:   cfg.JWTIssuer,
+			Audience: cfg.JWTAudience,
+		})
+	} else {
+		appLogger.Warn("Authentication is disabled, the order endpoints are anonymous")
+	}
 
-	// Initialize repository
-	orderRepo := repository.NewOrderRepository(db, appLogger)
+	// Initialize rate limiting
+	var rateLimiter gin.HandlerFunc
+	if cfg.RateLimitEnabled {
+		policy, err := ratelimit.ParsePolicy(cfg.RateLimitDefault, cfg.RateLimitRoutes)
+		if err != nil {
+			appLogger.Fatal("Invalid rate limit configuration", zap.Error(err))
+		}
+		rateLimitStore, err := ratelimit.NewStore(cfg, sqlDB, appLogger)
+		if err != nil {
+			appLogger.Fatal("Failed to create rate limit store", zap.Error(err))
+		}
+		rateLimiter = middleware.RateLimit(rateLimitStore, policy, appLogger)
+	}
+
+	// Create event channel
+	eventChan := make(chan *events.Envelope, cfg.EventQueueSize)
+	events.RegisterQueueMetrics(eventChan)
 
 	// Initialize service
-	orderService := service.NewOrderService(orderRepo, eventChan, appLogger)
+	var orderCache *service.OrderCache
+	if cfg.OrderCacheEnabled {
+		orderCache = service.NewOrderCache(cfg.OrderCacheSize, cfg.OrderCacheTTL)
+	}
+	orderService := service.NewOrderService(orderStore, orderCache, appLogger)
+
+	// Order watchers see, and the order cache drops, the changes of all
+	// replicas, notified by the database, rather than only those made through
+	// this replica
+	var orderChanges *repository.OrderChangeListener
+	if sqlDB != nil && (cfg.GRPCEnabled || cfg.OrderCacheEnabled) {
+		orderChanges = repository.NewOrderChangeListener(db.DSN(cfg), appLogger)
+		orderService.UseChangeFeed()
+	}
 
 	// Initialize handlers
 	orderHandler := handler.NewOrderHandler(orderService, appLogger)
-	healthHandler := handler.NewHealthHandler()
+
+	// Create event publisher delivering events downstream
+	publisher, err := events.NewPublisher(cfg, appLogger)
+	if err != nil {
+		appLogger.Fatal("Failed to create event publisher", zap.Error(err))
+	}
+	defer publisher.Close()
+
+	// Create outbox relay feeding the event worker
+	relay := events.NewOutboxRelay(outboxStore, eventChan, cfg.OutboxPollInterval, cfg.OutboxBatchSize, cfg.OutboxLease, cfg.OutboxMaxAttempts, appLogger)
 
 	// Create event worker
-	worker := events.NewWorker(eventChan, appLogger)
+	worker := events.NewWorker(eventChan, publisher, relay, appLogger)
+
+	// Initialize health handler with the readiness checks of the dependencies
+	readinessChecks := []handler.ReadinessCheck{
+		handler.EventWorkerCheck(worker, cfg.WorkerStallTimeout),
+		handler.EventQueueCheck(eventChan, cfg.EventQueueMaxFill),
+	}
+	if sqlDB != nil {
+		readinessChecks = append(readinessChecks, handler.DatabaseCheck(sqlDB))
+	}
+	healthHandler := handler.NewHealthHandler(readinessChecks...)
+
+	// Create janitor purging expired idempotency keys and processed outbox events
+	dataJanitor := janitor.NewJanitor(idempotencyStore, outboxStore, cfg.PurgeInterval, cfg.PurgeBatchSize, cfg.PurgeMaxBatches, cfg.OutboxRetention, appLogger)
 
-	// Start event worker
+	// Start event worker, outbox relay and janitor
 	workerCtx, workerCancel := context.WithCancel(context.Background())
 	defer workerCancel()
 	go worker.Start(workerCtx)
+	go relay.Start(workerCtx)
+	go dataJanitor.Start(workerCtx)
+	if orderChanges != nil {
+		go orderChanges.Listen(workerCtx, func(change *repository.OrderChangeNotification) {
+			ctx := tenant.NewContext(workerCtx, change.TenantID)
+			if err := orderService.NotifyOrderChange(ctx, change.Kind, change.OrderID, change.Version); err != nil {
+				appLogger.Warn("Failed to notify order change",
+					zap.Error(err),
+					zap.String("order_id", change.OrderID),
+				)
+			}
+		})
+	}
 
 	// Setup router
-	router := setupRouter(cfg, orderHandler, healthHandler, appLogger)
+	idempotencyConfig := middleware.IdempotencyConfig{
+		Validity:    cfg.IdempotencyTTL,
+		LockTimeout: cfg.IdempotencyLock,
+		RetryAfter:  time.Second,
+	}
+	router, err := setupRouter(cfg, orderHandler, healthHandler, idempotencyStore, idempotencyConfig, authenticator, rateLimiter, appLogger)
+	if err != nil {
+		appLogger.Fatal("Invalid trusted proxies", zap.Error(err))
+	}
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -98,8 +243,32 @@ func main() {
 		}
 	}()
 
+	// Start gRPC server on its own port, sharing the order service,
+	// authenticator and idempotency keys with the REST API
+	var grpcServer *grpcserver.Server
+	if cfg.GRPCEnabled {
+		grpcListener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			appLogger.Fatal("Failed to listen for gRPC", zap.Error(err))
+		}
+		grpcServer = grpcserver.NewServer(orderService, grpcserver.Config{
+			Authenticator:    authenticator,
+			DefaultTenant:    cfg.DefaultTenant,
+			IdempotencyStore: idempotencyStore,
+			Idempotency:      idempotencyConfig,
+			Tracing:          cfg.OTelEnabled,
+		}, appLogger)
+		go func() {
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				appLogger.Fatal("Failed to start gRPC server", zap.Error(err))
+			}
+		}()
+	}
+
 	appLogger.Info("Server started successfully",
 		zap.String("port", cfg.ServerPort),
+		zap.String("grpc_port", cfg.GRPCPort),
+		zap.Bool("grpc_enabled", cfg.GRPCEnabled),
 	)
 
 	// Wait for interrupt signal for graceful shutdown
@@ -109,12 +278,19 @@ func main() {
 
 	appLogger.Info("Shutting down server...")
 
+	// Report not-ready first and give load balancers time to notice
+	healthHandler.SetShuttingDown()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
 	// Graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Stop event worker
+	// Stop outbox relay and event worker; unacknowledged events are
+	// relayed again after restart
+	relay.Stop()
 	worker.Stop()
+	dataJanitor.Stop()
 	workerCancel()
 
 	// Shutdown HTTP server
@@ -122,14 +298,33 @@ func main() {
 		appLogger.Error("Server forced to shutdown", zap.Error(err))
 	}
 
+	// Shutdown gRPC server; watchers are told to watch again elsewhere
+	if grpcServer != nil {
+		if err := grpcServer.Shutdown(ctx); err != nil {
+			appLogger.Error("gRPC server forced to shutdown", zap.Error(err))
+		}
+	}
+
 	appLogger.Info("Server exited")
 }
 
-func setupRouter(cfg *config.Config, orderHandler *handler.OrderHandler, healthHandler *handler.HealthHandler, logger *zap.Logger) *gin.Engine {
+// setupRouter creates the router. Without an authenticator the order
+// endpoints are anonymous, without a rate limiter they are not limited. It
+// fails if cfg.TrustedProxies is not a list of IPs and CIDRs.
+func setupRouter(cfg *config.Config, orderHandler *handler.OrderHandler, healthHandler *handler.HealthHandler, idempotencyStore middleware.IdempotencyStore, idempotencyConfig middleware.IdempotencyConfig, authenticator *auth.Authenticator, rateLimiter gin.HandlerFunc, logger *zap.Logger) (*gin.Engine, error) {
 	router := gin.New()
 
-	// Use zap logger and recovery middleware
+	// The client IP, which anonymous requests are rate limited by, is only
+	// taken from X-Forwarded-For if the request came through a trusted
+	// proxy; otherwise clients could pick their bucket
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+
+	// Use zap logger, metrics and recovery middleware. Metrics wraps the
+	// recovery so requests that panicked are counted as 500.
 	router.Use(middleware.ZapLogger(logger))
+	router.Use(middleware.Metrics())
 	router.Use(middleware.ZapRecovery(logger))
 
 	// Initialize Swagger docs
@@ -142,13 +337,59 @@ func setupRouter(cfg *config.Config, orderHandler *handler.OrderHandler, healthH
 
 	// Health check
 	router.GET("/healthz", healthHandler.HealthCheck)
+	router.GET("/livez", healthHandler.Livez)
+	router.GET("/readyz", healthHandler.Readyz)
+
+	// Prometheus metrics
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// API routes
-	router.POST("/orders", orderHandler.CreateOrder)
-	router.GET("/orders/:id", orderHandler.GetOrderByID)
+	// API routes, split by the scope they require. Callers are
+	// authenticated first, so requests are limited per caller (or client IP
+	// if authentication is disabled) and route, before the scope is checked.
+	// The tenant is resolved last; every order and idempotency key query is
+	// scoped by it.
+	read := router.Group("/orders")
+	write := router.Group("/orders")
+	for _, group := range []struct {
+		routes *gin.RouterGroup
+		scope  string
+	}{{read, auth.ScopeOrdersRead}, {write, auth.ScopeOrdersWrite}} {
+		if authenticator != nil {
+			group.routes.Use(middleware.Authenticate(authenticator, logger))
+		}
+		if rateLimiter != nil {
+			group.routes.Use(rateLimiter)
+		}
+		if authenticator != nil {
+			group.routes.Use(middleware.RequireScope(group.scope))
+		}
+		group.routes.Use(middleware.Tenant(cfg.DefaultTenant))
+	}
 
-	return router
+	// Replay responses of mutating requests carrying an Idempotency-Key
+	// header. It runs after authentication, so rejected requests never
+	// reserve a key, and keys are scoped to the tenant.
+	write.Use(middleware.Idempotency(idempotencyStore, idempotencyConfig, logger))
+
+	write.POST("", middleware.RequireIdempotencyKey(), orderHandler.CreateOrder)
+	read.GET("", orderHandler.ListOrders)
+	read.GET("/:id", orderHandler.GetOrderByID)
+	write.PATCH("/:id", orderHandler.UpdateOrder)
+	write.POST("/:id/transitions", orderHandler.TransitionOrder)
+	write.POST("/:id/cancel", middleware.RequireIdempotencyKey(), orderHandler.CancelOrder)
+	read.GET("/:id/transitions", orderHandler.GetOrderStatusHistory)
+
+	// Unknown routes and methods are answered with problem details too
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(func(c *gin.Context) {
+		problem.Write(c, problem.New(http.StatusNotFound, problem.CodeRouteNotFound, "No route matches "+c.Request.Method+" "+c.Request.URL.Path))
+	})
+	router.NoMethod(func(c *gin.Context) {
+		problem.Write(c, problem.New(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method "+c.Request.Method+" is not allowed for "+c.Request.URL.Path))
+	})
+
+	return router, nil
 }
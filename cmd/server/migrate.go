@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"casebrief/internal/config"
+	"casebrief/internal/db"
+	"casebrief/internal/migrate"
+	"casebrief/migrations"
+
+	"go.uber.org/zap"
+)
+
+const migrateUsage = "usage: orders-service migrate up|status|validate"
+
+// runMigrate runs the migrate subcommand and returns the process exit code
+func runMigrate(cfg *config.Config, appLogger *zap.Logger, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	database, err := db.ConnectDB(cfg, appLogger)
+	if err != nil {
+		appLogger.Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+	defer database.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	migrator := migrate.NewMigrator(database, migrations.FS, appLogger)
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			appLogger.Error("Failed to migrate database", zap.Error(err), zap.Int("applied", applied))
+			return 1
+		}
+		appLogger.Info("Database migrated", zap.Int("applied", applied))
+	case "status":
+		infos, err := migrator.Status(ctx)
+		if err != nil {
+			appLogger.Error("Failed to get migration status", zap.Error(err))
+			return 1
+		}
+		printMigrationStatus(infos)
+	case "validate":
+		if err := migrator.Validate(ctx); err != nil {
+			appLogger.Error("Database schema is not valid", zap.Error(err))
+			return 1
+		}
+		appLogger.Info("Database schema is valid")
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
+
+// printMigrationStatus prints the migrations as a table, like flyway info
+func printMigrationStatus(infos []migrate.MigrationInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tINSTALLED ON\tSTATE")
+	for _, info := range infos {
+		installedOn := ""
+		if !info.InstalledOn.IsZero() {
+			installedOn = info.InstalledOn.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", info.Version, info.Description, installedOn, info.State)
+	}
+	w.Flush()
+}
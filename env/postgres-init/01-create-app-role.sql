@@ -0,0 +1,9 @@
+-- Create the role the service connects as. It is neither a superuser nor has
+-- BYPASSRLS, so the row level security policies isolating tenants apply to it.
+-- The migrations run as the database owner (POSTGRES_USER), which creates the
+-- tables; the service may only read and write them.
+CREATE ROLE orders_app LOGIN PASSWORD 'orders_app' NOSUPERUSER NOBYPASSRLS;
+
+GRANT USAGE ON SCHEMA public TO orders_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO orders_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO orders_app;
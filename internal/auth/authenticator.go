@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"casebrief/internal/models"
+	"casebrief/internal/repository"
+	"casebrief/internal/tenant"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// apiKeyPrefix makes API keys recognizable, e.g. by secret scanners
+const apiKeyPrefix = "osk_"
+
+// jwtLeeway is the clock skew tolerated when validating exp and nbf
+const jwtLeeway = 30 * time.Second
+
+// ErrInvalidCredentials is returned when an API key or token is unknown,
+// expired, revoked or not valid
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// APIKeyStore looks up API keys by the SHA-256 of the key
+type APIKeyStore interface {
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+}
+
+// JWTConfig configures the validation of JWT bearer tokens
+type JWTConfig struct {
+	// Issuer is the required iss claim, if not empty
+	Issuer string
+	// Audience is the required aud claim, if not empty
+	Audience string
+}
+
+// Authenticator authenticates callers by API key or JWT bearer token
+type Authenticator struct {
+	apiKeys APIKeyStore
+	jwks    *JWKS
+	parser  *jwt.Parser
+	now     func() time.Time
+}
+
+// NewAuthenticator creates an authenticator. Without a JWKS bearer tokens are
+// rejected, so only API keys are accepted.
+func NewAuthenticator(apiKeys APIKeyStore, jwks *JWKS, cfg JWTConfig) *Authenticator {
+	options := []jwt.ParserOption{
+		// Asymmetric algorithms only; the JWKS holds public keys
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	return &Authenticator{
+		apiKeys: apiKeys,
+		jwks:    jwks,
+		parser:  jwt.NewParser(options...),
+		now:     time.Now,
+	}
+}
+
+// AuthenticateAPIKey returns the principal of a static API key. It returns
+// ErrInvalidCredentials if the key is unknown, expired or revoked, and any
+// other error if the key could not be looked up.
+func (a *Authenticator) AuthenticateAPIKey(ctx context.Context, key string) (*Principal, error) {
+	apiKey, err := a.apiKeys.GetAPIKeyByHash(ctx, HashAPIKey(key))
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !apiKey.Active(a.now()) {
+		return nil, fmt.Errorf("%w: API key %s is expired or revoked", ErrInvalidCredentials, apiKey.Name)
+	}
+
+	return &Principal{
+		Subject: apiKey.Name,
+		Method:  MethodAPIKey,
+		Scopes:  apiKey.Scopes,
+		Tenant:  apiKey.TenantID,
+	}, nil
+}
+
+// AuthenticateBearer validates a JWT bearer token against the JWKS and
+// returns its principal. The subject is taken from the sub claim, the scopes
+// from the space-separated scope claim (RFC 8693) or the scp claim, and the
+// tenant the caller is bound to from the tenant_id claim.
+func (a *Authenticator) AuthenticateBearer(token string) (*Principal, error) {
+	if a.jwks == nil {
+		return nil, fmt.Errorf("%w: bearer tokens are not accepted", ErrInvalidCredentials)
+	}
+
+	claims := &tokenClaims{}
+	if _, err := a.parser.ParseWithClaims(token, claims, a.jwks.Keyfunc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	if claims.Tenant != "" && !tenant.Valid(claims.Tenant) {
+		return nil, fmt.Errorf("%w: invalid tenant %q", ErrInvalidCredentials, claims.Tenant)
+	}
+
+	return &Principal{
+		Subject: claims.Subject,
+		Method:  MethodJWT,
+		Scopes:  claims.scopes(),
+		Tenant:  claims.Tenant,
+	}, nil
+}
+
+// tokenClaims are the claims read from JWT bearer tokens
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope  string      `json:"scope,omitempty"`
+	Scp    interface{} `json:"scp,omitempty"`
+	Tenant string      `json:"tenant_id,omitempty"`
+}
+
+// scopes returns the scopes granted by the token
+func (c *tokenClaims) scopes() []string {
+	if c.Scope != "" {
+		return strings.Fields(c.Scope)
+	}
+	switch scp := c.Scp.(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		scopes := make([]string, 0, len(scp))
+		for _, value := range scp {
+			if scope, ok := value.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
+
+// HashAPIKey returns the SHA-256 of an API key as stored in the database.
+// API keys are random, so they need no salt.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateAPIKey returns a new random API key
+func GenerateAPIKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"casebrief/internal/models"
+	"casebrief/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "orders-service"
+)
+
+// writeJWKS writes the public keys as a JWKS file and returns its path
+func writeJWKS(t *testing.T, keys map[string]interface{}) string {
+	t.Helper()
+
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	doc := map[string][]map[string]string{"keys": {}}
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			doc["keys"] = append(doc["keys"], map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig",
+				"n": encode(key.N), "e": encode(big.NewInt(int64(key.E))),
+			})
+		case *ecdsa.PublicKey:
+			doc["keys"] = append(doc["keys"], map[string]string{
+				"kty": "EC", "kid": kid, "crv": "P-256",
+				"x": encode(key.X), "y": encode(key.Y),
+			})
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "billing-service",
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "orders:read orders:write",
+	}
+}
+
+func newJWTAuthenticator(t *testing.T) (*Authenticator, *rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks, err := LoadJWKS(writeJWKS(t, map[string]interface{}{"rsa-1": &rsaKey.PublicKey, "ec-1": &ecKey.PublicKey}))
+	require.NoError(t, err)
+	return NewAuthenticator(repository.NewMemoryStore(), jwks, JWTConfig{Issuer: testIssuer, Audience: testAudience}), rsaKey, ecKey
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	store := repository.NewMemoryStore()
+	authenticator := NewAuthenticator(store, nil, JWTConfig{})
+	ctx := context.Background()
+
+	key, err := GenerateAPIKey()
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAPIKey(ctx, &models.APIKey{
+		Name:    "checkout",
+		KeyHash: HashAPIKey(key),
+		Scopes:  []string{ScopeOrdersRead},
+	}))
+
+	principal, err := authenticator.AuthenticateAPIKey(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Subject: "checkout", Method: MethodAPIKey, Scopes: []string{ScopeOrdersRead}}, principal)
+	assert.True(t, principal.HasScope(ScopeOrdersRead))
+	assert.False(t, principal.HasScope(ScopeOrdersWrite))
+
+	_, err = authenticator.AuthenticateAPIKey(ctx, key+"x")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestAuthenticateAPIKey_RejectsExpiredAndRevokedKeys(t *testing.T) {
+	store := repository.NewMemoryStore()
+	authenticator := NewAuthenticator(store, nil, JWTConfig{})
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, store.CreateAPIKey(ctx, &models.APIKey{Name: "expired", KeyHash: HashAPIKey("expired-key"), ExpiresAt: &past}))
+	require.NoError(t, store.CreateAPIKey(ctx, &models.APIKey{Name: "revoked", KeyHash: HashAPIKey("revoked-key"), RevokedAt: &past}))
+
+	for _, key := range []string{"expired-key", "revoked-key"} {
+		_, err := authenticator.AuthenticateAPIKey(ctx, key)
+		assert.ErrorIs(t, err, ErrInvalidCredentials, key)
+	}
+}
+
+func TestAuthenticateBearer(t *testing.T) {
+	authenticator, rsaKey, ecKey := newJWTAuthenticator(t)
+
+	principal, err := authenticator.AuthenticateBearer(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Subject: "billing-service", Method: MethodJWT, Scopes: []string{ScopeOrdersRead, ScopeOrdersWrite}}, principal)
+
+	claims := validClaims()
+	delete(claims, "scope")
+	claims["scp"] = []string{ScopeOrdersRead}
+	principal, err = authenticator.AuthenticateBearer(signToken(t, jwt.SigningMethodES256, "ec-1", ecKey, claims))
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeOrdersRead}, principal.Scopes)
+
+	claims = validClaims()
+	claims["tenant_id"] = "acme"
+	principal, err = authenticator.AuthenticateBearer(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", principal.Tenant)
+}
+
+func TestAuthenticateBearer_RejectsInvalidTokens(t *testing.T) {
+	authenticator, rsaKey, _ := newJWTAuthenticator(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := map[string]string{
+		"expired":         signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("exp", time.Now().Add(-time.Hour).Unix())),
+		"no expiry":       signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("exp", nil)),
+		"wrong issuer":    signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("iss", "https://evil.example.com")),
+		"wrong audience":  signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("aud", "other-service")),
+		"no subject":      signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("sub", nil)),
+		"unknown kid":     signToken(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, validClaims()),
+		"wrong signature": signToken(t, jwt.SigningMethodRS256, "rsa-1", otherKey, validClaims()),
+		"symmetric":       signToken(t, jwt.SigningMethodHS256, "rsa-1", []byte("secret"), validClaims()),
+		"invalid tenant":  signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("tenant_id", "acme corp")),
+		"malformed":       "not-a-token",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := authenticator.AuthenticateBearer(token)
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestAuthenticateBearer_RejectedWithoutJWKS(t *testing.T) {
+	authenticator := NewAuthenticator(repository.NewMemoryStore(), nil, JWTConfig{})
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = authenticator.AuthenticateBearer(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims()))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestParseJWKS_RejectsInvalidDocuments(t *testing.T) {
+	for name, doc := range map[string]string{
+		"not json":         `{`,
+		"no keys":          `{"keys": []}`,
+		"only encryption":  `{"keys": [{"kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"}]}`,
+		"unsupported type": `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`,
+		"point off curve":  `{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseJWKS([]byte(doc))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"casebrief/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// Scopes granted to callers
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+	// ScopeAnyTenant lets callers not bound to a tenant select the tenant
+	// they act on per request
+	ScopeAnyTenant = "tenants:any"
+)
+
+// Authentication methods
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// Subject identifies the caller: the API key name or the JWT subject
+	Subject string
+	// Method is how the caller authenticated, MethodAPIKey or MethodJWT
+	Method string
+	// Scopes are the scopes granted to the caller
+	Scopes []string
+	// Tenant is the tenant the caller is bound to; callers not bound to a
+	// tenant select it per request if granted ScopeAnyTenant
+	Tenant string
+}
+
+// HasScope reports whether the caller was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal of the request, if it was authenticated
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// LogFields returns the fields identifying the caller and the tenant of the
+// request in log entries, or nothing for anonymous requests
+func LogFields(ctx context.Context) []zap.Field {
+	var fields []zap.Field
+	if principal, ok := FromContext(ctx); ok {
+		fields = append(fields,
+			zap.String("caller", principal.Subject),
+			zap.String("auth_method", principal.Method),
+		)
+	}
+	if id, ok := tenant.FromContext(ctx); ok {
+		fields = append(fields, zap.String("tenant_id", id))
+	}
+	return fields
+}
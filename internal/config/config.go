@@ -3,37 +3,131 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
+)
+
+// Storage backends
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
 )
 
 // Config holds application configuration
 type Config struct {
-	ServerPort     string
-	DBHost         string
-	DBPort         string
-	DBUser         string
-	DBPassword     string
-	DBName         string
-	DBSSLMode      string
-	LogLevel       string
-	OTelEnabled    bool
-	EventQueueSize int
-	Hostname       string
+	ServerPort         string
+	DBHost             string
+	DBPort             string
+	DBUser             string
+	DBPassword         string
+	DBName             string
+	DBSSLMode          string
+	StorageBackend     string
+	AutoMigrate        bool
+	LogLevel           string
+	OTelEnabled        bool
+	TracesExporter     string
+	TracesSampleRatio  float64
+	OTLPEndpoint       string
+	OTLPProtocol       string
+	ServiceVersion     string
+	ServiceInstanceID  string
+	Environment        string
+	EventQueueSize     int
+	EventQueueMaxFill  float64
+	WorkerStallTimeout time.Duration
+	ShutdownDrainDelay time.Duration
+	Hostname           string
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+	OutboxLease        time.Duration
+	OutboxMaxAttempts  int
+	OutboxRetention    time.Duration
+	EventPublisher     string
+	WebhookURL         string
+	WebhookSecret      string
+	WebhookTimeout     time.Duration
+	NATSURL            string
+	NATSSubjectPrefix  string
+	IdempotencyTTL     time.Duration
+	IdempotencyLock    time.Duration
+	PurgeInterval      time.Duration
+	PurgeBatchSize     int
+	PurgeMaxBatches    int
+	AuthEnabled        bool
+	JWKSFile           string
+	JWTIssuer          string
+	JWTAudience        string
+	RateLimitEnabled   bool
+	RateLimitStore     string
+	RateLimitDefault   string
+	RateLimitRoutes    string
+	TrustedProxies     []string
+	DefaultTenant      string
+	OrderCacheEnabled  bool
+	OrderCacheSize     int
+	OrderCacheTTL      time.Duration
+	GRPCEnabled        bool
+	GRPCPort           string
 }
 
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
 	return &Config{
-		ServerPort:     getEnv("SERVER_PORT", "8080"),
-		DBHost:         getEnv("DB_HOST", "localhost"),
-		DBPort:         getEnv("DB_PORT", "5432"),
-		DBUser:         getEnv("DB_USER", "postgres"),
-		DBPassword:     getEnv("DB_PASSWORD", "postgres"),
-		DBName:         getEnv("DB_NAME", "ordersdb"),
-		DBSSLMode:      getEnv("DB_SSLMODE", "disable"),
-		LogLevel:       getEnv("LOG_LEVEL", "info"),
-		OTelEnabled:    getEnvBool("OTEL_ENABLED", true),
-		EventQueueSize: getEnvInt("EVENT_QUEUE_SIZE", 100),
-		Hostname:       getEnv("HOSTNAME", "localhost"),
+		ServerPort:         getEnv("SERVER_PORT", "8080"),
+		DBHost:             getEnv("DB_HOST", "localhost"),
+		DBPort:             getEnv("DB_PORT", "5432"),
+		DBUser:             getEnv("DB_USER", "orders_app"),
+		DBPassword:         getEnv("DB_PASSWORD", "orders_app"),
+		DBName:             getEnv("DB_NAME", "ordersdb"),
+		DBSSLMode:          getEnv("DB_SSLMODE", "disable"),
+		StorageBackend:     getEnv("STORAGE_BACKEND", StoragePostgres),
+		AutoMigrate:        getEnvBool("DB_AUTO_MIGRATE", false),
+		LogLevel:           getEnv("LOG_LEVEL", "info"),
+		OTelEnabled:        getEnvBool("OTEL_ENABLED", true),
+		TracesExporter:     getEnv("OTEL_TRACES_EXPORTER", "otlp"),
+		TracesSampleRatio:  getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1),
+		OTLPEndpoint:       getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4317"),
+		OTLPProtocol:       getEnv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc"),
+		ServiceVersion:     getEnv("SERVICE_VERSION", "dev"),
+		ServiceInstanceID:  getEnv("SERVICE_INSTANCE_ID", hostname()),
+		Environment:        getEnv("DEPLOYMENT_ENVIRONMENT", "development"),
+		EventQueueSize:     getEnvInt("EVENT_QUEUE_SIZE", 100),
+		EventQueueMaxFill:  getEnvFloat("EVENT_QUEUE_READY_MAX_FILL", 0.9),
+		WorkerStallTimeout: getEnvDuration("EVENT_WORKER_STALL_TIMEOUT", 30*time.Second),
+		ShutdownDrainDelay: getEnvDuration("SHUTDOWN_DRAIN_DELAY", 0),
+		Hostname:           getEnv("HOSTNAME", "localhost"),
+		OutboxPollInterval: getEnvDuration("OUTBOX_POLL_INTERVAL", 500*time.Millisecond),
+		OutboxBatchSize:    getEnvInt("OUTBOX_BATCH_SIZE", 50),
+		OutboxLease:        getEnvDuration("OUTBOX_LEASE", 30*time.Second),
+		OutboxMaxAttempts:  getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+		OutboxRetention:    getEnvDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+		EventPublisher:     getEnv("EVENT_PUBLISHER", "memory"),
+		WebhookURL:         getEnv("WEBHOOK_URL", ""),
+		WebhookSecret:      getEnv("WEBHOOK_SECRET", ""),
+		WebhookTimeout:     getEnvDuration("WEBHOOK_TIMEOUT", 5*time.Second),
+		NATSURL:            getEnv("NATS_URL", "nats://localhost:4222"),
+		NATSSubjectPrefix:  getEnv("NATS_SUBJECT_PREFIX", "orders"),
+		IdempotencyTTL:     getEnvDuration("IDEMPOTENCY_TTL", 10*time.Minute),
+		IdempotencyLock:    getEnvDuration("IDEMPOTENCY_LOCK_TIMEOUT", time.Minute),
+		PurgeInterval:      getEnvDuration("IDEMPOTENCY_PURGE_INTERVAL", time.Minute),
+		PurgeBatchSize:     getEnvInt("IDEMPOTENCY_PURGE_BATCH_SIZE", 1000),
+		PurgeMaxBatches:    getEnvInt("IDEMPOTENCY_PURGE_MAX_BATCHES", 100),
+		AuthEnabled:        getEnvBool("AUTH_ENABLED", true),
+		JWKSFile:           getEnv("AUTH_JWKS_FILE", ""),
+		JWTIssuer:          getEnv("AUTH_JWT_ISSUER", ""),
+		JWTAudience:        getEnv("AUTH_JWT_AUDIENCE", ""),
+		RateLimitEnabled:   getEnvBool("RATE_LIMIT_ENABLED", true),
+		RateLimitStore:     getEnv("RATE_LIMIT_STORE", "memory"),
+		RateLimitDefault:   getEnv("RATE_LIMIT_DEFAULT", "600/1m"),
+		RateLimitRoutes:    getEnv("RATE_LIMIT_ROUTES", "POST /orders=60/1m"),
+		TrustedProxies:     getEnvList("TRUSTED_PROXIES"),
+		DefaultTenant:      getEnv("TENANT_DEFAULT", "default"),
+		OrderCacheEnabled:  getEnvBool("ORDER_CACHE_ENABLED", false),
+		OrderCacheSize:     getEnvInt("ORDER_CACHE_SIZE", 10000),
+		OrderCacheTTL:      getEnvDuration("ORDER_CACHE_TTL", 30*time.Second),
+		GRPCEnabled:        getEnvBool("GRPC_ENABLED", true),
+		GRPCPort:           getEnv("GRPC_PORT", "9090"),
 	}
 }
 
@@ -44,6 +138,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList returns the comma-separated values of key, or nil if it is unset
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		parsed, err := strconv.ParseBool(value)
@@ -63,3 +168,32 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// hostname returns the host name, used to identify the instance by default
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
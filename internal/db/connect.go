@@ -10,13 +10,16 @@ import (
 	"go.uber.org/zap"
 )
 
-func ConnectDB(cfg *config.Config, logger *zap.Logger) (*sql.DB, error) {
-	dsn := fmt.Sprintf(
+// DSN returns the connection string of the database
+func DSN(cfg *config.Config) string {
+	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBSSLMode,
 	)
+}
 
-	db, err := sql.Open("postgres", dsn)
+func ConnectDB(cfg *config.Config, logger *zap.Logger) (*sql.DB, error) {
+	db, err := sql.Open("postgres", DSN(cfg))
 	if err != nil {
 		return nil, err
 	}
@@ -1,26 +1,170 @@
 package events
 
-import "casebrief/internal/models"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"casebrief/internal/models"
+)
+
+// Event types, stored in the outbox and sent with every published message
+const (
+	EventTypeOrderCreated   = "OrderCreated"
+	EventTypeOrderCancelled = "OrderCancelled"
+	EventTypeOrderUpdated   = "OrderUpdated"
+)
+
+// Event is implemented by every event emitted by the service
+type Event interface {
+	// EventType returns the type the event is published with
+	EventType() string
+	// AggregateID returns the ID of the order the event belongs to
+	AggregateID() string
+	// Tenant returns the tenant the order belongs to
+	Tenant() string
+}
+
+// Envelope carries an event from the outbox to the worker
+type Envelope struct {
+	// OutboxID is the ID of the outbox row the event was read from
+	OutboxID int64
+	Event    Event
+	// TraceContext is the W3C trace context and baggage of the request that
+	// emitted the event
+	TraceContext map[string]string
+}
 
 // OrderCreatedEvent represents an event emitted when an order is created
 type OrderCreatedEvent struct {
-	OrderID    string
-	CustomerID string
-	ProductID  string
-	Quantity   int
-	TotalPrice float64
-	Timestamp  int64
+	OrderID    string             `json:"order_id"`
+	TenantID   string             `json:"tenant_id"`
+	CustomerID string             `json:"customer_id"`
+	ProductID  string             `json:"product_id"`
+	Quantity   int                `json:"quantity"`
+	TotalPrice models.Money       `json:"total_price"`
+	Currency   string             `json:"currency"`
+	Items      []models.OrderItem `json:"items"`
+	Timestamp  int64              `json:"timestamp"`
+
+	ShippingAddress *models.ShippingAddress `json:"shipping_address,omitempty"`
 }
 
+// EventType implements Event
+func (e *OrderCreatedEvent) EventType() string { return EventTypeOrderCreated }
+
+// AggregateID implements Event
+func (e *OrderCreatedEvent) AggregateID() string { return e.OrderID }
+
+// Tenant implements Event
+func (e *OrderCreatedEvent) Tenant() string { return e.TenantID }
+
 // ToOrder converts event to order model
 func (e *OrderCreatedEvent) ToOrder() *models.Order {
 	return &models.Order{
-		ID:          e.OrderID,
+		ID:         e.OrderID,
+		TenantID:   e.TenantID,
 		CustomerID: e.CustomerID,
 		ProductID:  e.ProductID,
 		Quantity:   e.Quantity,
 		TotalPrice: e.TotalPrice,
-		Status:     "created",
+		Currency:   e.Currency,
+		Status:     models.OrderStatusCreated,
+		Items:      e.Items,
+
+		ShippingAddress: e.ShippingAddress,
 	}
 }
 
+// OrderCancelledEvent represents an event emitted when an order is cancelled.
+// It carries what downstream systems need to compensate, e.g. release the
+// reserved stock or refund the customer.
+type OrderCancelledEvent struct {
+	OrderID        string             `json:"order_id"`
+	TenantID       string             `json:"tenant_id"`
+	CustomerID     string             `json:"customer_id"`
+	ProductID      string             `json:"product_id"`
+	Quantity       int                `json:"quantity"`
+	TotalPrice     models.Money       `json:"total_price"`
+	Currency       string             `json:"currency"`
+	Items          []models.OrderItem `json:"items"`
+	PreviousStatus string             `json:"previous_status"`
+	ReasonCode     string             `json:"reason_code"`
+	Reason         string             `json:"reason,omitempty"`
+	CancelledBy    string             `json:"cancelled_by"`
+	Timestamp      int64              `json:"timestamp"`
+}
+
+// EventType implements Event
+func (e *OrderCancelledEvent) EventType() string { return EventTypeOrderCancelled }
+
+// AggregateID implements Event
+func (e *OrderCancelledEvent) AggregateID() string { return e.OrderID }
+
+// Tenant implements Event
+func (e *OrderCancelledEvent) Tenant() string { return e.TenantID }
+
+// OrderUpdatedEvent represents an event emitted when the lines or the shipping
+// address of an order are changed. ChangedFields names the order fields that
+// changed; the event carries their new values together with the rest of the
+// changeable part of the order.
+type OrderUpdatedEvent struct {
+	OrderID         string                  `json:"order_id"`
+	TenantID        string                  `json:"tenant_id"`
+	CustomerID      string                  `json:"customer_id"`
+	Version         int64                   `json:"version"`
+	ChangedFields   []string                `json:"changed_fields"`
+	ProductID       string                  `json:"product_id"`
+	Quantity        int                     `json:"quantity"`
+	TotalPrice      models.Money            `json:"total_price"`
+	Currency        string                  `json:"currency"`
+	Items           []models.OrderItem      `json:"items"`
+	ShippingAddress *models.ShippingAddress `json:"shipping_address"`
+	UpdatedBy       string                  `json:"updated_by,omitempty"`
+	Timestamp       int64                   `json:"timestamp"`
+}
+
+// EventType implements Event
+func (e *OrderUpdatedEvent) EventType() string { return EventTypeOrderUpdated }
+
+// AggregateID implements Event
+func (e *OrderUpdatedEvent) AggregateID() string { return e.OrderID }
+
+// Tenant implements Event
+func (e *OrderUpdatedEvent) Tenant() string { return e.TenantID }
+
+// NewOutboxEvent serializes an event into an outbox record, together with the
+// trace context of ctx
+func NewOutboxEvent(ctx context.Context, event Event) (*models.OutboxEvent, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OutboxEvent{
+		EventType:    event.EventType(),
+		AggregateID:  event.AggregateID(),
+		Payload:      payload,
+		TraceContext: injectTraceContext(ctx),
+	}, nil
+}
+
+// decodeEvent deserializes the payload of an outbox record
+func decodeEvent(eventType string, payload []byte) (Event, error) {
+	var event Event
+	switch eventType {
+	case EventTypeOrderCreated:
+		event = &OrderCreatedEvent{}
+	case EventTypeOrderCancelled:
+		event = &OrderCancelledEvent{}
+	case EventTypeOrderUpdated:
+		event = &OrderUpdatedEvent{}
+	default:
+		return nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,46 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryPublisher keeps the most recently published messages in memory.
+// It is meant for local development and tests.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []*Message
+	capacity int
+}
+
+// NewMemoryPublisher creates a publisher retaining at most capacity messages
+func NewMemoryPublisher(capacity int) *MemoryPublisher {
+	return &MemoryPublisher{
+		capacity: capacity,
+	}
+}
+
+// Publish stores the message, evicting the oldest one when full
+func (p *MemoryPublisher) Publish(ctx context.Context, msg *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.capacity > 0 && len(p.messages) >= p.capacity {
+		p.messages = p.messages[1:]
+	}
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of the retained messages, oldest first
+func (p *MemoryPublisher) Messages() []*Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*Message(nil), p.messages...)
+}
+
+// Close is a no-op
+func (p *MemoryPublisher) Close() error {
+	return nil
+}
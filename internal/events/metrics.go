@@ -0,0 +1,57 @@
+package events
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons for events not being handed to the worker or failing in the worker
+const (
+	reasonDecode  = "decode"
+	reasonStopped = "stopped"
+	reasonEncode  = "encode"
+	reasonPublish = "publish"
+)
+
+// Worker processing results
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	eventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_dropped_total",
+		Help: "Number of outbox events claimed by the relay but not handed to the worker by reason (decode, stopped). They are claimed again once their lease expires.",
+	}, []string{"reason"})
+	eventsDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_dead_lettered_total",
+		Help: "Number of outbox events dead-lettered by event type because they were not delivered within the maximum number of attempts.",
+	}, []string{"event_type"})
+	workerProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "event_worker_processing_duration_seconds",
+		Help:    "Duration of event processing by the worker by event type and result (success, failure).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"event_type", "result"})
+	workerFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_worker_failures_total",
+		Help: "Number of events the worker failed to process by event type and reason (encode, publish).",
+	}, []string{"event_type", "reason"})
+)
+
+// RegisterQueueMetrics exposes the depth and capacity of the event channel.
+// It must be called at most once per process.
+func RegisterQueueMetrics(eventChan chan *Envelope) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "events_queue_depth",
+		Help: "Number of events waiting in the event channel.",
+	}, func() float64 {
+		return float64(len(eventChan))
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "events_queue_capacity",
+		Help: "Capacity of the event channel.",
+	}, func() float64 {
+		return float64(cap(eventChan))
+	})
+}
@@ -0,0 +1,260 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// natsTimeout bounds the handshake and publish acknowledgement when the
+// context has no deadline
+const natsTimeout = 5 * time.Second
+
+// NATSPublisher publishes messages to a NATS server using the core NATS
+// text protocol. Every publish is followed by a PING and only succeeds once
+// the matching PONG arrived, which guarantees the server processed the PUB.
+// Messages are published on "<subject prefix>.<event type>", with their
+// headers (trace context) if the server supports headers.
+type NATSPublisher struct {
+	url           string
+	subjectPrefix string
+	logger        *zap.Logger
+
+	mu   sync.Mutex
+	conn *natsConn
+}
+
+// natsConn is a single connection to the NATS server
+type natsConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	// headers is set if the server accepts messages with headers (HPUB)
+	headers bool
+	// pongs receives nil for every PONG and the error that closed the connection
+	pongs chan error
+}
+
+// NewNATSPublisher creates a new NATS publisher. The connection is
+// established lazily on the first publish and re-established after failures.
+func NewNATSPublisher(url, subjectPrefix string, logger *zap.Logger) *NATSPublisher {
+	return &NATSPublisher{
+		url:           url,
+		subjectPrefix: subjectPrefix,
+		logger:        logger,
+	}
+}
+
+// Publish sends the message and waits for the server to confirm it
+func (p *NATSPublisher) Publish(ctx context.Context, msg *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		conn, err := p.connect(ctx)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+
+	subject := p.subjectPrefix + "." + msg.Type
+	frame := natsPubFrame(subject, msg, p.conn.headers)
+	if err := p.conn.write(ctx, frame); err != nil {
+		p.closeConn()
+		return err
+	}
+
+	if err := p.conn.awaitPong(ctx); err != nil {
+		p.closeConn()
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection to the server
+func (p *NATSPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closeConn()
+	return nil
+}
+
+// closeConn drops the current connection; the caller must hold p.mu
+func (p *NATSPublisher) closeConn() {
+	if p.conn != nil {
+		p.conn.conn.Close()
+		p.conn = nil
+	}
+}
+
+// connect dials the server and performs the INFO/CONNECT/PING handshake
+func (p *NATSPublisher) connect(ctx context.Context) (*natsConn, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(deadline(ctx))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected NATS greeting: %q", strings.TrimSpace(line))
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	var info struct {
+		Headers bool `json:"headers"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("invalid NATS server info: %w", err)
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "orders-service",
+		"lang":     "go",
+		"protocol": 1,
+		"headers":  info.Headers,
+	}
+	if u.User != nil {
+		options["user"] = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			options["pass"] = password
+		}
+	}
+	connectJSON, err := json.Marshal(options)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	nc := &natsConn{
+		conn:    conn,
+		pongs:   make(chan error, 1),
+		headers: info.Headers,
+	}
+	go nc.readLoop(reader)
+
+	if err := nc.write(ctx, "CONNECT "+string(connectJSON)+"\r\nPING\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := nc.awaitPong(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	p.logger.Info("Connected to NATS server",
+		zap.String("host", u.Host),
+	)
+	return nc, nil
+}
+
+// natsPubFrame builds the PUB frame of a message followed by a PING, or an
+// HPUB frame if the message has headers and the server supports them
+func natsPubFrame(subject string, msg *Message, headers bool) string {
+	if !headers || len(msg.Headers) == 0 {
+		return fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(msg.Payload), msg.Payload)
+	}
+
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var header strings.Builder
+	header.WriteString("NATS/1.0\r\n")
+	for _, name := range names {
+		header.WriteString(name + ": " + msg.Headers[name] + "\r\n")
+	}
+	header.WriteString("\r\n")
+
+	return fmt.Sprintf("HPUB %s %d %d\r\n%s%s\r\nPING\r\n", subject, header.Len(), header.Len()+len(msg.Payload), header.String(), msg.Payload)
+}
+
+// write sends raw protocol data
+func (c *natsConn) write(ctx context.Context, data string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(deadline(ctx))
+	_, err := c.conn.Write([]byte(data))
+	return err
+}
+
+// awaitPong waits for the next PONG or protocol error
+func (c *natsConn) awaitPong(ctx context.Context) error {
+	timer := time.NewTimer(time.Until(deadline(ctx)))
+	defer timer.Stop()
+
+	select {
+	case err := <-c.pongs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return errors.New("timed out waiting for NATS acknowledgement")
+	}
+}
+
+// readLoop handles messages sent by the server until the connection closes
+func (c *natsConn) readLoop(reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			c.signal(err)
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PING":
+			c.write(context.Background(), "PONG\r\n")
+		case line == "PONG":
+			c.signal(nil)
+		case strings.HasPrefix(line, "-ERR"):
+			c.signal(fmt.Errorf("NATS server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR"))))
+		}
+	}
+}
+
+// signal reports a PONG (nil) or error to a waiting publisher without blocking
+func (c *natsConn) signal(err error) {
+	select {
+	case c.pongs <- err:
+	default:
+	}
+}
+
+// deadline returns the context deadline, or natsTimeout from now
+func deadline(ctx context.Context) time.Time {
+	if d, ok := ctx.Deadline(); ok {
+		return d
+	}
+	return time.Now().Add(natsTimeout)
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"casebrief/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// Publisher types selectable with config.Config.EventPublisher
+const (
+	PublisherMemory  = "memory"
+	PublisherWebhook = "webhook"
+	PublisherNATS    = "nats"
+)
+
+// Message is a serialized event ready to be delivered downstream
+type Message struct {
+	// Type is the event type, e.g. OrderCreated
+	Type string
+	// Key identifies the aggregate the event belongs to (the order ID)
+	Key string
+	// Payload is the JSON encoded event
+	Payload []byte
+	// Headers carry the W3C trace context (traceparent, tracestate) and
+	// baggage of the delivery, so consumers can continue the trace, and the
+	// tenant of the order (X-Tenant-ID), so consumers can route by tenant
+	// without decoding the payload
+	Headers map[string]string
+}
+
+// EventPublisher delivers events to downstream consumers. Publish must only
+// return nil once the message has been accepted by the destination, so that
+// failed deliveries are retried.
+type EventPublisher interface {
+	Publish(ctx context.Context, msg *Message) error
+	Close() error
+}
+
+// NewPublisher creates the event publisher selected in the configuration
+func NewPublisher(cfg *config.Config, logger *zap.Logger) (EventPublisher, error) {
+	switch cfg.EventPublisher {
+	case PublisherMemory:
+		return NewMemoryPublisher(cfg.EventQueueSize), nil
+	case PublisherWebhook:
+		return NewWebhookPublisher(cfg.WebhookURL, cfg.WebhookSecret, cfg.WebhookTimeout), nil
+	case PublisherNATS:
+		return NewNATSPublisher(cfg.NATSURL, cfg.NATSSubjectPrefix, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown event publisher %q", cfg.EventPublisher)
+	}
+}
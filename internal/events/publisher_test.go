@@ -0,0 +1,220 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMemoryPublisher_EvictsOldest(t *testing.T) {
+	publisher := NewMemoryPublisher(2)
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, publisher.Publish(context.Background(), &Message{Type: EventTypeOrderCreated, Key: key}))
+	}
+
+	messages := publisher.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "b", messages[0].Key)
+	assert.Equal(t, "c", messages[1].Key)
+}
+
+func TestWebhookPublisher_Publish(t *testing.T) {
+	payload := []byte(`{"order_id":"order-1"}`)
+
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	publisher := NewWebhookPublisher(server.URL, "secret", time.Second)
+	defer publisher.Close()
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	err := publisher.Publish(context.Background(), &Message{
+		Type:    EventTypeOrderCreated,
+		Key:     "order-1",
+		Payload: payload,
+		Headers: map[string]string{"traceparent": traceparent},
+	})
+	require.NoError(t, err)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(payload)
+
+	assert.Equal(t, http.MethodPost, received.Method)
+	assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	assert.Equal(t, EventTypeOrderCreated, received.Header.Get(WebhookEventTypeHeader))
+	assert.Equal(t, "order-1", received.Header.Get(WebhookEventKeyHeader))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), received.Header.Get(WebhookSignatureHeader))
+	assert.Equal(t, traceparent, received.Header.Get("traceparent"))
+	assert.Equal(t, payload, body)
+}
+
+func TestWebhookPublisher_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	publisher := NewWebhookPublisher(server.URL, "", time.Second)
+
+	err := publisher.Publish(context.Background(), &Message{Type: EventTypeOrderCreated, Key: "order-1"})
+	assert.Error(t, err)
+}
+
+// natsPub is a PUB or HPUB received by fakeNATSServer
+type natsPub struct {
+	subject string
+	headers string
+	payload string
+}
+
+// fakeNATSServer is a minimal stand-in for a NATS server speaking the core protocol
+type fakeNATSServer struct {
+	listener net.Listener
+	pubs     chan natsPub
+	connects chan string
+}
+
+func newFakeNATSServer(t *testing.T) *fakeNATSServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeNATSServer{
+		listener: listener,
+		pubs:     make(chan natsPub, 10),
+		connects: make(chan string, 10),
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeNATSServer) url() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+func (s *fakeNATSServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeNATSServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	conn.Write([]byte("INFO {\"server_id\":\"fake\",\"max_payload\":1048576,\"headers\":true}\r\n"))
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "CONNECT":
+			s.connects <- strings.TrimSpace(strings.TrimPrefix(line, "CONNECT"))
+		case "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			s.pubs <- natsPub{subject: fields[1], payload: string(payload[:size])}
+		case "HPUB":
+			headerSize, _ := strconv.Atoi(fields[len(fields)-2])
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			frame := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, frame); err != nil {
+				return
+			}
+			s.pubs <- natsPub{subject: fields[1], headers: string(frame[:headerSize]), payload: string(frame[headerSize:size])}
+		}
+	}
+}
+
+func TestNATSPublisher_Publish(t *testing.T) {
+	server := newFakeNATSServer(t)
+
+	publisher := NewNATSPublisher(server.url(), "orders", zap.NewNop())
+	defer publisher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	for _, key := range []string{"order-1", "order-2"} {
+		err := publisher.Publish(ctx, &Message{Type: EventTypeOrderCreated, Key: key, Payload: []byte(`{"order_id":"` + key + `"}`)})
+		require.NoError(t, err)
+	}
+
+	assert.Contains(t, <-server.connects, `"name":"orders-service"`)
+	assert.Equal(t, natsPub{subject: "orders.OrderCreated", payload: `{"order_id":"order-1"}`}, <-server.pubs)
+	assert.Equal(t, natsPub{subject: "orders.OrderCreated", payload: `{"order_id":"order-2"}`}, <-server.pubs)
+	assert.Len(t, server.connects, 0, "publisher should reuse its connection")
+}
+
+func TestNATSPublisher_PublishesHeaders(t *testing.T) {
+	server := newFakeNATSServer(t)
+
+	publisher := NewNATSPublisher(server.url(), "orders", zap.NewNop())
+	defer publisher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := publisher.Publish(ctx, &Message{
+		Type:    EventTypeOrderCreated,
+		Key:     "order-1",
+		Payload: []byte(`{"order_id":"order-1"}`),
+		Headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "baggage": "tenant=acme"},
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, <-server.connects, `"headers":true`)
+	assert.Equal(t, natsPub{
+		subject: "orders.OrderCreated",
+		headers: "NATS/1.0\r\nbaggage: tenant=acme\r\ntraceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n\r\n",
+		payload: `{"order_id":"order-1"}`,
+	}, <-server.pubs)
+}
+
+func TestNATSPublisher_Unreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	publisher := NewNATSPublisher("nats://"+addr, "orders", zap.NewNop())
+
+	err = publisher.Publish(context.Background(), &Message{Type: EventTypeOrderCreated, Key: "order-1"})
+	assert.Error(t, err)
+}
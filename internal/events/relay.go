@@ -0,0 +1,177 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"casebrief/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// OutboxStore is the storage used by the relay to read the transactional outbox
+type OutboxStore interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error)
+	MarkOutboxEventProcessed(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64) error
+	DeadLetterOutboxEvent(ctx context.Context, id int64) error
+}
+
+// OutboxRelay polls the outbox and feeds claimed events to the worker.
+// Events are marked processed only after the worker acknowledged them, so
+// delivery is at-least-once and survives restarts. Only as many events are
+// claimed as the event channel has room for, so claimed events do not wait
+// in the channel until their lease expires. Events that failed maxAttempts
+// times, because they cannot be decoded or published, are dead-lettered
+// instead of being retried forever.
+type OutboxRelay struct {
+	store       OutboxStore
+	eventChan   chan *Envelope
+	interval    time.Duration
+	batchSize   int
+	lease       time.Duration
+	maxAttempts int
+	logger      *zap.Logger
+	stopChan    chan struct{}
+}
+
+// NewOutboxRelay creates a new outbox relay
+func NewOutboxRelay(store OutboxStore, eventChan chan *Envelope, interval time.Duration, batchSize int, lease time.Duration, maxAttempts int, logger *zap.Logger) *OutboxRelay {
+	return &OutboxRelay{
+		store:       store,
+		eventChan:   eventChan,
+		interval:    interval,
+		batchSize:   batchSize,
+		lease:       lease,
+		maxAttempts: maxAttempts,
+		logger:      logger,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// Start starts polling the outbox
+func (r *OutboxRelay) Start(ctx context.Context) {
+	r.logger.Info("Outbox relay started",
+		zap.Duration("interval", r.interval),
+		zap.Int("batch_size", r.batchSize),
+	)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.relayBatch(ctx)
+		case <-ctx.Done():
+			r.logger.Info("Outbox relay stopping due to context cancellation")
+			return
+		case <-r.stopChan:
+			r.logger.Info("Outbox relay stopping")
+			return
+		}
+	}
+}
+
+// Stop stops the relay
+func (r *OutboxRelay) Stop() {
+	close(r.stopChan)
+}
+
+// Ack marks the outbox row of a processed event as delivered
+func (r *OutboxRelay) Ack(ctx context.Context, envelope *Envelope) {
+	if envelope.OutboxID == 0 {
+		return
+	}
+	if err := r.store.MarkOutboxEventProcessed(ctx, envelope.OutboxID); err != nil {
+		// The event will be delivered again once its lease expires
+		r.logger.Warn("Failed to acknowledge outbox event",
+			zap.Error(err),
+			zap.Int64("outbox_id", envelope.OutboxID),
+		)
+	}
+}
+
+// Nack counts a failed delivery attempt of an event. The event is delivered
+// again once its lease expires.
+func (r *OutboxRelay) Nack(ctx context.Context, envelope *Envelope) {
+	if envelope.OutboxID == 0 {
+		return
+	}
+	r.markFailed(ctx, envelope.OutboxID)
+}
+
+// relayBatch claims a batch of pending events, at most as many as the event
+// channel has room for, and hands them to the worker
+func (r *OutboxRelay) relayBatch(ctx context.Context) {
+	limit := min(r.batchSize, cap(r.eventChan)-len(r.eventChan))
+	if limit <= 0 {
+		return
+	}
+
+	claimed, err := r.store.ClaimOutboxEvents(ctx, limit, r.lease)
+	if err != nil {
+		r.logger.Error("Failed to claim outbox events", zap.Error(err))
+		return
+	}
+
+	for i, record := range claimed {
+		if record.Attempts >= r.maxAttempts {
+			r.deadLetter(ctx, record)
+			continue
+		}
+
+		event, err := decodeEvent(record.EventType, record.Payload)
+		if err != nil {
+			r.logger.Error("Failed to decode outbox event",
+				zap.Error(err),
+				zap.Int64("outbox_id", record.ID),
+				zap.String("event_type", record.EventType),
+			)
+			eventsDropped.WithLabelValues(reasonDecode).Inc()
+			r.markFailed(ctx, record.ID)
+			continue
+		}
+
+		select {
+		case r.eventChan <- &Envelope{OutboxID: record.ID, Event: event, TraceContext: record.TraceContext}:
+		case <-ctx.Done():
+			eventsDropped.WithLabelValues(reasonStopped).Add(float64(len(claimed) - i))
+			return
+		case <-r.stopChan:
+			eventsDropped.WithLabelValues(reasonStopped).Add(float64(len(claimed) - i))
+			return
+		}
+	}
+}
+
+// deadLetter stops the delivery of an event that exhausted its attempts
+func (r *OutboxRelay) deadLetter(ctx context.Context, record *models.OutboxEvent) {
+	if err := r.store.DeadLetterOutboxEvent(ctx, record.ID); err != nil {
+		// The event is claimed and dead-lettered again after its lease
+		r.logger.Warn("Failed to dead-letter outbox event",
+			zap.Error(err),
+			zap.Int64("outbox_id", record.ID),
+		)
+		return
+	}
+
+	eventsDeadLettered.WithLabelValues(record.EventType).Inc()
+	r.logger.Error("Outbox event dead-lettered after too many delivery attempts",
+		zap.Int64("outbox_id", record.ID),
+		zap.String("event_type", record.EventType),
+		zap.String("order_id", record.AggregateID),
+		zap.Int("attempts", record.Attempts),
+	)
+}
+
+// markFailed counts a failed delivery attempt of an event
+func (r *OutboxRelay) markFailed(ctx context.Context, id int64) {
+	if err := r.store.MarkOutboxEventFailed(ctx, id); err != nil {
+		// The event is retried after its lease without counting the attempt
+		r.logger.Warn("Failed to count outbox event delivery attempt",
+			zap.Error(err),
+			zap.Int64("outbox_id", id),
+		)
+	}
+}
@@ -0,0 +1,209 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"casebrief/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeOutboxStore struct {
+	mu           sync.Mutex
+	pending      []*models.OutboxEvent
+	lockedUntil  map[int64]time.Time
+	processed    []int64
+	deadLettered []int64
+}
+
+func (s *fakeOutboxStore) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lockedUntil == nil {
+		s.lockedUntil = map[int64]time.Time{}
+	}
+	now := time.Now()
+	var claimed []*models.OutboxEvent
+	for _, event := range s.pending {
+		if len(claimed) == limit {
+			break
+		}
+		if slices.Contains(s.processed, event.ID) || slices.Contains(s.deadLettered, event.ID) || s.lockedUntil[event.ID].After(now) {
+			continue
+		}
+		s.lockedUntil[event.ID] = now.Add(lease)
+		record := *event
+		claimed = append(claimed, &record)
+	}
+	return claimed, nil
+}
+
+func (s *fakeOutboxStore) MarkOutboxEventProcessed(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.processed = append(s.processed, id)
+	return nil
+}
+
+func (s *fakeOutboxStore) MarkOutboxEventFailed(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range s.pending {
+		if event.ID == id {
+			event.Attempts++
+		}
+	}
+	return nil
+}
+
+func (s *fakeOutboxStore) DeadLetterOutboxEvent(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deadLettered = append(s.deadLettered, id)
+	return nil
+}
+
+func (s *fakeOutboxStore) processedIDs() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]int64(nil), s.processed...)
+}
+
+func TestOutboxRelay_DeliversAndAcknowledges(t *testing.T) {
+	payload, err := json.Marshal(&OrderCreatedEvent{OrderID: "order-1", Quantity: 1})
+	require.NoError(t, err)
+	cancelled, err := NewOutboxEvent(context.Background(), &OrderCancelledEvent{OrderID: "order-3", ReasonCode: "out_of_stock"})
+	require.NoError(t, err)
+	cancelled.ID = 3
+
+	store := &fakeOutboxStore{
+		pending: []*models.OutboxEvent{
+			{ID: 1, EventType: EventTypeOrderCreated, AggregateID: "order-1", Payload: payload},
+			{ID: 2, EventType: "Unknown", AggregateID: "order-2", Payload: payload},
+			cancelled,
+		},
+	}
+
+	logger := zap.NewNop()
+	eventChan := make(chan *Envelope, 10)
+	relay := NewOutboxRelay(store, eventChan, 10*time.Millisecond, 10, time.Minute, 5, logger)
+	publisher := NewMemoryPublisher(10)
+	worker := NewWorker(eventChan, publisher, relay, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Start(ctx)
+	go relay.Start(ctx)
+
+	assert.Eventually(t, func() bool {
+		return len(store.processedIDs()) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{1, 3}, store.processedIDs())
+
+	messages := publisher.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, EventTypeOrderCreated, messages[0].Type)
+	assert.Equal(t, "order-1", messages[0].Key)
+	assert.Equal(t, EventTypeOrderCancelled, messages[1].Type)
+	assert.Equal(t, "order-3", messages[1].Key)
+	assert.Contains(t, string(messages[1].Payload), `"reason_code":"out_of_stock"`)
+}
+
+func TestOutboxRelay_DeadLettersEventsOutOfAttempts(t *testing.T) {
+	payload, err := json.Marshal(&OrderCreatedEvent{OrderID: "order-1", Quantity: 1})
+	require.NoError(t, err)
+	store := &fakeOutboxStore{
+		pending: []*models.OutboxEvent{
+			{ID: 1, EventType: EventTypeOrderCreated, AggregateID: "order-1", Payload: payload, Attempts: 2},
+			{ID: 2, EventType: EventTypeOrderCreated, AggregateID: "order-2", Payload: payload, Attempts: 3},
+		},
+	}
+	eventChan := make(chan *Envelope, 10)
+	relay := NewOutboxRelay(store, eventChan, time.Minute, 10, time.Minute, 3, zap.NewNop())
+
+	relay.relayBatch(context.Background())
+
+	// After two failures the event is delivered, after the third it is
+	// dead-lettered
+	require.Len(t, eventChan, 1)
+	assert.Equal(t, int64(1), (<-eventChan).OutboxID)
+	assert.Equal(t, []int64{2}, store.deadLettered)
+}
+
+func TestOutboxRelay_ClaimsOnlyWhatTheChannelCanTake(t *testing.T) {
+	payload, err := json.Marshal(&OrderCreatedEvent{OrderID: "order-1", Quantity: 1})
+	require.NoError(t, err)
+	store := &fakeOutboxStore{}
+	for id := int64(1); id <= 3; id++ {
+		store.pending = append(store.pending, &models.OutboxEvent{ID: id, EventType: EventTypeOrderCreated, AggregateID: "order-1", Payload: payload})
+	}
+	// No worker drains the channel, and the lease expires between polls
+	eventChan := make(chan *Envelope, 2)
+	relay := NewOutboxRelay(store, eventChan, time.Minute, 10, time.Millisecond, 3, zap.NewNop())
+	ctx := context.Background()
+
+	relay.relayBatch(ctx)
+	require.Len(t, eventChan, 2)
+	time.Sleep(5 * time.Millisecond)
+	relay.relayBatch(ctx)
+
+	// The waiting events are neither claimed again nor charged an attempt,
+	// and the third event stays unclaimed until there is room
+	require.Len(t, eventChan, 2)
+	assert.Equal(t, int64(1), (<-eventChan).OutboxID)
+	assert.Equal(t, int64(2), (<-eventChan).OutboxID)
+	for _, event := range store.pending {
+		assert.Zero(t, event.Attempts)
+	}
+
+	// A failed publish counts as an attempt and is retried after the lease
+	relay.Nack(ctx, &Envelope{OutboxID: 1})
+	relay.Ack(ctx, &Envelope{OutboxID: 2})
+	assert.Equal(t, 1, store.pending[0].Attempts)
+
+	time.Sleep(5 * time.Millisecond)
+	relay.relayBatch(ctx)
+	require.Len(t, eventChan, 2)
+	assert.Equal(t, int64(1), (<-eventChan).OutboxID)
+	assert.Equal(t, int64(3), (<-eventChan).OutboxID)
+}
+
+func TestOutboxRelay_CountsFailedPublishes(t *testing.T) {
+	payload, err := json.Marshal(&OrderCreatedEvent{OrderID: "order-1", Quantity: 1})
+	require.NoError(t, err)
+	store := &fakeOutboxStore{
+		pending: []*models.OutboxEvent{{ID: 1, EventType: EventTypeOrderCreated, AggregateID: "order-1", Payload: payload}},
+	}
+	logger := zap.NewNop()
+	eventChan := make(chan *Envelope, 10)
+	relay := NewOutboxRelay(store, eventChan, 5*time.Millisecond, 10, time.Millisecond, 2, logger)
+	worker := NewWorker(eventChan, failingPublisher{}, relay, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Start(ctx)
+	go relay.Start(ctx)
+
+	// Two failed publishes exhaust the attempts
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.deadLettered) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	assert.Equal(t, 2, store.pending[0].Attempts)
+	assert.Empty(t, store.processed)
+}
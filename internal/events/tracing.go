@@ -0,0 +1,27 @@
+package events
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// tracerName is the instrumentation name of the spans created for events
+const tracerName = "casebrief/internal/events"
+
+// injectTraceContext returns the W3C trace context and baggage of ctx, or nil
+// if ctx carries none
+func injectTraceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// extractTraceContext returns ctx with the trace context and baggage of carrier
+func extractTraceContext(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookEventTypeHeader = "X-Event-Type"
+	WebhookEventKeyHeader  = "X-Event-Key"
+	WebhookSignatureHeader = "X-Signature-SHA256"
+)
+
+// WebhookPublisher delivers messages as HTTP POST requests with a JSON body.
+// When a secret is configured the body is signed with HMAC-SHA256.
+type WebhookPublisher struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookPublisher creates a new webhook publisher
+func NewWebhookPublisher(url, secret string, timeout time.Duration) *WebhookPublisher {
+	return &WebhookPublisher{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Publish posts the message and fails unless the endpoint answers with 2xx
+func (p *WebhookPublisher) Publish(ctx context.Context, msg *Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(msg.Payload))
+	if err != nil {
+		return err
+	}
+
+	for name, value := range msg.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventTypeHeader, msg.Type)
+	req.Header.Set(WebhookEventKeyHeader, msg.Key)
+	if p.secret != "" {
+		mac := hmac.New(sha256.New, []byte(p.secret))
+		mac.Write(msg.Payload)
+		req.Header.Set(WebhookSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close releases idle connections
+func (p *WebhookPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
@@ -2,22 +2,61 @@ package events
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"casebrief/internal/tenant"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
-// Worker processes events from the event channel
+// workerHeartbeatInterval is how often an idle worker reports that it is alive
+const workerHeartbeatInterval = time.Second
+
+var (
+	// ErrWorkerNotRunning is returned by Healthy when the worker loop is not running
+	ErrWorkerNotRunning = errors.New("event worker is not running")
+	// ErrWorkerStalled is returned by Healthy when the worker loop has not made progress recently
+	ErrWorkerStalled = errors.New("event worker stalled")
+)
+
+// Acknowledger is notified when the worker has finished processing an event
+type Acknowledger interface {
+	// Ack is called when the event was published
+	Ack(ctx context.Context, envelope *Envelope)
+	// Nack is called when publishing the event failed
+	Nack(ctx context.Context, envelope *Envelope)
+}
+
+// Worker processes events from the event channel and publishes them downstream
 type Worker struct {
-	eventChan chan *OrderCreatedEvent
+	eventChan chan *Envelope
+	publisher EventPublisher
+	acker     Acknowledger
 	logger    *zap.Logger
 	stopChan  chan struct{}
+
+	running   atomic.Bool
+	heartbeat atomic.Int64 // unix nanoseconds of the last loop iteration
 }
 
-// NewWorker creates a new event worker
-func NewWorker(eventChan chan *OrderCreatedEvent, logger *zap.Logger) *Worker {
+// NewWorker creates a new event worker. acker may be nil if published
+// events do not need to be acknowledged.
+func NewWorker(eventChan chan *Envelope, publisher EventPublisher, acker Acknowledger, logger *zap.Logger) *Worker {
 	return &Worker{
 		eventChan: eventChan,
+		publisher: publisher,
+		acker:     acker,
 		logger:    logger,
 		stopChan:  make(chan struct{}),
 	}
@@ -26,11 +65,30 @@ func NewWorker(eventChan chan *OrderCreatedEvent, logger *zap.Logger) *Worker {
 // Start starts the worker to process events
 func (w *Worker) Start(ctx context.Context) {
 	w.logger.Info("Event worker started")
-	
+
+	w.beat()
+	w.running.Store(true)
+	defer w.running.Store(false)
+
+	heartbeat := time.NewTicker(workerHeartbeatInterval)
+	defer heartbeat.Stop()
+
 	for {
 		select {
-		case event := <-w.eventChan:
-			w.processEvent(ctx, event)
+		case <-heartbeat.C:
+			w.beat()
+		case envelope := <-w.eventChan:
+			// Events that failed to publish are delivered again by the
+			// outbox relay
+			err := w.processEvent(ctx, envelope)
+			if w.acker != nil {
+				if err == nil {
+					w.acker.Ack(ctx, envelope)
+				} else {
+					w.acker.Nack(ctx, envelope)
+				}
+			}
+			w.beat()
 		case <-ctx.Done():
 			w.logger.Info("Event worker stopping due to context cancellation")
 			return
@@ -46,26 +104,100 @@ func (w *Worker) Stop() {
 	close(w.stopChan)
 }
 
-// processEvent processes a single OrderCreated event
-func (w *Worker) processEvent(ctx context.Context, event *OrderCreatedEvent) {
-	w.logger.Info("Processing OrderCreated event",
-		zap.String("order_id", event.OrderID),
-		zap.String("customer_id", event.CustomerID),
-		zap.Int("quantity", event.Quantity),
-		zap.Float64("total_price", event.TotalPrice),
+// Healthy returns an error if the worker loop is not running or has not
+// made progress for longer than staleAfter, e.g. because publishing hangs
+func (w *Worker) Healthy(staleAfter time.Duration) error {
+	if !w.running.Load() {
+		return ErrWorkerNotRunning
+	}
+	if since := time.Since(time.Unix(0, w.heartbeat.Load())); since > staleAfter {
+		return fmt.Errorf("%w: no progress for %s", ErrWorkerStalled, since.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// beat records that the worker loop is alive
+func (w *Worker) beat() {
+	w.heartbeat.Store(time.Now().UnixNano())
+}
+
+// processEvent publishes a single event in a consumer span and records its
+// duration. The span is linked to the request that emitted the event, and its
+// trace context is passed on to the publisher.
+func (w *Worker) processEvent(ctx context.Context, envelope *Envelope) error {
+	event := envelope.Event
+	producerCtx := extractTraceContext(context.Background(), envelope.TraceContext)
+	ctx = baggage.ContextWithBaggage(ctx, baggage.FromContext(producerCtx))
+	ctx, span := otel.Tracer(tracerName).Start(ctx, event.EventType()+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.LinkFromContext(producerCtx)),
+		trace.WithAttributes(
+			semconv.MessagingOperationProcess,
+			semconv.MessagingMessageID(strconv.FormatInt(envelope.OutboxID, 10)),
+			attribute.String("order.id", event.AggregateID()),
+			attribute.String("tenant.id", event.Tenant()),
+		),
 	)
+	defer span.End()
 
-	// Simulate some processing work
-	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	err := w.publishEvent(ctx, event)
 
-	// In a real system, this would:
-	// - Send notifications
-	// - Update inventory
-	// - Trigger downstream services
-	// - etc.
+	result := resultSuccess
+	if err != nil {
+		result = resultFailure
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	workerProcessingDuration.WithLabelValues(event.EventType(), result).Observe(time.Since(start).Seconds())
+	return err
+}
 
-	w.logger.Info("OrderCreated event processed successfully",
-		zap.String("order_id", event.OrderID),
+// publishEvent encodes and publishes a single event
+func (w *Worker) publishEvent(ctx context.Context, event Event) error {
+	w.logger.Info("Processing event",
+		zap.String("event_type", event.EventType()),
+		zap.String("order_id", event.AggregateID()),
+		zap.String("tenant_id", event.Tenant()),
 	)
-}
 
+	payload, err := json.Marshal(event)
+	if err != nil {
+		w.logger.Error("Failed to encode event",
+			zap.Error(err),
+			zap.String("event_type", event.EventType()),
+			zap.String("order_id", event.AggregateID()),
+		)
+		workerFailures.WithLabelValues(event.EventType(), reasonEncode).Inc()
+		return err
+	}
+
+	msg := &Message{
+		Type:    event.EventType(),
+		Key:     event.AggregateID(),
+		Payload: payload,
+		Headers: injectTraceContext(ctx),
+	}
+	if tenantID := event.Tenant(); tenantID != "" {
+		if msg.Headers == nil {
+			msg.Headers = make(map[string]string, 1)
+		}
+		msg.Headers[tenant.Header] = tenantID
+	}
+	if err := w.publisher.Publish(ctx, msg); err != nil {
+		w.logger.Error("Failed to publish event",
+			zap.Error(err),
+			zap.String("event_type", event.EventType()),
+			zap.String("order_id", event.AggregateID()),
+		)
+		workerFailures.WithLabelValues(event.EventType(), reasonPublish).Inc()
+		return err
+	}
+
+	w.logger.Info("Event processed successfully",
+		zap.String("event_type", event.EventType()),
+		zap.String("order_id", event.AggregateID()),
+		zap.String("tenant_id", event.Tenant()),
+	)
+	return nil
+}
@@ -0,0 +1,143 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// blockingPublisher never returns until its context is cancelled
+type blockingPublisher struct{}
+
+func (blockingPublisher) Publish(ctx context.Context, msg *Message) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (blockingPublisher) Close() error {
+	return nil
+}
+
+// failingPublisher rejects every message
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(ctx context.Context, msg *Message) error {
+	return errors.New("broker unavailable")
+}
+
+func (failingPublisher) Close() error {
+	return nil
+}
+
+func TestWorker_RecordsPublishFailures(t *testing.T) {
+	worker := NewWorker(make(chan *Envelope), failingPublisher{}, nil, zap.NewNop())
+	failures := workerFailures.WithLabelValues(EventTypeOrderCreated, reasonPublish)
+	failuresBefore := testutil.ToFloat64(failures)
+
+	err := worker.processEvent(context.Background(), &Envelope{Event: &OrderCreatedEvent{OrderID: "order-1"}})
+
+	assert.Error(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(failures)-failuresBefore)
+}
+
+func TestWorker_PropagatesTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	// The request emitting the event
+	member, err := baggage.NewMember("tenant", "acme")
+	require.NoError(t, err)
+	bag, err := baggage.New(member)
+	require.NoError(t, err)
+	ctx, request := tp.Tracer("test").Start(baggage.ContextWithBaggage(context.Background(), bag), "POST /orders")
+	outboxEvent, err := NewOutboxEvent(ctx, &OrderCreatedEvent{OrderID: "order-1"})
+	require.NoError(t, err)
+	request.End()
+	require.Contains(t, outboxEvent.TraceContext, "traceparent")
+
+	publisher := NewMemoryPublisher(10)
+	worker := NewWorker(make(chan *Envelope), publisher, nil, zap.NewNop())
+	err = worker.processEvent(context.Background(), &Envelope{
+		OutboxID:     1,
+		Event:        &OrderCreatedEvent{OrderID: "order-1"},
+		TraceContext: outboxEvent.TraceContext,
+	})
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	consumer := spans[1]
+	assert.Equal(t, "OrderCreated process", consumer.Name())
+	assert.Equal(t, trace.SpanKindConsumer, consumer.SpanKind())
+	require.Len(t, consumer.Links(), 1)
+	assert.Equal(t, request.SpanContext().TraceID(), consumer.Links()[0].SpanContext.TraceID())
+	assert.Equal(t, request.SpanContext().SpanID(), consumer.Links()[0].SpanContext.SpanID())
+
+	// The publisher receives the consumer span's context and the baggage
+	messages := publisher.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Headers["traceparent"], consumer.SpanContext().SpanID().String())
+	assert.Equal(t, "tenant=acme", messages[0].Headers["baggage"])
+}
+
+func TestWorker_SendsTenantHeader(t *testing.T) {
+	publisher := NewMemoryPublisher(10)
+	worker := NewWorker(make(chan *Envelope), publisher, nil, zap.NewNop())
+
+	err := worker.processEvent(context.Background(), &Envelope{Event: &OrderCancelledEvent{OrderID: "order-1", TenantID: "acme"}})
+	require.NoError(t, err)
+
+	messages := publisher.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "acme", messages[0].Headers["X-Tenant-ID"])
+	assert.Contains(t, string(messages[0].Payload), `"tenant_id":"acme"`)
+}
+
+func TestWorker_Healthy(t *testing.T) {
+	eventChan := make(chan *Envelope, 1)
+	worker := NewWorker(eventChan, NewMemoryPublisher(10), nil, zap.NewNop())
+	assert.ErrorIs(t, worker.Healthy(time.Minute), ErrWorkerNotRunning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go worker.Start(ctx)
+	assert.Eventually(t, func() bool {
+		return worker.Healthy(time.Minute) == nil
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		return worker.Healthy(time.Minute) == ErrWorkerNotRunning
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWorker_HealthyReportsStall(t *testing.T) {
+	eventChan := make(chan *Envelope, 1)
+	worker := NewWorker(eventChan, blockingPublisher{}, nil, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Start(ctx)
+
+	eventChan <- &Envelope{Event: &OrderCreatedEvent{OrderID: "order-1"}}
+	assert.Eventually(t, func() bool {
+		return errors.Is(worker.Healthy(50*time.Millisecond), ErrWorkerStalled)
+	}, 2*time.Second, 10*time.Millisecond)
+}
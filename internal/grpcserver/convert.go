@@ -0,0 +1,160 @@
+package grpcserver
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"casebrief/internal/models"
+	"casebrief/internal/problem"
+	"casebrief/internal/service"
+	ordersv1 "casebrief/proto/orders/v1"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// orderChangeTypes maps the kinds of order changes to their protobuf type
+var orderChangeTypes = map[string]ordersv1.OrderChange_Type{
+	service.OrderChangeCreated:       ordersv1.OrderChange_TYPE_CREATED,
+	service.OrderChangeUpdated:       ordersv1.OrderChange_TYPE_UPDATED,
+	service.OrderChangeStatusChanged: ordersv1.OrderChange_TYPE_STATUS_CHANGED,
+}
+
+// createOrderRequest converts a CreateOrder request to the request of the
+// order service. It returns a validation problem if the request has no lines
+// or an amount is not a decimal number.
+func createOrderRequest(req *ordersv1.CreateOrderRequest) (*models.CreateOrderRequest, error) {
+	invalid := problem.New(http.StatusBadRequest, problem.CodeValidationFailed, "The request has invalid fields")
+	if len(req.GetItems()) == 0 {
+		invalid.Errors = append(invalid.Errors, problem.FieldError{Field: "items", Code: "required", Message: "is required"})
+		return nil, invalid
+	}
+
+	items := make([]models.CreateOrderItemRequest, 0, len(req.GetItems()))
+	for i, item := range req.GetItems() {
+		unitPrice, err := models.ParseMoney(item.GetUnitPrice())
+		if err != nil {
+			invalid.Errors = append(invalid.Errors, problem.FieldError{Field: fmt.Sprintf("items[%d].unit_price", i), Code: "decimal", Message: "must be a decimal number"})
+		}
+		items = append(items, models.CreateOrderItemRequest{
+			ProductID: item.GetProductId(),
+			Quantity:  int(item.GetQuantity()),
+			UnitPrice: unitPrice,
+		})
+	}
+	if len(invalid.Errors) > 0 {
+		return nil, invalid
+	}
+
+	return &models.CreateOrderRequest{
+		CustomerID:      req.GetCustomerId(),
+		Items:           items,
+		Currency:        req.GetCurrency(),
+		OrderTime:       timeFromProto(req.GetOrderTime()),
+		ShippingAddress: shippingAddressFromProto(req.GetShippingAddress()),
+	}, nil
+}
+
+// listOrdersRequest converts a ListOrders request to the request of the
+// order service. It returns a validation problem if the page size is out of
+// range.
+func listOrdersRequest(req *ordersv1.ListOrdersRequest) (*models.ListOrdersRequest, error) {
+	if req.GetPageSize() < 0 || req.GetPageSize() > 100 {
+		invalid := problem.New(http.StatusBadRequest, problem.CodeValidationFailed, "The request has invalid fields")
+		invalid.Errors = []problem.FieldError{{Field: "page_size", Code: "max", Message: "must be between 1 and 100"}}
+		return nil, invalid
+	}
+
+	return &models.ListOrdersRequest{
+		CustomerID:    req.GetCustomerId(),
+		ProductID:     req.GetProductId(),
+		Status:        req.GetStatus(),
+		OrderTimeFrom: timeFromProto(req.GetOrderTimeFrom()),
+		OrderTimeTo:   timeFromProto(req.GetOrderTimeTo()),
+		CreatedFrom:   timeFromProto(req.GetCreatedFrom()),
+		CreatedTo:     timeFromProto(req.GetCreatedTo()),
+		Cursor:        req.GetPageToken(),
+		Limit:         int(req.GetPageSize()),
+		IncludeTotal:  req.GetIncludeTotal(),
+	}, nil
+}
+
+// orderToProto converts an order to its protobuf message
+func orderToProto(order *models.Order) *ordersv1.Order {
+	items := make([]*ordersv1.OrderItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, &ordersv1.OrderItem{
+			ProductId: item.ProductID,
+			Quantity:  int32(item.Quantity),
+			UnitPrice: item.UnitPrice.String(),
+			LineTotal: item.LineTotal.String(),
+		})
+	}
+
+	return &ordersv1.Order{
+		Id:              order.ID,
+		TenantId:        order.TenantID,
+		CustomerId:      order.CustomerID,
+		ProductId:       order.ProductID,
+		Quantity:        int32(order.Quantity),
+		TotalPrice:      order.TotalPrice.String(),
+		Currency:        order.Currency,
+		Status:          order.Status,
+		ShippingAddress: shippingAddressToProto(order.ShippingAddress),
+		Version:         order.Version,
+		OrderTime:       timestamppb.New(order.OrderTime),
+		CreatedAt:       timestamppb.New(order.CreatedAt),
+		UpdatedAt:       timestamppb.New(order.UpdatedAt),
+		Items:           items,
+	}
+}
+
+// listOrdersResponse converts a page of orders to its protobuf message
+func listOrdersResponse(resp *models.OrderListResponse) *ordersv1.ListOrdersResponse {
+	orders := make([]*ordersv1.Order, 0, len(resp.Orders))
+	for _, order := range resp.Orders {
+		orders = append(orders, orderToProto(order))
+	}
+	return &ordersv1.ListOrdersResponse{
+		Orders:        orders,
+		NextPageToken: resp.NextCursor,
+		TotalCount:    resp.TotalCount,
+	}
+}
+
+func shippingAddressFromProto(address *ordersv1.ShippingAddress) *models.ShippingAddress {
+	if address == nil {
+		return nil
+	}
+	return &models.ShippingAddress{
+		Name:       address.GetName(),
+		Line1:      address.GetLine1(),
+		Line2:      address.GetLine2(),
+		PostalCode: address.GetPostalCode(),
+		City:       address.GetCity(),
+		Country:    address.GetCountry(),
+	}
+}
+
+func shippingAddressToProto(address *models.ShippingAddress) *ordersv1.ShippingAddress {
+	if address == nil {
+		return nil
+	}
+	return &ordersv1.ShippingAddress{
+		Name:       address.Name,
+		Line1:      address.Line1,
+		Line2:      address.Line2,
+		PostalCode: address.PostalCode,
+		City:       address.City,
+		Country:    address.Country,
+	}
+}
+
+// timeFromProto returns the time of a timestamp, or the zero time if it is
+// not set
+func timeFromProto(timestamp *timestamppb.Timestamp) time.Time {
+	if timestamp == nil {
+		return time.Time{}
+	}
+	return timestamp.AsTime()
+}
@@ -0,0 +1,65 @@
+package grpcserver
+
+import (
+	"net/http"
+	"strings"
+
+	"casebrief/internal/problem"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+)
+
+// errorDomain is the domain of the ErrorInfo detail of errors
+const errorDomain = "orders-service"
+
+// statusCodes maps the HTTP status of problems to gRPC status codes
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.Aborted,
+	http.StatusPreconditionFailed:  codes.FailedPrecondition,
+	http.StatusUnprocessableEntity: codes.FailedPrecondition,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+}
+
+// problemStatus converts a problem to a gRPC status, so both APIs report
+// errors alike: the error code is the reason of an ErrorInfo detail, in upper
+// case, and invalid fields are listed in a BadRequest detail
+func problemStatus(p *problem.Problem) *status.Status {
+	code, ok := statusCodes[p.Status]
+	if !ok {
+		code = codes.Unknown
+		if p.Status >= http.StatusInternalServerError {
+			code = codes.Internal
+		}
+	}
+
+	st := status.New(code, p.Detail)
+	details := []protoiface.MessageV1{&errdetails.ErrorInfo{Reason: strings.ToUpper(p.Code), Domain: errorDomain}}
+	if len(p.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, fieldError := range p.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       fieldError.Field,
+				Description: fieldError.Message,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// problemError returns the gRPC status error of a problem
+func problemError(httpStatus int, code, detail string) error {
+	return problemStatus(problem.New(httpStatus, code, detail)).Err()
+}
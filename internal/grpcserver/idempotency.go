@@ -0,0 +1,190 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/middleware"
+	"casebrief/internal/problem"
+	"casebrief/internal/repository"
+	ordersv1 "casebrief/proto/orders/v1"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// idempotencyScheme is the endpoint scheme of idempotency keys used over gRPC;
+// the endpoint name is the full method. Keys of the REST API have the HTTP
+// method as scheme, so the same key is independent on both APIs.
+const idempotencyScheme = "grpc"
+
+// maxIdempotencyKeyLength matches the size of the idempotency_keys.key column
+const maxIdempotencyKeyLength = 255
+
+// idempotentMethods are the methods that require an idempotency key, with a
+// constructor of the response message they return
+var idempotentMethods = map[string]func() proto.Message{
+	ordersv1.OrdersService_CreateOrder_FullMethodName: func() proto.Message { return &ordersv1.Order{} },
+}
+
+// idempotency returns a unary interceptor giving the calls of
+// idempotentMethods the semantics of the REST API's Idempotency middleware:
+// the key of the idempotency-key metadata is reserved before the handler runs
+// and the response is stored and replayed for later calls with the same key.
+// Concurrent calls get ABORTED while the key is reserved, and calls with a
+// different request or caller get FAILED_PRECONDITION. Errors worth retrying
+// are not stored. Stored records hold the status code and the serialized
+// response message, or the serialized google.rpc.Status of an error.
+func idempotency(store middleware.IdempotencyStore, cfg middleware.IdempotencyConfig, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		newResponse, ok := idempotentMethods[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		key := metadataValue(ctx, idempotencyKeyMetadata)
+		if key == "" {
+			return nil, problemError(http.StatusBadRequest, problem.CodeIdempotencyKeyRequired, "The "+idempotencyKeyMetadata+" metadata is required")
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return nil, problemError(http.StatusBadRequest, problem.CodeIdempotencyKeyTooLong, fmt.Sprintf("The %s metadata must not be longer than %d characters", idempotencyKeyMetadata, maxIdempotencyKeyLength))
+		}
+
+		requestHash, err := requestFingerprint(ctx, req.(proto.Message))
+		if err != nil {
+			return nil, problemStatus(problem.FromError(err)).Err()
+		}
+		// The token identifies this call's reservation, so it cannot complete
+		// or release the key once another call took it over
+		token := uuid.New().String()
+		record, err := store.ReserveIdempotencyKey(ctx, info.FullMethod, idempotencyScheme, key, requestHash, token, cfg.LockTimeout)
+		if err != nil {
+			logger.Error("Failed to reserve idempotency key",
+				zap.Error(err),
+				zap.String("idempotency_key", key),
+			)
+			return nil, problemStatus(problem.FromError(err)).Err()
+		}
+
+		if record != nil {
+			switch {
+			case record.RequestHash != requestHash:
+				logger.Warn("Idempotency key reused with a different request",
+					zap.String("endpoint_name", info.FullMethod),
+					zap.String("endpoint_scheme", idempotencyScheme),
+					zap.String("idempotency_key", key),
+				)
+				return nil, problemError(http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused, "The idempotency key was already used for a different request")
+			case !record.Completed:
+				_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(cfg.RetryAfter.Seconds()))))
+				return nil, problemError(http.StatusConflict, problem.CodeIdempotencyKeyInProgress, "A request with the same idempotency key is in progress, retry later")
+			default:
+				logger.Info("Idempotent request detected, returning saved response",
+					zap.String("endpoint_name", info.FullMethod),
+					zap.String("endpoint_scheme", idempotencyScheme),
+					zap.String("idempotency_key", key),
+				)
+				_ = grpc.SetHeader(ctx, metadata.Pairs("idempotent-replayed", "true"))
+				return replayResponse(record.Response, newResponse())
+			}
+		}
+
+		resp, err := handler(ctx, req)
+
+		// The key is released or completed even if the client went away
+		ctx = context.WithoutCancel(ctx)
+		if isRetryableCode(status.Code(err)) {
+			if err := store.ReleaseIdempotencyKey(ctx, info.FullMethod, idempotencyScheme, key, token); err != nil {
+				logger.Warn("Failed to release idempotency key",
+					zap.Error(err),
+					zap.String("idempotency_key", key),
+				)
+			}
+			return resp, err
+		}
+
+		response, marshalErr := storedResponse(resp, err)
+		if marshalErr == nil {
+			marshalErr = store.CompleteIdempotencyKey(ctx, info.FullMethod, idempotencyScheme, key, token, response, cfg.Validity)
+		}
+		if marshalErr != nil {
+			logger.Warn("Failed to store idempotency response",
+				zap.Error(marshalErr),
+				zap.String("endpoint_name", info.FullMethod),
+				zap.String("endpoint_scheme", idempotencyScheme),
+				zap.String("idempotency_key", key),
+			)
+			// Don't fail the call; retries get ABORTED until the reservation
+			// expires, so the operation is not repeated in the meantime
+		}
+		return resp, err
+	}
+}
+
+// requestFingerprint returns the SHA-256 of the deterministically serialized
+// request, bound to the caller like the fingerprints of the REST API
+func requestFingerprint(ctx context.Context, req proto.Message) (string, error) {
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	if principal, ok := auth.FromContext(ctx); ok {
+		body = append([]byte(principal.Subject+"\x00"), body...)
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// storedResponse serializes the outcome of a call for replay
+func storedResponse(resp interface{}, err error) (*repository.IdempotencyResponse, error) {
+	var message proto.Message
+	if err != nil {
+		message = status.Convert(err).Proto()
+	} else {
+		message = resp.(proto.Message)
+	}
+	body, marshalErr := proto.Marshal(message)
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+	return &repository.IdempotencyResponse{StatusCode: int(status.Code(err)), Body: body}, nil
+}
+
+// replayResponse returns the stored outcome of a call, decoding a successful
+// response into resp
+func replayResponse(stored *repository.IdempotencyResponse, resp proto.Message) (interface{}, error) {
+	if codes.Code(stored.StatusCode) != codes.OK {
+		st := &spb.Status{}
+		if err := proto.Unmarshal(stored.Body, st); err != nil {
+			return nil, problemStatus(problem.FromError(err)).Err()
+		}
+		return nil, status.FromProto(st).Err()
+	}
+	if err := proto.Unmarshal(stored.Body, resp); err != nil {
+		return nil, problemStatus(problem.FromError(err)).Err()
+	}
+	return resp, nil
+}
+
+// isRetryableCode reports whether an error is transient, so it is not stored
+// and the call can be retried with the same key; the counterparts of the HTTP
+// statuses not stored by the REST API
+func isRetryableCode(code codes.Code) bool {
+	switch code {
+	case codes.Canceled, codes.Unknown, codes.DeadlineExceeded, codes.Aborted,
+		codes.ResourceExhausted, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
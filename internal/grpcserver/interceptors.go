@@ -0,0 +1,219 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/problem"
+	"casebrief/internal/tenant"
+	ordersv1 "casebrief/proto/orders/v1"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys, the counterparts of the REST API's headers
+const (
+	apiKeyMetadata         = "x-api-key"
+	authorizationMetadata  = "authorization"
+	tenantMetadata         = "x-tenant-id"
+	idempotencyKeyMetadata = "idempotency-key"
+)
+
+// bearerPrefix precedes the token in the authorization metadata
+const bearerPrefix = "Bearer "
+
+// methodScopes are the scopes required by the methods of OrdersService
+var methodScopes = map[string]string{
+	ordersv1.OrdersService_CreateOrder_FullMethodName: auth.ScopeOrdersWrite,
+	ordersv1.OrdersService_GetOrder_FullMethodName:    auth.ScopeOrdersRead,
+	ordersv1.OrdersService_ListOrders_FullMethodName:  auth.ScopeOrdersRead,
+	ordersv1.OrdersService_WatchOrders_FullMethodName: auth.ScopeOrdersRead,
+}
+
+// interceptor authenticates calls, resolves their tenant and logs them, for
+// unary and streaming calls alike. It applies the rules of the REST API's
+// Authenticate, RequireScope and Tenant middlewares to the metadata of the
+// call.
+type interceptor struct {
+	// authenticator authenticates callers; without one calls are anonymous
+	authenticator *auth.Authenticator
+	defaultTenant string
+	logger        *zap.Logger
+}
+
+// unary intercepts unary calls
+func (i *interceptor) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	start := time.Now()
+	defer func() { err = i.finish(ctx, info.FullMethod, start, recover(), err) }()
+
+	if ctx, err = i.prepare(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// stream intercepts streaming calls
+func (i *interceptor) stream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx := stream.Context()
+	start := time.Now()
+	defer func() { err = i.finish(ctx, info.FullMethod, start, recover(), err) }()
+
+	if ctx, err = i.prepare(ctx, info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+}
+
+// prepare attaches the principal and the tenant of a call to its context. It
+// returns the context prepared so far with the error rejecting the call.
+func (i *interceptor) prepare(ctx context.Context, method string) (context.Context, error) {
+	if i.authenticator != nil {
+		principal, err := i.authenticate(ctx, method)
+		if err != nil {
+			return ctx, err
+		}
+		ctx = auth.NewContext(ctx, principal)
+	}
+
+	tenantID, err := i.resolveTenant(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.id", tenantID))
+	return tenant.NewContext(ctx, tenantID), nil
+}
+
+// authenticate returns the caller of a call by the x-api-key metadata or a
+// JWT in the authorization metadata, and checks that it was granted the scope
+// of the method
+func (i *interceptor) authenticate(ctx context.Context, method string) (*auth.Principal, error) {
+	var (
+		principal *auth.Principal
+		err       error
+	)
+	if key := metadataValue(ctx, apiKeyMetadata); key != "" {
+		principal, err = i.authenticator.AuthenticateAPIKey(ctx, key)
+	} else if header := metadataValue(ctx, authorizationMetadata); len(header) > len(bearerPrefix) && strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		principal, err = i.authenticator.AuthenticateBearer(strings.TrimSpace(header[len(bearerPrefix):]))
+	} else {
+		return nil, problemError(http.StatusUnauthorized, problem.CodeUnauthorized, "Credentials are required, pass an API key in the "+apiKeyMetadata+" metadata or a bearer token")
+	}
+
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		i.logger.Warn("Authentication failed",
+			zap.Error(err),
+			zap.String("method", method),
+			zap.String("peer", peerAddress(ctx)),
+		)
+		return nil, problemError(http.StatusUnauthorized, problem.CodeUnauthorized, "The credentials are invalid, expired or revoked")
+	}
+	if err != nil {
+		i.logger.Error("Failed to authenticate call",
+			zap.Error(err),
+			zap.String("method", method),
+		)
+		return nil, problemStatus(problem.FromError(err)).Err()
+	}
+
+	scope, ok := methodScopes[method]
+	if !ok || !principal.HasScope(scope) {
+		return nil, problemError(http.StatusForbidden, problem.CodeInsufficientScope, "The "+scope+" scope is required")
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		semconv.EnduserID(principal.Subject),
+		semconv.EnduserScope(strings.Join(principal.Scopes, " ")),
+	)
+	return principal, nil
+}
+
+// resolveTenant returns the tenant of a call: the tenant the caller is bound
+// to, else the one of the x-tenant-id metadata, else the default tenant. Like
+// the Tenant middleware, it rejects callers neither bound to a tenant nor
+// granted the tenants:any scope.
+func (i *interceptor) resolveTenant(ctx context.Context) (string, error) {
+	id := metadataValue(ctx, tenantMetadata)
+	if id != "" && !tenant.Valid(id) {
+		return "", problemError(http.StatusBadRequest, problem.CodeInvalidTenant, "The "+tenantMetadata+" metadata is not a valid tenant ID")
+	}
+
+	if principal, ok := auth.FromContext(ctx); ok {
+		switch {
+		case principal.Tenant != "":
+			if id != "" && id != principal.Tenant {
+				return "", problemError(http.StatusForbidden, problem.CodeTenantForbidden, "The caller may not act on tenant "+id)
+			}
+			id = principal.Tenant
+		case !principal.HasScope(auth.ScopeAnyTenant):
+			return "", problemError(http.StatusForbidden, problem.CodeTenantForbidden, "The caller is not bound to a tenant and lacks the "+auth.ScopeAnyTenant+" scope")
+		}
+	}
+	if id == "" {
+		id = i.defaultTenant
+	}
+	if id == "" {
+		return "", problemError(http.StatusBadRequest, problem.CodeTenantRequired, "The "+tenantMetadata+" metadata is required")
+	}
+	return id, nil
+}
+
+// finish logs a call and turns a panic of its handler into an internal error
+func (i *interceptor) finish(ctx context.Context, method string, start time.Time, recovered interface{}, err error) error {
+	if recovered != nil {
+		i.logger.Error("Panic recovered",
+			zap.Any("error", recovered),
+			zap.String("method", method),
+		)
+		err = problemStatus(problem.FromError(fmt.Errorf("panic: %v", recovered))).Err()
+	}
+
+	fields := []zap.Field{
+		zap.String("code", status.Code(err).String()),
+		zap.String("method", method),
+		zap.String("peer", peerAddress(ctx)),
+		zap.Duration("latency", time.Since(start)),
+		zap.Time("timestamp", time.Now()),
+	}
+	i.logger.Info("gRPC Request", append(fields, auth.LogFields(ctx)...)...)
+	return err
+}
+
+// contextStream is a server stream with the context prepared by the
+// interceptor
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// metadataValue returns the first value of a metadata key of the call
+func metadataValue(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// peerAddress returns the address of the client of the call
+func peerAddress(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
@@ -0,0 +1,205 @@
+// Package grpcserver serves the orders.v1.OrdersService gRPC API, the
+// counterpart of the REST API for internal services, on top of the same order
+// service, authenticator and idempotency store.
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/middleware"
+	"casebrief/internal/problem"
+	"casebrief/internal/service"
+	ordersv1 "casebrief/proto/orders/v1"
+
+	"github.com/gin-gonic/gin/binding"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Config configures the gRPC server
+type Config struct {
+	// Authenticator authenticates callers; without one calls are anonymous
+	Authenticator *auth.Authenticator
+	// DefaultTenant is the tenant of calls from callers not bound to a tenant
+	// that send no x-tenant-id metadata
+	DefaultTenant string
+	// IdempotencyStore stores the idempotency keys of CreateOrder calls
+	IdempotencyStore middleware.IdempotencyStore
+	// Idempotency configures the validity and locking of idempotency keys
+	Idempotency middleware.IdempotencyConfig
+	// Tracing enables the spans of calls
+	Tracing bool
+}
+
+// Server serves OrdersService
+type Server struct {
+	server *grpc.Server
+	orders *ordersServer
+}
+
+// NewServer creates a gRPC server of OrdersService. If tracing is enabled,
+// calls are traced with the otelgrpc stats handler, so their spans continue
+// the trace of the client.
+func NewServer(orderService *service.OrderService, cfg Config, logger *zap.Logger) *Server {
+	calls := &interceptor{
+		authenticator: cfg.Authenticator,
+		defaultTenant: cfg.DefaultTenant,
+		logger:        logger,
+	}
+	orders := &ordersServer{
+		service:  orderService,
+		logger:   logger,
+		shutdown: make(chan struct{}),
+	}
+
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(calls.unary, idempotency(cfg.IdempotencyStore, cfg.Idempotency, logger)),
+		grpc.ChainStreamInterceptor(calls.stream),
+	}
+	if cfg.Tracing {
+		options = append(options, grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	}
+	server := grpc.NewServer(options...)
+	ordersv1.RegisterOrdersServiceServer(server, orders)
+
+	return &Server{server: server, orders: orders}
+}
+
+// Serve accepts connections on the listener until the server is shut down
+func (s *Server) Serve(listener net.Listener) error {
+	return s.server.Serve(listener)
+}
+
+// Shutdown ends the WatchOrders streams, so their clients watch again on
+// another replica, and stops the server once the calls in progress finished.
+// If ctx is done first, the remaining calls are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	close(s.orders.shutdown)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// ordersServer implements ordersv1.OrdersServiceServer
+type ordersServer struct {
+	ordersv1.UnimplementedOrdersServiceServer
+
+	service *service.OrderService
+	logger  *zap.Logger
+	// shutdown is closed when the server shuts down
+	shutdown chan struct{}
+}
+
+// fail returns the gRPC status error of err. Server errors are logged with msg
+// and recorded on the span; client errors are not failures of the service.
+func (s *ordersServer) fail(ctx context.Context, err error, msg string, fields ...zap.Field) error {
+	p := problem.FromError(err)
+	if p.Status >= http.StatusInternalServerError {
+		s.logger.Error(msg, append(fields, zap.Error(err))...)
+		span := trace.SpanFromContext(ctx)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return problemStatus(p).Err()
+}
+
+// CreateOrder implements ordersv1.OrdersServiceServer
+func (s *ordersServer) CreateOrder(ctx context.Context, req *ordersv1.CreateOrderRequest) (*ordersv1.Order, error) {
+	createReq, err := createOrderRequest(req)
+	if err != nil {
+		return nil, s.fail(ctx, err, "Invalid request")
+	}
+	if err := binding.Validator.ValidateStruct(createReq); err != nil {
+		return nil, problemStatus(problem.FromBindingError(err)).Err()
+	}
+
+	order, err := s.service.CreateOrder(ctx, createReq)
+	if err != nil {
+		return nil, s.fail(ctx, err, "Failed to create order")
+	}
+
+	s.logger.Info("Order created successfully", append([]zap.Field{
+		zap.String("order_id", order.ID),
+		zap.String("customer_id", order.CustomerID),
+	}, auth.LogFields(ctx)...)...)
+	return orderToProto(order), nil
+}
+
+// GetOrder implements ordersv1.OrdersServiceServer
+func (s *ordersServer) GetOrder(ctx context.Context, req *ordersv1.GetOrderRequest) (*ordersv1.Order, error) {
+	order, err := s.service.GetOrderByID(ctx, req.GetId())
+	if err != nil {
+		return nil, s.fail(ctx, err, "Failed to get order", zap.String("order_id", req.GetId()))
+	}
+	return orderToProto(order), nil
+}
+
+// ListOrders implements ordersv1.OrdersServiceServer
+func (s *ordersServer) ListOrders(ctx context.Context, req *ordersv1.ListOrdersRequest) (*ordersv1.ListOrdersResponse, error) {
+	listReq, err := listOrdersRequest(req)
+	if err != nil {
+		return nil, s.fail(ctx, err, "Invalid request")
+	}
+
+	resp, err := s.service.ListOrders(ctx, listReq)
+	if err != nil {
+		return nil, s.fail(ctx, err, "Failed to list orders")
+	}
+	return listOrdersResponse(resp), nil
+}
+
+// WatchOrders implements ordersv1.OrdersServiceServer
+func (s *ordersServer) WatchOrders(req *ordersv1.WatchOrdersRequest, stream ordersv1.OrdersService_WatchOrdersServer) error {
+	ctx := stream.Context()
+	changes, err := s.service.WatchOrders(ctx)
+	if err != nil {
+		return s.fail(ctx, err, "Failed to watch orders")
+	}
+	// Tell the client the watch started, so it knows which changes it sees
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.shutdown:
+			return problemError(http.StatusServiceUnavailable, problem.CodeShuttingDown, "The server is shutting down, watch again")
+		case change, ok := <-changes:
+			if !ok {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return problemError(http.StatusTooManyRequests, problem.CodeWatcherTooSlow, "The client did not keep up with the changes, watch again")
+			}
+			if req.GetCustomerId() != "" && change.Order.CustomerID != req.GetCustomerId() {
+				continue
+			}
+			if err := stream.Send(&ordersv1.OrderChange{
+				Type:  orderChangeTypes[change.Kind],
+				Order: orderToProto(change.Order),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/middleware"
+	"casebrief/internal/models"
+	"casebrief/internal/repository"
+	"casebrief/internal/service"
+	ordersv1 "casebrief/proto/orders/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// newTestClient serves OrdersService over an in-process bufconn listener on
+// a memory store, with API keys of the given scopes if keys is not nil
+func newTestClient(t *testing.T, keys map[string][]string) (ordersv1.OrdersServiceClient, *Server) {
+	t.Helper()
+
+	store := repository.NewMemoryStore()
+	cfg := Config{
+		DefaultTenant:    "default",
+		IdempotencyStore: store,
+		Idempotency:      middleware.IdempotencyConfig{Validity: time.Minute, LockTimeout: time.Minute, RetryAfter: time.Second},
+	}
+	if keys != nil {
+		for key, scopes := range keys {
+			require.NoError(t, store.CreateAPIKey(context.Background(), &models.APIKey{
+				Name:    key + "-client",
+				KeyHash: auth.HashAPIKey(key),
+				Scopes:  scopes,
+			}))
+		}
+		cfg.Authenticator = auth.NewAuthenticator(store, nil, auth.JWTConfig{})
+	}
+	server := NewServer(service.NewOrderService(store, nil, zap.NewNop()), cfg, zap.NewNop())
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.server.Stop() })
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return ordersv1.NewOrdersServiceClient(conn), server
+}
+
+func createRequest(customerID string) *ordersv1.CreateOrderRequest {
+	return &ordersv1.CreateOrderRequest{
+		CustomerId: customerID,
+		Items: []*ordersv1.CreateOrderItem{
+			{ProductId: "product-1", Quantity: 2, UnitPrice: "10.50"},
+			{ProductId: "product-2", Quantity: 1, UnitPrice: "4"},
+		},
+		Currency:  "EUR",
+		OrderTime: timestamppb.New(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)),
+	}
+}
+
+func withKey(ctx context.Context, idempotencyKey string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, idempotencyKeyMetadata, idempotencyKey)
+}
+
+// errorReason returns the reason of the ErrorInfo detail of an error
+func errorReason(t *testing.T, err error) string {
+	t.Helper()
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			assert.Equal(t, errorDomain, info.Domain)
+			return info.Reason
+		}
+	}
+	t.Fatalf("no ErrorInfo in %v", err)
+	return ""
+}
+
+// fieldViolations returns the fields of the BadRequest detail of an error
+func fieldViolations(err error) []string {
+	var fields []string
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, violation := range badRequest.FieldViolations {
+				fields = append(fields, violation.Field)
+			}
+		}
+	}
+	return fields
+}
+
+func TestServer_CreateGetAndList(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	ctx := context.Background()
+
+	created, err := client.CreateOrder(withKey(ctx, "key-1"), createRequest("customer-1"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.Id)
+	assert.Equal(t, "default", created.TenantId)
+	assert.Equal(t, "25.00", created.TotalPrice)
+	assert.Equal(t, "EUR", created.Currency)
+	require.Len(t, created.Items, 2)
+	assert.Equal(t, "21.00", created.Items[0].LineTotal)
+
+	got, err := client.GetOrder(ctx, &ordersv1.GetOrderRequest{Id: created.Id})
+	require.NoError(t, err)
+	assert.Equal(t, created.Id, got.Id)
+	assert.Equal(t, created.Version, got.Version)
+
+	_, err = client.CreateOrder(withKey(ctx, "key-2"), createRequest("customer-2"))
+	require.NoError(t, err)
+
+	page, err := client.ListOrders(ctx, &ordersv1.ListOrdersRequest{CustomerId: "customer-1", IncludeTotal: true})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, created.Id, page.Orders[0].Id)
+	require.NotNil(t, page.TotalCount)
+	assert.EqualValues(t, 1, *page.TotalCount)
+
+	page, err = client.ListOrders(ctx, &ordersv1.ListOrdersRequest{PageSize: 1})
+	require.NoError(t, err)
+	assert.Len(t, page.Orders, 1)
+	assert.NotEmpty(t, page.NextPageToken)
+}
+
+func TestServer_GetOrderNotFound(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+
+	_, err := client.GetOrder(context.Background(), &ordersv1.GetOrderRequest{Id: "00000000-0000-0000-0000-000000000000"})
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "ORDER_NOT_FOUND", errorReason(t, err))
+}
+
+func TestServer_CreateOrderValidation(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	ctx := withKey(context.Background(), "key-1")
+
+	req := createRequest("")
+	req.Items[1].UnitPrice = "four"
+	_, err := client.CreateOrder(ctx, req)
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "VALIDATION_FAILED", errorReason(t, err))
+	assert.Equal(t, []string{"items[1].unit_price"}, fieldViolations(err))
+
+	// Binding rules are checked once the request converts
+	_, err = client.CreateOrder(withKey(context.Background(), "key-2"), createRequest(""))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, []string{"customer_id"}, fieldViolations(err))
+
+	_, err = client.ListOrders(context.Background(), &ordersv1.ListOrdersRequest{PageSize: 101})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_CreateOrderIdempotency(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	ctx := context.Background()
+
+	_, err := client.CreateOrder(ctx, createRequest("customer-1"))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "IDEMPOTENCY_KEY_REQUIRED", errorReason(t, err))
+
+	first, err := client.CreateOrder(withKey(ctx, "key-1"), createRequest("customer-1"))
+	require.NoError(t, err)
+
+	var header metadata.MD
+	replayed, err := client.CreateOrder(withKey(ctx, "key-1"), createRequest("customer-1"), grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, first.Id, replayed.Id)
+	assert.Equal(t, []string{"true"}, header.Get("idempotent-replayed"))
+
+	_, err = client.CreateOrder(withKey(ctx, "key-1"), createRequest("customer-2"))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, "IDEMPOTENCY_KEY_REUSED", errorReason(t, err))
+
+	page, err := client.ListOrders(ctx, &ordersv1.ListOrdersRequest{})
+	require.NoError(t, err)
+	assert.Len(t, page.Orders, 1)
+}
+
+func TestServer_CreateOrderReplaysErrors(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	ctx := withKey(context.Background(), "key-1")
+	req := createRequest("customer-1")
+	req.Currency = "XXX"
+
+	_, err := client.CreateOrder(ctx, req)
+	require.Error(t, err)
+	code, reason := status.Code(err), errorReason(t, err)
+
+	var header metadata.MD
+	_, err = client.CreateOrder(ctx, req, grpc.Header(&header))
+	assert.Equal(t, code, status.Code(err))
+	assert.Equal(t, reason, errorReason(t, err))
+	assert.Equal(t, []string{"true"}, header.Get("idempotent-replayed"))
+}
+
+func TestServer_Authentication(t *testing.T) {
+	client, _ := newTestClient(t, map[string][]string{
+		"reader-key":  {auth.ScopeOrdersRead, auth.ScopeAnyTenant},
+		"writer-key":  {auth.ScopeOrdersRead, auth.ScopeOrdersWrite, auth.ScopeAnyTenant},
+		"unbound-key": {auth.ScopeOrdersRead},
+	})
+	ctx := context.Background()
+	as := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, apiKeyMetadata, key)
+	}
+
+	_, err := client.ListOrders(ctx, &ordersv1.ListOrdersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "UNAUTHORIZED", errorReason(t, err))
+
+	_, err = client.ListOrders(as("wrong-key"), &ordersv1.ListOrdersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.ListOrders(as("reader-key"), &ordersv1.ListOrdersRequest{})
+	assert.NoError(t, err)
+
+	// Callers not bound to a tenant need the tenants:any scope to act on one
+	_, err = client.ListOrders(as("unbound-key"), &ordersv1.ListOrdersRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, "TENANT_FORBIDDEN", errorReason(t, err))
+
+	// Rejected calls never reserve the idempotency key
+	_, err = client.CreateOrder(withKey(as("reader-key"), "key-1"), createRequest("customer-1"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, "INSUFFICIENT_SCOPE", errorReason(t, err))
+
+	_, err = client.CreateOrder(withKey(as("writer-key"), "key-1"), createRequest("customer-1"))
+	assert.NoError(t, err)
+
+	stream, err := client.WatchOrders(ctx, &ordersv1.WatchOrdersRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServer_Tenants(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	ctx := context.Background()
+	inTenant := func(id string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, tenantMetadata, id)
+	}
+
+	created, err := client.CreateOrder(withKey(inTenant("acme"), "key-1"), createRequest("customer-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", created.TenantId)
+
+	_, err = client.GetOrder(inTenant("acme"), &ordersv1.GetOrderRequest{Id: created.Id})
+	assert.NoError(t, err)
+	_, err = client.GetOrder(ctx, &ordersv1.GetOrderRequest{Id: created.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.ListOrders(inTenant("not a tenant"), &ordersv1.ListOrdersRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "INVALID_TENANT", errorReason(t, err))
+}
+
+func TestServer_WatchOrders(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchOrders(ctx, &ordersv1.WatchOrdersRequest{CustomerId: "customer-1"})
+	require.NoError(t, err)
+	// The header is sent once the watch started
+	_, err = stream.Header()
+	require.NoError(t, err)
+
+	_, err = client.CreateOrder(withKey(ctx, "key-1"), createRequest("customer-2"))
+	require.NoError(t, err)
+	_, err = client.CreateOrder(metadata.AppendToOutgoingContext(withKey(ctx, "key-1"), tenantMetadata, "acme"), createRequest("customer-1"))
+	require.NoError(t, err)
+	created, err := client.CreateOrder(withKey(ctx, "key-2"), createRequest("customer-1"))
+	require.NoError(t, err)
+
+	// Orders of other customers and tenants are not seen
+	change, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, ordersv1.OrderChange_TYPE_CREATED, change.Type)
+	assert.Equal(t, created.Id, change.Order.Id)
+}
+
+func TestServer_ShutdownEndsWatches(t *testing.T) {
+	client, server := newTestClient(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchOrders(ctx, &ordersv1.WatchOrdersRequest{})
+	require.NoError(t, err)
+	_, err = stream.Header()
+	require.NoError(t, err)
+
+	require.NoError(t, server.Shutdown(ctx))
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, "SHUTTING_DOWN", errorReason(t, err))
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"casebrief/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// orderETag returns the strong entity tag of an order: its quoted version,
+// which changes with every change of the order
+func orderETag(order *models.Order) string {
+	return `"` + strconv.FormatInt(order.Version, 10) + `"`
+}
+
+// parseETag returns the order version of an entity tag returned by orderETag.
+// Weak tags and lists of tags are not accepted: If-Match requires the strong
+// comparison of a single version.
+func parseETag(tag string) (int64, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 3 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	return version, err == nil && version > 0
+}
+
+// setValidators sets the ETag and Last-Modified headers of an order. Every
+// change of the order moves its updated_at along with its version, so both
+// validators change together; Last-Modified is merely less precise.
+func setValidators(c *gin.Context, order *models.Order) {
+	c.Header("ETag", orderETag(order))
+	c.Header("Last-Modified", order.UpdatedAt.UTC().Format(http.TimeFormat))
+}
+
+// notModified reports whether the conditional GET of an order can be answered
+// with 304 Not Modified. As specified by RFC 9110, If-None-Match uses the weak
+// comparison and takes precedence over If-Modified-Since, which is ignored if
+// it cannot be parsed.
+func notModified(r *http.Request, order *models.Order) bool {
+	if values := r.Header.Values("If-None-Match"); len(values) > 0 {
+		current := orderETag(order)
+		for _, tag := range strings.Split(strings.Join(values, ","), ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == current {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have a resolution of seconds
+	return !order.UpdatedAt.Truncate(time.Second).After(since)
+}
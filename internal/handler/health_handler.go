@@ -1,22 +1,69 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"casebrief/internal/events"
 
 	"github.com/gin-gonic/gin"
 )
 
+// readinessCheckTimeout bounds how long a single readiness check may take
+const readinessCheckTimeout = 2 * time.Second
+
+// Component statuses reported by /readyz
+const (
+	componentUp   = "up"
+	componentDown = "down"
+)
+
+// ReadinessCheck is a named dependency check run by /readyz
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// ComponentStatus is the result of a readiness check
+type ComponentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ReadinessResponse is the body returned by /readyz
+type ReadinessResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
 // HealthHandler handles health check requests
-type HealthHandler struct{}
+type HealthHandler struct {
+	checks       []ReadinessCheck
+	shuttingDown atomic.Bool
+}
+
+// NewHealthHandler creates a new health handler running the given checks on /readyz
+func NewHealthHandler(checks ...ReadinessCheck) *HealthHandler {
+	return &HealthHandler{
+		checks: checks,
+	}
+}
 
-// NewHealthHandler creates a new health handler
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{}
+// SetShuttingDown makes /readyz report not-ready, so load balancers stop
+// routing new requests before the server shuts down
+func (h *HealthHandler) SetShuttingDown() {
+	h.shuttingDown.Store(true)
 }
 
 // HealthCheck handles GET /healthz
 // @Summary Health check
-// @Description Returns the health status of the service
+// @Description Returns the health status of the service. Kept for compatibility, same as /livez.
 // @Tags health
 // @Produce json
 // @Success 200 {object} map[string]string
@@ -27,3 +74,111 @@ func (h *HealthHandler) HealthCheck(c *gin.Context) {
 	})
 }
 
+// Livez handles GET /livez
+// @Summary Liveness probe
+// @Description Returns 200 as long as the process is able to serve HTTP requests
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /livez [get]
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "alive",
+	})
+}
+
+// Readyz handles GET /readyz
+// @Summary Readiness probe
+// @Description Checks the dependencies of the service (database, event worker, event queue)
+// @Description and reports the status and latency of each. Returns 503 if any check fails
+// @Description or the service is shutting down.
+// @Tags health
+// @Produce json
+// @Success 200 {object} ReadinessResponse
+// @Failure 503 {object} ReadinessResponse
+// @Router /readyz [get]
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	if h.shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, ReadinessResponse{Status: "shutting_down"})
+		return
+	}
+
+	components := make(map[string]ComponentStatus, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check ReadinessCheck) {
+			defer wg.Done()
+			status := runCheck(c.Request.Context(), check)
+			mu.Lock()
+			components[check.Name] = status
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	resp := ReadinessResponse{Status: "ready", Components: components}
+	code := http.StatusOK
+	for _, component := range components {
+		if component.Status != componentUp {
+			resp.Status = "not_ready"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, resp)
+}
+
+// runCheck runs a readiness check with a timeout and measures its latency
+func runCheck(ctx context.Context, check ReadinessCheck) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	status := ComponentStatus{
+		Status:    componentUp,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Status = componentDown
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// DatabaseCheck pings the database
+func DatabaseCheck(db *sql.DB) ReadinessCheck {
+	return ReadinessCheck{
+		Name:  "database",
+		Check: db.PingContext,
+	}
+}
+
+// EventWorkerCheck fails if the event worker is not running or has not made
+// progress for longer than staleAfter
+func EventWorkerCheck(worker *events.Worker, staleAfter time.Duration) ReadinessCheck {
+	return ReadinessCheck{
+		Name: "event_worker",
+		Check: func(ctx context.Context) error {
+			return worker.Healthy(staleAfter)
+		},
+	}
+}
+
+// EventQueueCheck fails if the event queue is filled above maxFillRatio (0-1)
+func EventQueueCheck(eventChan chan *events.Envelope, maxFillRatio float64) ReadinessCheck {
+	return ReadinessCheck{
+		Name: "event_queue",
+		Check: func(ctx context.Context) error {
+			if cap(eventChan) == 0 {
+				return nil
+			}
+			ratio := float64(len(eventChan)) / float64(cap(eventChan))
+			if ratio > maxFillRatio {
+				return fmt.Errorf("event queue %.0f%% full (%d/%d)", ratio*100, len(eventChan), cap(eventChan))
+			}
+			return nil
+		},
+	}
+}
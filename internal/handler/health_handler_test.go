@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"casebrief/internal/events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHealthRouter(h *HealthHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/livez", h.Livez)
+	router.GET("/readyz", h.Readyz)
+	return router
+}
+
+func getReadyz(t *testing.T, router http.Handler) (int, ReadinessResponse) {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var resp ReadinessResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return rec.Code, resp
+}
+
+func staticCheck(name string, err error) ReadinessCheck {
+	return ReadinessCheck{
+		Name:  name,
+		Check: func(ctx context.Context) error { return err },
+	}
+}
+
+func TestReadyz_AllChecksUp(t *testing.T) {
+	router := newHealthRouter(NewHealthHandler(staticCheck("database", nil), staticCheck("event_worker", nil)))
+
+	code, resp := getReadyz(t, router)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", resp.Status)
+	require.Len(t, resp.Components, 2)
+	assert.Equal(t, "up", resp.Components["database"].Status)
+	assert.Equal(t, "up", resp.Components["event_worker"].Status)
+}
+
+func TestReadyz_FailingCheck(t *testing.T) {
+	router := newHealthRouter(NewHealthHandler(staticCheck("database", errors.New("connection refused")), staticCheck("event_worker", nil)))
+
+	code, resp := getReadyz(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not_ready", resp.Status)
+	assert.Equal(t, "down", resp.Components["database"].Status)
+	assert.Equal(t, "connection refused", resp.Components["database"].Error)
+	assert.Equal(t, "up", resp.Components["event_worker"].Status)
+}
+
+func TestReadyz_ShuttingDown(t *testing.T) {
+	h := NewHealthHandler(staticCheck("database", nil))
+	router := newHealthRouter(h)
+	h.SetShuttingDown()
+
+	code, resp := getReadyz(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "shutting_down", resp.Status)
+
+	// Liveness is not affected by the shutdown
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestEventQueueCheck(t *testing.T) {
+	eventChan := make(chan *events.Envelope, 4)
+	check := EventQueueCheck(eventChan, 0.5)
+
+	eventChan <- &events.Envelope{}
+	eventChan <- &events.Envelope{}
+	assert.NoError(t, check.Check(context.Background()))
+
+	eventChan <- &events.Envelope{}
+	assert.Error(t, check.Check(context.Background()))
+}
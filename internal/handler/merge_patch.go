@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"casebrief/internal/models"
+	"casebrief/internal/problem"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// mergePatchContentType is the media type of JSON merge patches (RFC 7396)
+const mergePatchContentType = "application/merge-patch+json"
+
+// patchableOrderFields are the fields of an order a merge patch may change
+var patchableOrderFields = map[string]bool{
+	"items":            true,
+	"shipping_address": true,
+}
+
+// patchOrder applies a JSON merge patch to the changeable part of an order,
+// see models.UpdateOrderRequest, and returns the validated result. It returns
+// a problem if the patch is not a JSON object, touches read-only fields or
+// results in an invalid order.
+func patchOrder(order *models.Order, patch []byte) (*models.UpdateOrderRequest, error) {
+	var patchDocument interface{}
+	if err := decodeJSON(patch, &patchDocument); err != nil {
+		return nil, problem.New(http.StatusBadRequest, problem.CodeMalformedRequest, err.Error())
+	}
+	patchObject, ok := patchDocument.(map[string]interface{})
+	if !ok {
+		return nil, problem.New(http.StatusBadRequest, problem.CodeMalformedRequest, "The merge patch must be a JSON object")
+	}
+
+	var readOnly []string
+	for name := range patchObject {
+		if !patchableOrderFields[name] {
+			readOnly = append(readOnly, name)
+		}
+	}
+	if len(readOnly) > 0 {
+		sort.Strings(readOnly)
+		p := problem.New(http.StatusBadRequest, problem.CodeValidationFailed, "The merge patch changes fields that cannot be changed")
+		for _, name := range readOnly {
+			p.Errors = append(p.Errors, problem.FieldError{Field: name, Code: "read_only", Message: "cannot be changed"})
+		}
+		return nil, p
+	}
+
+	current := &models.UpdateOrderRequest{
+		Items:           make([]models.CreateOrderItemRequest, 0, len(order.Items)),
+		ShippingAddress: order.ShippingAddress,
+	}
+	for _, item := range order.Items {
+		current.Items = append(current.Items, models.CreateOrderItemRequest{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+		})
+	}
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var target interface{}
+	if err := decodeJSON(currentJSON, &target); err != nil {
+		return nil, err
+	}
+
+	merged, err := json.Marshal(mergePatch(target, patchObject))
+	if err != nil {
+		return nil, err
+	}
+	req := &models.UpdateOrderRequest{}
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return nil, problem.FromBindingError(err)
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return nil, problem.FromBindingError(err)
+	}
+	return req, nil
+}
+
+// mergePatch applies a merge patch to a decoded JSON document as specified by
+// RFC 7396: objects are merged recursively, null removes a member and any
+// other value, arrays included, replaces the target
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// decodeJSON decodes a JSON document keeping numbers as json.Number, so
+// amounts are not rounded through float64
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The examples of RFC 7396, Appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		var target, patch interface{}
+		require.NoError(t, decodeJSON([]byte(tt.target), &target))
+		require.NoError(t, decodeJSON([]byte(tt.patch), &patch))
+
+		merged, err := json.Marshal(mergePatch(target, patch))
+		require.NoError(t, err)
+		assert.JSONEq(t, tt.want, string(merged), "%s merged with %s", tt.target, tt.patch)
+	}
+}
+
+func TestParseETag(t *testing.T) {
+	version, ok := parseETag(` "42" `)
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), version)
+
+	for _, tag := range []string{`42`, `W/"42"`, `"42", "43"`, `"0"`, `"abc"`, `*`, `""`} {
+		_, ok := parseETag(tag)
+		assert.False(t, ok, tag)
+	}
+}
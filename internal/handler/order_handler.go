@@ -1,17 +1,25 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 
+	"casebrief/internal/auth"
 	"casebrief/internal/models"
-	"casebrief/internal/repository"
+	"casebrief/internal/problem"
 	"casebrief/internal/service"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// tracerName is the instrumentation name of the handler spans
+const tracerName = "casebrief/internal/handler"
+
 // OrderHandler handles HTTP requests for orders
 type OrderHandler struct {
 	service *service.OrderService
@@ -26,20 +34,52 @@ func NewOrderHandler(service *service.OrderService, logger *zap.Logger) *OrderHa
 	}
 }
 
+// startSpan starts the span of a handler as a child of the request span. The
+// request span belongs to the otelgin middleware and must not be ended here.
+func startSpan(c *gin.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(c.Request.Context(), name)
+}
+
+// fail renders err as a problem. Server errors are logged with msg and
+// recorded on the span; client errors are not failures of the service.
+func (h *OrderHandler) fail(c *gin.Context, span trace.Span, err error, msg string, fields ...zap.Field) {
+	p := problem.FromError(err)
+	if p.Status >= http.StatusInternalServerError {
+		h.logger.Error(msg, append(fields, zap.Error(err))...)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	problem.Write(c, p)
+}
+
+// writeOrder renders an order with its ETag and Last-Modified headers
+func writeOrder(c *gin.Context, status int, order *models.Order) {
+	setValidators(c, order)
+	c.JSON(status, order)
+}
+
 // CreateOrder handles POST /orders
 // @Summary Create a new order
 // @Description Create a new order with idempotency support
 // @Tags orders
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string true "Idempotency key; repeating the request with the same key replays the original response"
 // @Param order body models.CreateOrderRequest true "Order creation request"
+// @Param X-Tenant-ID header string false "Tenant to act on; defaults to the caller's tenant or the default tenant"
 // @Success 201 {object} models.Order
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /orders [post]
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
-	ctx := c.Request.Context()
-	span := trace.SpanFromContext(ctx)
+	ctx, span := startSpan(c, "OrderHandler.CreateOrder")
 	defer span.End()
 
 	var req models.CreateOrderRequest
@@ -47,64 +87,314 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		h.logger.Warn("Invalid request body",
 			zap.Error(err),
 		)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		problem.Write(c, problem.FromBindingError(err))
 		return
 	}
 
-	// Extract endpoint name and scheme for idempotency
-	endpointName := c.Request.URL.Path // e.g., "/orders"
-	endpointScheme := c.Request.Method // e.g., "POST"
-
-	order, err := h.service.CreateOrder(ctx, endpointName, endpointScheme, &req)
+	order, err := h.service.CreateOrder(ctx, &req)
 	if err != nil {
-		h.logger.Error("Failed to create order",
-			zap.Error(err),
-		)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		h.fail(c, span, err, "Failed to create order")
 		return
 	}
 
-	h.logger.Info("Order created successfully",
+	h.logger.Info("Order created successfully", append([]zap.Field{
 		zap.String("order_id", order.ID),
 		zap.String("customer_id", order.CustomerID),
-	)
-	c.JSON(http.StatusCreated, order)
+	}, auth.LogFields(ctx)...)...)
+	writeOrder(c, http.StatusCreated, order)
 }
 
 // GetOrderByID handles GET /orders/{id}
 // @Summary Get order by ID
-// @Description Retrieve an order by its ID
+// @Description Retrieve an order by its ID. The ETag header holds the order's version, required by PATCH.
+// @Description Conditional requests with If-None-Match or If-Modified-Since are answered with 304 Not Modified if the order did not change.
 // @Tags orders
 // @Produce json
 // @Param id path string true "Order ID"
+// @Param X-Tenant-ID header string false "Tenant to act on; defaults to the caller's tenant or the default tenant"
+// @Param If-None-Match header string false "ETag of the cached order"
+// @Param If-Modified-Since header string false "Last-Modified of the cached order"
 // @Success 200 {object} models.Order
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 304 "The order did not change"
+// @Header 200,304 {string} ETag "Version of the order"
+// @Header 200,304 {string} Last-Modified "Time of the order's last change"
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /orders/{id} [get]
 func (h *OrderHandler) GetOrderByID(c *gin.Context) {
-	ctx := c.Request.Context()
-	span := trace.SpanFromContext(ctx)
+	ctx, span := startSpan(c, "OrderHandler.GetOrderByID")
 	defer span.End()
 
 	id := c.Param("id")
-	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+
+	order, err := h.service.GetOrderByID(ctx, id)
+	if err != nil {
+		h.fail(c, span, err, "Failed to get order", zap.String("order_id", id))
 		return
 	}
 
-	order, err := h.service.GetOrderByID(ctx, id)
+	// Clients may store the order but must revalidate it before reuse;
+	// shared caches must not, the order belongs to the caller's tenant
+	c.Header("Cache-Control", "private, no-cache")
+	if notModified(c.Request, order) {
+		setValidators(c, order)
+		c.Status(http.StatusNotModified)
+		return
+	}
+	writeOrder(c, http.StatusOK, order)
+}
+
+// UpdateOrder handles PATCH /orders/{id}
+// @Summary Update an order
+// @Description Change the items or the shipping address of an order with a JSON merge patch (RFC 7396):
+// @Description items replace all lines, shipping_address fields are merged and null removes the address.
+// @Description Items can be changed until the order is paid, the shipping address until it is shipped.
+// @Description If-Match must hold the ETag of the order version the patch is based on.
+// @Description Emits an OrderUpdated event listing the changed fields.
+// @Tags orders
+// @Accept application/merge-patch+json
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param If-Match header string true "ETag of the order version the patch is based on"
+// @Param Idempotency-Key header string false "Optional idempotency key; repeating the request with the same key replays the original response"
+// @Param patch body models.UpdateOrderRequest true "JSON merge patch of the order's items and shipping address"
+// @Param X-Tenant-ID header string false "Tenant to act on; defaults to the caller's tenant or the default tenant"
+// @Success 200 {object} models.Order
+// @Header 200 {string} ETag "Version of the updated order"
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 412 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 428 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orders/{id} [patch]
+func (h *OrderHandler) UpdateOrder(c *gin.Context) {
+	ctx, span := startSpan(c, "OrderHandler.UpdateOrder")
+	defer span.End()
+	id := c.Param("id")
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		problem.Write(c, problem.New(http.StatusPreconditionRequired, problem.CodePreconditionRequired, "The If-Match header with the ETag of the order is required"))
+		return
+	}
+	version, ok := parseETag(ifMatch)
+	if !ok {
+		problem.Write(c, problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed, "If-Match does not hold the ETag of a version of the order"))
+		return
+	}
+	if contentType := c.ContentType(); contentType != mergePatchContentType && contentType != binding.MIMEJSON {
+		problem.Write(c, problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, "The body must be a JSON merge patch ("+mergePatchContentType+")"))
+		return
+	}
+	patch, err := c.GetRawData()
 	if err != nil {
-		if err == repository.ErrOrderNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
-			return
+		problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeMalformedRequest, err.Error()))
+		return
+	}
+
+	// The patch is applied to the order as stored, not as cached
+	order, err := h.service.PatchOrder(ctx, id, version, func(current *models.Order) (*models.UpdateOrderRequest, error) {
+		req, err := patchOrder(current, patch)
+		if err != nil {
+			h.logger.Warn("Invalid merge patch",
+				zap.Error(err),
+				zap.String("order_id", id),
+			)
 		}
-		h.logger.Error("Failed to get order",
+		return req, err
+	})
+	if err != nil {
+		h.fail(c, span, err, "Failed to update order", zap.String("order_id", id))
+		return
+	}
+
+	writeOrder(c, http.StatusOK, order)
+}
+
+// TransitionOrder handles POST /orders/{id}/transitions
+// @Summary Change order status
+// @Description Move an order to a new status following the order lifecycle
+// @Description (created -> confirmed -> paid -> shipped -> delivered, with cancelled and refunded branches)
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param Idempotency-Key header string false "Optional idempotency key; repeating the request with the same key replays the original response"
+// @Param transition body models.TransitionOrderRequest true "Status transition request"
+// @Param X-Tenant-ID header string false "Tenant to act on; defaults to the caller's tenant or the default tenant"
+// @Success 200 {object} models.Order
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orders/{id}/transitions [post]
+func (h *OrderHandler) TransitionOrder(c *gin.Context) {
+	ctx, span := startSpan(c, "OrderHandler.TransitionOrder")
+	defer span.End()
+	id := c.Param("id")
+
+	var req models.TransitionOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("Invalid request body",
 			zap.Error(err),
-			zap.String("order_id", id),
 		)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve order"})
+		problem.Write(c, problem.FromBindingError(err))
+		return
+	}
+
+	order, err := h.service.TransitionOrder(ctx, id, &req)
+	if err != nil {
+		h.fail(c, span, err, "Failed to transition order", zap.String("order_id", id))
+		return
+	}
+
+	writeOrder(c, http.StatusOK, order)
+}
+
+// CancelOrder handles POST /orders/{id}/cancel
+// @Summary Cancel an order
+// @Description Cancel an order that has not been paid yet and emit an OrderCancelled event, with idempotency support
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param Idempotency-Key header string true "Idempotency key; repeating the request with the same key replays the original response"
+// @Param cancellation body models.CancelOrderRequest true "Order cancellation request"
+// @Param X-Tenant-ID header string false "Tenant to act on; defaults to the caller's tenant or the default tenant"
+// @Success 200 {object} models.Order
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orders/{id}/cancel [post]
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	ctx, span := startSpan(c, "OrderHandler.CancelOrder")
+	defer span.End()
+	id := c.Param("id")
+
+	var req models.CancelOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("Invalid request body",
+			zap.Error(err),
+		)
+		problem.Write(c, problem.FromBindingError(err))
+		return
+	}
+
+	order, err := h.service.CancelOrder(ctx, id, &req)
+	if err != nil {
+		h.fail(c, span, err, "Failed to cancel order", zap.String("order_id", id))
+		return
+	}
+
+	h.logger.Info("Order cancelled successfully", append([]zap.Field{
+		zap.String("order_id", order.ID),
+		zap.String("reason_code", req.ReasonCode),
+	}, auth.LogFields(ctx)...)...)
+	writeOrder(c, http.StatusOK, order)
+}
+
+// GetOrderStatusHistory handles GET /orders/{id}/transitions
+// @Summary Get order status history
+// @Description List the status transitions of an order, oldest first
+// @Tags orders
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param X-Tenant-ID header string false "Tenant to act on; defaults to the caller's tenant or the default tenant"
+// @Success 200 {array} models.OrderStatusChange
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orders/{id}/transitions [get]
+func (h *OrderHandler) GetOrderStatusHistory(c *gin.Context) {
+	ctx, span := startSpan(c, "OrderHandler.GetOrderStatusHistory")
+	defer span.End()
+	id := c.Param("id")
+
+	history, err := h.service.GetOrderStatusHistory(ctx, id)
+	if err != nil {
+		h.fail(c, span, err, "Failed to get order status history", zap.String("order_id", id))
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// ListOrders handles GET /orders
+// @Summary List orders
+// @Description List orders with cursor-based pagination and optional filters, newest first
+// @Tags orders
+// @Produce json
+// @Param customer_id query string false "Filter by customer ID"
+// @Param product_id query string false "Filter by product ID"
+// @Param status query string false "Filter by status"
+// @Param order_time_from query string false "Order time lower bound, inclusive (RFC3339)"
+// @Param order_time_to query string false "Order time upper bound, exclusive (RFC3339)"
+// @Param created_from query string false "Creation time lower bound, inclusive (RFC3339)"
+// @Param created_to query string false "Creation time upper bound, exclusive (RFC3339)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param limit query int false "Page size (1-100, default 20)"
+// @Param include_total query bool false "Include the total number of matching orders"
+// @Param X-Tenant-ID header string false "Tenant to act on; defaults to the caller's tenant or the default tenant"
+// @Success 200 {object} models.OrderListResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orders [get]
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	ctx, span := startSpan(c, "OrderHandler.ListOrders")
+	defer span.End()
+
+	var req models.ListOrdersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.logger.Warn("Invalid query parameters",
+			zap.Error(err),
+		)
+		problem.Write(c, problem.FromBindingError(err))
+		return
+	}
+
+	resp, err := h.service.ListOrders(ctx, &req)
+	if err != nil {
+		h.fail(c, span, err, "Failed to list orders")
 		return
 	}
 
-	c.JSON(http.StatusOK, order)
+	c.JSON(http.StatusOK, resp)
 }
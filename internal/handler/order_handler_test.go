@@ -0,0 +1,396 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"casebrief/internal/middleware"
+	"casebrief/internal/models"
+	"casebrief/internal/problem"
+	"casebrief/internal/repository"
+	"casebrief/internal/service"
+	"casebrief/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const createOrderBody = `{
+	"customer_id": "customer-1",
+	"items": [{"product_id": "product-1", "quantity": 2, "unit_price": 50.25}],
+	"currency": "EUR",
+	"order_time": "2024-01-01T00:00:00Z"
+}`
+
+func newTestRouter(store *repository.MemoryStore) *gin.Engine {
+	return newCachedTestRouter(store, nil)
+}
+
+// newCachedTestRouter is newTestRouter with an order cache
+func newCachedTestRouter(store *repository.MemoryStore, cache *service.OrderCache) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	orderHandler := NewOrderHandler(service.NewOrderService(store, cache, logger), logger)
+
+	router := gin.New()
+	router.Use(middleware.Tenant("default"))
+	router.Use(middleware.Idempotency(store, middleware.IdempotencyConfig{
+		Validity:    time.Minute,
+		LockTimeout: time.Minute,
+		RetryAfter:  time.Second,
+	}, logger))
+	router.POST("/orders", middleware.RequireIdempotencyKey(), orderHandler.CreateOrder)
+	router.GET("/orders/:id", orderHandler.GetOrderByID)
+	router.PATCH("/orders/:id", orderHandler.UpdateOrder)
+	return router
+}
+
+func postOrder(router http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCreateOrder_IdempotentReplay(t *testing.T) {
+	store := repository.NewMemoryStore()
+	router := newTestRouter(store)
+
+	first := postOrder(router, "key-1", createOrderBody)
+	require.Equal(t, http.StatusCreated, first.Code)
+	second := postOrder(router, "key-1", createOrderBody)
+	require.Equal(t, http.StatusCreated, second.Code)
+
+	var created, replayed models.Order
+	require.NoError(t, json.Unmarshal(first.Body.Bytes(), &created))
+	require.NoError(t, json.Unmarshal(second.Body.Bytes(), &replayed))
+	assert.Equal(t, created.ID, replayed.ID)
+	assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+
+	// Only one order and one event were written
+	count, err := store.CountOrders(tenant.NewContext(context.Background(), "default"), repository.OrderFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	outbox, err := store.ClaimOutboxEvents(context.Background(), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, outbox, 1)
+
+	// A different key creates a new order
+	third := postOrder(router, "key-2", createOrderBody)
+	require.Equal(t, http.StatusCreated, third.Code)
+	var other models.Order
+	require.NoError(t, json.Unmarshal(third.Body.Bytes(), &other))
+	assert.NotEqual(t, created.ID, other.ID)
+}
+
+func TestCreateOrder_RequiresIdempotencyKey(t *testing.T) {
+	router := newTestRouter(repository.NewMemoryStore())
+
+	rec := postOrder(router, "", createOrderBody)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCreateOrder_KeyReusedWithDifferentBody(t *testing.T) {
+	router := newTestRouter(repository.NewMemoryStore())
+
+	require.Equal(t, http.StatusCreated, postOrder(router, "key-1", createOrderBody).Code)
+	rec := postOrder(router, "key-1", strings.Replace(createOrderBody, `"quantity": 2`, `"quantity": 3`, 1))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestGetOrderByID_DoesNotEndRequestSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+
+	store := repository.NewMemoryStore()
+	router := newTestRouter(store)
+	created := postOrder(router, "key-1", createOrderBody)
+	require.Equal(t, http.StatusCreated, created.Code)
+	var order models.Order
+	require.NoError(t, json.Unmarshal(created.Body.Bytes(), &order))
+
+	// Stand-in for the span owned by the otelgin middleware
+	var requestSpan trace.Span
+	var recordingAfterHandler bool
+	spanRouter := gin.New()
+	spanRouter.Use(func(c *gin.Context) {
+		ctx, span := tp.Tracer("test").Start(c.Request.Context(), "GET /orders/:id")
+		requestSpan = span
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		recordingAfterHandler = span.IsRecording()
+		span.End()
+	})
+	spanRouter.Use(middleware.Tenant("default"))
+	spanRouter.GET("/orders/:id", NewOrderHandler(service.NewOrderService(store, nil, zap.NewNop()), zap.NewNop()).GetOrderByID)
+
+	rec := httptest.NewRecorder()
+	spanRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/"+order.ID, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	assert.True(t, recordingAfterHandler, "handler must not end the request span")
+	var handlerSpan sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "OrderHandler.GetOrderByID" {
+			handlerSpan = span
+		}
+	}
+	require.NotNil(t, handlerSpan)
+	assert.Equal(t, requestSpan.SpanContext().SpanID(), handlerSpan.Parent().SpanID())
+}
+
+func TestCreateOrder_ValidationProblem(t *testing.T) {
+	router := newTestRouter(repository.NewMemoryStore())
+
+	rec := postOrder(router, "key-1", `{"items": [{"product_id": "product-1", "quantity": 0}]}`)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeValidationFailed, p.Code)
+	assert.Equal(t, "/orders", p.Instance)
+	assert.Contains(t, p.Errors, problem.FieldError{Field: "items[0].quantity", Code: "required", Message: "is required"})
+	assert.Contains(t, p.Errors, problem.FieldError{Field: "customer_id", Code: "required", Message: "is required"})
+}
+
+func TestCreateOrder_EmptyItems(t *testing.T) {
+	router := newTestRouter(repository.NewMemoryStore())
+
+	rec := postOrder(router, "key-1", `{"customer_id": "customer-1", "items": [], "order_time": "2024-01-01T00:00:00Z"}`)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeValidationFailed, p.Code)
+	assert.Contains(t, p.Errors, problem.FieldError{Field: "items", Code: "min", Message: "must be at least 1"})
+}
+
+func TestCreateOrder_QuantityOutOfRange(t *testing.T) {
+	router := newTestRouter(repository.NewMemoryStore())
+
+	rec := postOrder(router, "key-1", `{
+		"customer_id": "customer-1",
+		"items": [{"product_id": "product-1", "quantity": 2147483648, "unit_price": 1}],
+		"order_time": "2024-01-01T00:00:00Z"
+	}`)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeValidationFailed, p.Code)
+	assert.Contains(t, p.Errors, problem.FieldError{Field: "items[0].quantity", Code: "max", Message: "must be at most 2147483647"})
+}
+
+func TestGetOrderByID_NotFoundProblem(t *testing.T) {
+	router := newTestRouter(repository.NewMemoryStore())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/missing", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeOrderNotFound, p.Code)
+}
+
+func doPatch(router http.Handler, id, ifMatch, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/orders/"+id, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUpdateOrder_MergePatch(t *testing.T) {
+	router := newTestRouter(repository.NewMemoryStore())
+	created := postOrder(router, "key-1", createOrderBody)
+	require.Equal(t, http.StatusCreated, created.Code)
+	var order models.Order
+	require.NoError(t, json.Unmarshal(created.Body.Bytes(), &order))
+
+	get := httptest.NewRecorder()
+	router.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/orders/"+order.ID, nil))
+	require.Equal(t, http.StatusOK, get.Code)
+	etag := get.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	rec := doPatch(router, order.ID, etag, "application/merge-patch+json", `{
+		"items": [{"product_id": "product-1", "quantity": 3, "unit_price": 50.25}],
+		"shipping_address": {"name": "Ada", "line1": "Main St 1", "postal_code": "1011", "city": "Budapest", "country": "HU"}
+	}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+	var updated models.Order
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &updated))
+	assert.Equal(t, 3, updated.Quantity)
+	assert.Equal(t, "150.75", updated.TotalPrice.String())
+	require.NotNil(t, updated.ShippingAddress)
+
+	// Nested objects are merged and null removes members
+	rec = doPatch(router, order.ID, `"2"`, "application/merge-patch+json", `{"shipping_address": {"line2": "Floor 2", "city": "Szeged"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &updated))
+	assert.Equal(t, models.ShippingAddress{Name: "Ada", Line1: "Main St 1", Line2: "Floor 2", PostalCode: "1011", City: "Szeged", Country: "HU"}, *updated.ShippingAddress)
+	assert.Len(t, updated.Items, 1)
+
+	rec = doPatch(router, order.ID, `"3"`, "application/json", `{"shipping_address": null}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var removed models.Order
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &removed))
+	assert.Nil(t, removed.ShippingAddress)
+	assert.Equal(t, int64(4), removed.Version)
+}
+
+func TestUpdateOrder_Preconditions(t *testing.T) {
+	router := newTestRouter(repository.NewMemoryStore())
+	created := postOrder(router, "key-1", createOrderBody)
+	require.Equal(t, http.StatusCreated, created.Code)
+	var order models.Order
+	require.NoError(t, json.Unmarshal(created.Body.Bytes(), &order))
+	patch := `{"items": [{"product_id": "product-1", "quantity": 1, "unit_price": 50.25}]}`
+
+	tests := map[string]struct {
+		ifMatch     string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		"missing If-Match":   {"", "application/merge-patch+json", patch, http.StatusPreconditionRequired, problem.CodePreconditionRequired},
+		"stale version":      {`"2"`, "application/merge-patch+json", patch, http.StatusPreconditionFailed, problem.CodePreconditionFailed},
+		"weak ETag":          {`W/"1"`, "application/merge-patch+json", patch, http.StatusPreconditionFailed, problem.CodePreconditionFailed},
+		"wrong content type": {`"1"`, "text/plain", patch, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType},
+		"not an object":      {`"1"`, "application/merge-patch+json", `[]`, http.StatusBadRequest, problem.CodeMalformedRequest},
+		"read-only field":    {`"1"`, "application/merge-patch+json", `{"status": "paid"}`, http.StatusBadRequest, problem.CodeValidationFailed},
+		"invalid result":     {`"1"`, "application/merge-patch+json", `{"items": []}`, http.StatusBadRequest, problem.CodeValidationFailed},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := doPatch(router, order.ID, tt.ifMatch, tt.contentType, tt.body)
+
+			assert.Equal(t, tt.status, rec.Code)
+			var p problem.Problem
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+			assert.Equal(t, tt.code, p.Code)
+		})
+	}
+
+	rec := doPatch(router, "missing", `"1"`, "application/merge-patch+json", patch)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUpdateOrder_PatchesStoredOrderNotCachedOne(t *testing.T) {
+	store := repository.NewMemoryStore()
+	router := newCachedTestRouter(store, service.NewOrderCache(10, time.Minute))
+	created := postOrder(router, "key-1", createOrderBody)
+	require.Equal(t, http.StatusCreated, created.Code)
+	var order models.Order
+	require.NoError(t, json.Unmarshal(created.Body.Bytes(), &order))
+
+	// Cache version 1, then change the order behind the cache's back, as
+	// another replica would
+	get := httptest.NewRecorder()
+	router.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/orders/"+order.ID, nil))
+	require.Equal(t, `"1"`, get.Header().Get("ETag"))
+	ctx := tenant.NewContext(context.Background(), "default")
+	changed := order
+	changed.Items = []models.OrderItem{{ProductID: "product-2", Quantity: 5, UnitPrice: order.Items[0].UnitPrice, LineTotal: order.Items[0].UnitPrice}}
+	_, err := store.UpdateOrder(ctx, &changed, 1, nil)
+	require.NoError(t, err)
+
+	rec := doPatch(router, order.ID, `"2"`, "application/merge-patch+json", `{"shipping_address": {"name": "Ada", "line1": "Main St 1", "postal_code": "1011", "city": "Budapest", "country": "HU"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var updated models.Order
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &updated))
+	assert.Equal(t, int64(3), updated.Version)
+	require.Len(t, updated.Items, 1)
+	assert.Equal(t, "product-2", updated.Items[0].ProductID)
+	assert.Equal(t, 5, updated.Items[0].Quantity)
+	require.NotNil(t, updated.ShippingAddress)
+}
+
+func TestGetOrderByID_ConditionalGet(t *testing.T) {
+	router := newTestRouter(repository.NewMemoryStore())
+	created := postOrder(router, "key-1", createOrderBody)
+	require.Equal(t, http.StatusCreated, created.Code)
+	var order models.Order
+	require.NoError(t, json.Unmarshal(created.Body.Bytes(), &order))
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orders/"+order.ID, nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	lastModified := rec.Header().Get("Last-Modified")
+	assert.Equal(t, order.UpdatedAt.UTC().Format(http.TimeFormat), lastModified)
+	assert.Equal(t, "private, no-cache", rec.Header().Get("Cache-Control"))
+
+	tests := map[string]struct {
+		header, value string
+		status        int
+	}{
+		"matching ETag":             {"If-None-Match", `"1"`, http.StatusNotModified},
+		"matching weak ETag":        {"If-None-Match", `W/"1"`, http.StatusNotModified},
+		"ETag in list":              {"If-None-Match", `"7", "1"`, http.StatusNotModified},
+		"any ETag":                  {"If-None-Match", `*`, http.StatusNotModified},
+		"other ETag":                {"If-None-Match", `"2"`, http.StatusOK},
+		"not modified since":        {"If-Modified-Since", lastModified, http.StatusNotModified},
+		"modified since":            {"If-Modified-Since", order.UpdatedAt.Add(-time.Hour).UTC().Format(http.TimeFormat), http.StatusOK},
+		"invalid If-Modified-Since": {"If-Modified-Since", "yesterday", http.StatusOK},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := get(tt.header, tt.value)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+			assert.Equal(t, lastModified, rec.Header().Get("Last-Modified"))
+			if tt.status == http.StatusNotModified {
+				assert.Empty(t, rec.Body.String())
+			}
+		})
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	req := httptest.NewRequest(http.MethodGet, "/orders/"+order.ID, nil)
+	req.Header.Set("If-None-Match", `"2"`)
+	req.Header.Set("If-Modified-Since", lastModified)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// A change of the order changes its ETag
+	patched := doPatch(router, order.ID, `"1"`, "application/merge-patch+json", `{"items": [{"product_id": "product-1", "quantity": 1, "unit_price": 50.25}]}`)
+	require.Equal(t, http.StatusOK, patched.Code)
+	assert.Equal(t, http.StatusOK, get("If-None-Match", `"1"`).Code)
+}
@@ -0,0 +1,198 @@
+package janitor
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Purge run results
+const (
+	resultPurged  = "purged"
+	resultSkipped = "skipped"
+	resultError   = "error"
+)
+
+var (
+	idempotencyKeysPurged = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "idempotency_keys_purged_total",
+		Help: "Number of expired idempotency keys deleted.",
+	})
+	outboxEventsPurged = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "outbox_events_purged_total",
+		Help: "Number of processed outbox events deleted after the retention period.",
+	})
+	idempotencyPurgeRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "idempotency_purge_runs_total",
+		Help: "Number of purge runs by result (purged, skipped when another replica holds the lock, error).",
+	}, []string{"result"})
+	idempotencyPurgeDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "idempotency_purge_duration_seconds",
+		Help:    "Duration of purge runs that acquired the lock.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// IdempotencyKeyStore is the idempotency key storage purged by the janitor.
+// Its purge lock also serializes the outbox purge.
+type IdempotencyKeyStore interface {
+	TryLockIdempotencyPurge(ctx context.Context) (unlock func(), acquired bool, err error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// OutboxEventStore is the outbox storage purged by the janitor
+type OutboxEventStore interface {
+	DeleteProcessedOutboxEvents(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// Janitor periodically deletes expired idempotency keys and the outbox events
+// processed longer than the retention period ago. Rows are deleted in bounded
+// batches to keep transactions short, and an advisory lock makes sure only one
+// replica purges at a time.
+type Janitor struct {
+	idempotencyKeys IdempotencyKeyStore
+	outbox          OutboxEventStore
+	interval        time.Duration
+	batchSize       int
+	maxBatches      int
+	outboxRetention time.Duration
+	logger          *zap.Logger
+	stopChan        chan struct{}
+}
+
+// NewJanitor creates a new janitor. Each run deletes at most maxBatches
+// batches of batchSize rows per table; the rest is left for the next run.
+// Processed outbox events are kept for outboxRetention, or forever if it is 0.
+func NewJanitor(idempotencyKeys IdempotencyKeyStore, outbox OutboxEventStore, interval time.Duration, batchSize, maxBatches int, outboxRetention time.Duration, logger *zap.Logger) *Janitor {
+	return &Janitor{
+		idempotencyKeys: idempotencyKeys,
+		outbox:          outbox,
+		interval:        interval,
+		batchSize:       batchSize,
+		maxBatches:      maxBatches,
+		outboxRetention: outboxRetention,
+		logger:          logger,
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// Start starts purging on every interval
+func (j *Janitor) Start(ctx context.Context) {
+	j.logger.Info("Janitor started",
+		zap.Duration("interval", j.interval),
+		zap.Int("batch_size", j.batchSize),
+		zap.Duration("outbox_retention", j.outboxRetention),
+	)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			j.purge(ctx)
+		case <-ctx.Done():
+			j.logger.Info("Janitor stopping due to context cancellation")
+			return
+		case <-j.stopChan:
+			j.logger.Info("Janitor stopping")
+			return
+		}
+	}
+}
+
+// Stop stops the janitor
+func (j *Janitor) Stop() {
+	close(j.stopChan)
+}
+
+// purge deletes expired keys and old outbox events if no other replica is
+// purging
+func (j *Janitor) purge(ctx context.Context) {
+	unlock, acquired, err := j.idempotencyKeys.TryLockIdempotencyPurge(ctx)
+	if err != nil {
+		idempotencyPurgeRuns.WithLabelValues(resultError).Inc()
+		j.logger.Error("Failed to acquire purge lock", zap.Error(err))
+		return
+	}
+	if !acquired {
+		idempotencyPurgeRuns.WithLabelValues(resultSkipped).Inc()
+		j.logger.Debug("Purges run on another instance")
+		return
+	}
+	defer unlock()
+
+	start := time.Now()
+	defer func() {
+		idempotencyPurgeDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	keys, err := j.deleteInBatches(ctx, func(limit int) (int64, error) {
+		deleted, err := j.idempotencyKeys.DeleteExpiredIdempotencyKeys(ctx, start, limit)
+		idempotencyKeysPurged.Add(float64(deleted))
+		return deleted, err
+	})
+	if err != nil {
+		idempotencyPurgeRuns.WithLabelValues(resultError).Inc()
+		j.logger.Error("Failed to purge expired idempotency keys",
+			zap.Error(err),
+			zap.Int64("purged", keys),
+		)
+		return
+	}
+
+	var events int64
+	if j.outboxRetention > 0 {
+		events, err = j.deleteInBatches(ctx, func(limit int) (int64, error) {
+			deleted, err := j.outbox.DeleteProcessedOutboxEvents(ctx, start.Add(-j.outboxRetention), limit)
+			outboxEventsPurged.Add(float64(deleted))
+			return deleted, err
+		})
+		if err != nil {
+			idempotencyPurgeRuns.WithLabelValues(resultError).Inc()
+			j.logger.Error("Failed to purge processed outbox events",
+				zap.Error(err),
+				zap.Int64("purged", events),
+			)
+			return
+		}
+	}
+
+	idempotencyPurgeRuns.WithLabelValues(resultPurged).Inc()
+	if keys > 0 || events > 0 {
+		j.logger.Info("Purged expired idempotency keys and processed outbox events",
+			zap.Int64("idempotency_keys", keys),
+			zap.Int64("outbox_events", events),
+			zap.Duration("duration", time.Since(start)),
+		)
+	}
+}
+
+// deleteInBatches calls deleteBatch until a batch deletes fewer than
+// batchSize rows, at most maxBatches times, and returns the rows deleted
+func (j *Janitor) deleteInBatches(ctx context.Context, deleteBatch func(limit int) (int64, error)) (int64, error) {
+	var purged int64
+	for batch := 0; batch < j.maxBatches; batch++ {
+		deleted, err := deleteBatch(j.batchSize)
+		purged += deleted
+		if err != nil {
+			return purged, err
+		}
+		if deleted < int64(j.batchSize) {
+			break
+		}
+
+		// Stop between batches when shutting down
+		select {
+		case <-ctx.Done():
+			return purged, nil
+		case <-j.stopChan:
+			return purged, nil
+		default:
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,93 @@
+package janitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeIdempotencyKeyStore struct {
+	expired  int64
+	locked   bool
+	unlocked bool
+	batches  int
+}
+
+func (s *fakeIdempotencyKeyStore) TryLockIdempotencyPurge(ctx context.Context) (func(), bool, error) {
+	if s.locked {
+		return nil, false, nil
+	}
+	return func() { s.unlocked = true }, true, nil
+}
+
+func (s *fakeIdempotencyKeyStore) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time, limit int) (int64, error) {
+	s.batches++
+	deleted := s.expired
+	if deleted > int64(limit) {
+		deleted = int64(limit)
+	}
+	s.expired -= deleted
+	return deleted, nil
+}
+
+type fakeOutboxEventStore struct {
+	before  time.Time
+	deleted int64
+}
+
+func (s *fakeOutboxEventStore) DeleteProcessedOutboxEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	s.before = before
+	s.deleted += 3
+	return 3, nil
+}
+
+func TestJanitor_PurgesInBoundedBatches(t *testing.T) {
+	store := &fakeIdempotencyKeyStore{expired: 25}
+	janitor := NewJanitor(store, &fakeOutboxEventStore{}, time.Minute, 10, 2, 0, zap.NewNop())
+	purgedBefore := testutil.ToFloat64(idempotencyKeysPurged)
+
+	janitor.purge(context.Background())
+
+	// Two batches of ten; the remaining rows are left for the next run
+	assert.Equal(t, 2, store.batches)
+	assert.Equal(t, int64(5), store.expired)
+	assert.True(t, store.unlocked)
+	assert.Equal(t, float64(20), testutil.ToFloat64(idempotencyKeysPurged)-purgedBefore)
+
+	janitor.purge(context.Background())
+
+	assert.Equal(t, 3, store.batches)
+	assert.Equal(t, int64(0), store.expired)
+}
+
+func TestJanitor_SkipsWhenLockedByAnotherInstance(t *testing.T) {
+	store := &fakeIdempotencyKeyStore{expired: 5, locked: true}
+	janitor := NewJanitor(store, &fakeOutboxEventStore{}, time.Minute, 10, 2, time.Hour, zap.NewNop())
+	skippedBefore := testutil.ToFloat64(idempotencyPurgeRuns.WithLabelValues(resultSkipped))
+
+	janitor.purge(context.Background())
+
+	assert.Equal(t, 0, store.batches)
+	assert.Equal(t, float64(1), testutil.ToFloat64(idempotencyPurgeRuns.WithLabelValues(resultSkipped))-skippedBefore)
+}
+
+func TestJanitor_PurgesProcessedOutboxEvents(t *testing.T) {
+	outbox := &fakeOutboxEventStore{}
+	janitor := NewJanitor(&fakeIdempotencyKeyStore{}, outbox, time.Minute, 10, 2, 24*time.Hour, zap.NewNop())
+	purgedBefore := testutil.ToFloat64(outboxEventsPurged)
+
+	janitor.purge(context.Background())
+
+	assert.Equal(t, int64(3), outbox.deleted)
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), outbox.before, time.Minute)
+	assert.Equal(t, float64(3), testutil.ToFloat64(outboxEventsPurged)-purgedBefore)
+
+	// Without retention processed events are kept
+	janitor = NewJanitor(&fakeIdempotencyKeyStore{}, outbox, time.Minute, 10, 2, 0, zap.NewNop())
+	janitor.purge(context.Background())
+	assert.Equal(t, int64(3), outbox.deleted)
+}
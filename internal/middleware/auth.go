@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/problem"
+
+	"github.com/gin-gonic/gin"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// APIKeyHeader is the request header carrying a static API key
+const APIKeyHeader = "X-API-Key"
+
+// bearerPrefix precedes the token in the Authorization header
+const bearerPrefix = "Bearer "
+
+// Authenticate returns a gin middleware that authenticates the caller by the
+// X-API-Key header or a JWT in the Authorization: Bearer header and attaches
+// the principal to the request context (see auth.FromContext). Requests
+// without valid credentials get 401 Unauthorized with a WWW-Authenticate
+// header.
+func Authenticate(authenticator *auth.Authenticator, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var (
+			principal *auth.Principal
+			err       error
+		)
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			principal, err = authenticator.AuthenticateAPIKey(ctx, key)
+		} else if header := c.GetHeader("Authorization"); len(header) > len(bearerPrefix) && strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+			principal, err = authenticator.AuthenticateBearer(strings.TrimSpace(header[len(bearerPrefix):]))
+		} else {
+			c.Header("WWW-Authenticate", `Bearer realm="orders-service"`)
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "Credentials are required, pass an API key in the "+APIKeyHeader+" header or a bearer token"))
+			return
+		}
+
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			logger.Warn("Authentication failed",
+				zap.Error(err),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("ip", c.ClientIP()),
+			)
+			c.Header("WWW-Authenticate", `Bearer realm="orders-service", error="invalid_token"`)
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "The credentials are invalid, expired or revoked"))
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to authenticate request",
+				zap.Error(err),
+				zap.String("path", c.Request.URL.Path),
+			)
+			problem.Error(c, err)
+			return
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(
+			semconv.EnduserID(principal.Subject),
+			semconv.EnduserScope(strings.Join(principal.Scopes, " ")),
+		)
+		c.Request = c.Request.WithContext(auth.NewContext(ctx, principal))
+		c.Next()
+	}
+}
+
+// RequireScope returns a gin middleware that rejects callers who were not
+// granted the scope with 403 Forbidden. It must run after Authenticate.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="orders-service"`)
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "Credentials are required, pass an API key in the "+APIKeyHeader+" header or a bearer token"))
+			return
+		}
+		if !principal.HasScope(scope) {
+			c.Header("WWW-Authenticate", `Bearer realm="orders-service", error="insufficient_scope", scope="`+scope+`"`)
+			problem.Write(c, problem.New(http.StatusForbidden, problem.CodeInsufficientScope, "The "+scope+" scope is required"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/models"
+	"casebrief/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// failingAPIKeyStore fails every lookup
+type failingAPIKeyStore struct{}
+
+func (failingAPIKeyStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	return nil, errors.New("connection refused")
+}
+
+// newAuthRouter serves GET /orders with the read scope and POST /orders with
+// the write scope, behind the idempotency middleware, answering with the caller
+func newAuthRouter(t *testing.T, keys map[string][]string) *gin.Engine {
+	t.Helper()
+
+	store := repository.NewMemoryStore()
+	for key, scopes := range keys {
+		require.NoError(t, store.CreateAPIKey(context.Background(), &models.APIKey{
+			Name:    key + "-client",
+			KeyHash: auth.HashAPIKey(key),
+			Scopes:  scopes,
+		}))
+	}
+	authenticator := auth.NewAuthenticator(store, nil, auth.JWTConfig{})
+
+	respond := func(c *gin.Context) {
+		principal, _ := auth.FromContext(c.Request.Context())
+		c.String(http.StatusOK, principal.Subject)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	read := router.Group("/orders", Authenticate(authenticator, zap.NewNop()), RequireScope(auth.ScopeOrdersRead))
+	write := router.Group("/orders", Authenticate(authenticator, zap.NewNop()), RequireScope(auth.ScopeOrdersWrite))
+	write.Use(Idempotency(newFakeIdempotencyStore(), IdempotencyConfig{Validity: time.Minute, LockTimeout: time.Minute, RetryAfter: time.Second}, zap.NewNop()))
+	read.GET("", respond)
+	write.POST("", respond)
+	return router
+}
+
+func doAuthRequest(router http.Handler, method string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/orders", strings.NewReader(`{}`))
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthenticate_APIKey(t *testing.T) {
+	router := newAuthRouter(t, map[string][]string{"reader-key": {auth.ScopeOrdersRead}})
+
+	rec := doAuthRequest(router, http.MethodGet, http.Header{APIKeyHeader: {"reader-key"}})
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "reader-key-client", rec.Body.String())
+}
+
+func TestAuthenticate_RejectsMissingAndInvalidCredentials(t *testing.T) {
+	router := newAuthRouter(t, map[string][]string{"reader-key": {auth.ScopeOrdersRead}})
+
+	for name, header := range map[string]http.Header{
+		"missing":         {},
+		"unknown api key": {APIKeyHeader: {"unknown-key"}},
+		"invalid bearer":  {"Authorization": {"Bearer not-a-token"}},
+		"basic":           {"Authorization": {"Basic dXNlcjpwYXNz"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := doAuthRequest(router, http.MethodGet, header)
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Bearer")
+			assert.Contains(t, rec.Body.String(), `"code":"unauthorized"`)
+		})
+	}
+}
+
+func TestAuthenticate_StoreFailureIsInternalError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/orders", Authenticate(auth.NewAuthenticator(failingAPIKeyStore{}, nil, auth.JWTConfig{}), zap.NewNop()), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	rec := doAuthRequest(router, http.MethodGet, http.Header{APIKeyHeader: {"some-key"}})
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestRequireScope_RejectsCallerWithoutScope(t *testing.T) {
+	router := newAuthRouter(t, map[string][]string{"reader-key": {auth.ScopeOrdersRead}})
+
+	rec := doAuthRequest(router, http.MethodPost, http.Header{APIKeyHeader: {"reader-key"}})
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+	assert.Contains(t, rec.Body.String(), `"code":"insufficient_scope"`)
+}
+
+func TestIdempotency_KeyIsNotReplayedToAnotherCaller(t *testing.T) {
+	router := newAuthRouter(t, map[string][]string{
+		"writer-key": {auth.ScopeOrdersWrite},
+		"other-key":  {auth.ScopeOrdersWrite},
+	})
+
+	first := doAuthRequest(router, http.MethodPost, http.Header{APIKeyHeader: {"writer-key"}, IdempotencyKeyHeader: {"key-1"}})
+	replay := doAuthRequest(router, http.MethodPost, http.Header{APIKeyHeader: {"writer-key"}, IdempotencyKeyHeader: {"key-1"}})
+	other := doAuthRequest(router, http.MethodPost, http.Header{APIKeyHeader: {"other-key"}, IdempotencyKeyHeader: {"key-1"}})
+
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "writer-key-client", replay.Body.String())
+	assert.Equal(t, "true", replay.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, http.StatusUnprocessableEntity, other.Code)
+	assert.NotContains(t, other.Body.String(), "writer-key-client")
+}
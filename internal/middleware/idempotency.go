@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/problem"
+	"casebrief/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// IdempotencyKeyHeader is the request header carrying the idempotency key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayedHeader marks responses replayed from a stored record
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// unstoredHeaders are not stored with a response nor replayed: the rate limit
+// headers describe the current request, set by the rate limiter running
+// before this middleware, and hop-by-hop headers the connection it came on
+var unstoredHeaders = []string{
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After",
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// maxIdempotencyKeyLength matches the size of the idempotency_keys.key column
+const maxIdempotencyKeyLength = 255
+
+// Idempotency lookup results
+const (
+	idempotencyHit      = "hit"
+	idempotencyMiss     = "miss"
+	idempotencyConflict = "conflict"
+	idempotencyMismatch = "mismatch"
+)
+
+var idempotencyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "idempotency_requests_total",
+	Help: "Number of requests with an idempotency key by result (hit when the stored response is replayed, miss when the request is processed, conflict while the key is in progress, mismatch when the key was used for a different request).",
+}, []string{"result"})
+
+// IdempotencyStore persists idempotency keys and the responses stored for them
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, requestHash, token string, lockTimeout time.Duration) (*repository.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, token string, response *repository.IdempotencyResponse, validityDuration time.Duration) error
+	ReleaseIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, token string) error
+}
+
+// IdempotencyConfig configures the idempotency middleware
+type IdempotencyConfig struct {
+	// Validity is how long a stored response is replayed for the same key
+	Validity time.Duration
+	// LockTimeout is how long a key stays reserved for a request in progress
+	LockTimeout time.Duration
+	// RetryAfter is the delay suggested to clients whose request is still in
+	// progress under the same key
+	RetryAfter time.Duration
+}
+
+// Idempotency returns a gin middleware that makes POST, PUT and PATCH requests
+// carrying an Idempotency-Key header idempotent. The key is reserved before the
+// handler runs and the response (status code, headers and body) is stored and
+// replayed for later requests with the same key on the same endpoint. Concurrent
+// requests get 409 Conflict with Retry-After while the key is reserved, and
+// requests with a different body get 422 Unprocessable Entity. Responses that
+// are worth retrying (5xx, 408, 409, 429) are not stored.
+func Idempotency(store IdempotencyStore, cfg IdempotencyConfig, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !isMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeIdempotencyKeyTooLong, fmt.Sprintf("The Idempotency-Key header must not be longer than %d characters", maxIdempotencyKeyLength)))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeMalformedRequest, "Failed to read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		endpointName := c.Request.URL.Path // e.g., "/orders"
+		endpointScheme := c.Request.Method // e.g., "POST"
+		requestHash := requestFingerprint(body)
+		if principal, ok := auth.FromContext(ctx); ok {
+			// Keys are not scoped per caller; binding the fingerprint to the
+			// caller makes another caller's use of a key a mismatch instead
+			// of replaying a response meant for someone else
+			requestHash = callerFingerprint(principal.Subject, requestHash)
+		}
+
+		// The token identifies this request's reservation, so it cannot
+		// complete or release the key once another request took it over
+		token := uuid.New().String()
+		record, err := store.ReserveIdempotencyKey(ctx, endpointName, endpointScheme, key, requestHash, token, cfg.LockTimeout)
+		if err != nil {
+			logger.Error("Failed to reserve idempotency key",
+				zap.Error(err),
+				zap.String("idempotency_key", key),
+			)
+			problem.Error(c, err)
+			return
+		}
+
+		if record != nil {
+			switch {
+			case record.RequestHash != requestHash:
+				logger.Warn("Idempotency key reused with a different request",
+					zap.String("endpoint_name", endpointName),
+					zap.String("endpoint_scheme", endpointScheme),
+					zap.String("idempotency_key", key),
+				)
+				idempotencyRequests.WithLabelValues(idempotencyMismatch).Inc()
+				problem.Write(c, problem.New(http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused, "The idempotency key was already used for a different request"))
+			case !record.Completed:
+				idempotencyRequests.WithLabelValues(idempotencyConflict).Inc()
+				c.Header("Retry-After", strconv.Itoa(int(cfg.RetryAfter.Seconds())))
+				problem.Write(c, problem.New(http.StatusConflict, problem.CodeIdempotencyKeyInProgress, "A request with the same idempotency key is in progress, retry later"))
+			default:
+				logger.Info("Idempotent request detected, returning saved response",
+					zap.String("endpoint_name", endpointName),
+					zap.String("endpoint_scheme", endpointScheme),
+					zap.String("idempotency_key", key),
+				)
+				idempotencyRequests.WithLabelValues(idempotencyHit).Inc()
+				replayResponse(c, record.Response)
+			}
+			return
+		}
+
+		idempotencyRequests.WithLabelValues(idempotencyMiss).Inc()
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The key is released or completed even if the client went away
+		ctx = context.WithoutCancel(ctx)
+		status := recorder.Status()
+		if isRetryableStatus(status) {
+			if err := store.ReleaseIdempotencyKey(ctx, endpointName, endpointScheme, key, token); err != nil {
+				logger.Warn("Failed to release idempotency key",
+					zap.Error(err),
+					zap.String("idempotency_key", key),
+				)
+			}
+			return
+		}
+
+		response := &repository.IdempotencyResponse{
+			StatusCode: status,
+			Header:     storedHeader(recorder.Header()),
+			Body:       recorder.body.Bytes(),
+		}
+		if err := store.CompleteIdempotencyKey(ctx, endpointName, endpointScheme, key, token, response, cfg.Validity); err != nil {
+			logger.Warn("Failed to store idempotency response",
+				zap.Error(err),
+				zap.String("endpoint_name", endpointName),
+				zap.String("endpoint_scheme", endpointScheme),
+				zap.String("idempotency_key", key),
+			)
+			// Don't fail the request; retries get 409 until the reservation
+			// expires, so the operation is not repeated in the meantime. If
+			// the reservation was lost, the request that took the key over
+			// stores its own response.
+		}
+	}
+}
+
+// RequireIdempotencyKey returns a gin middleware that rejects requests without
+// an Idempotency-Key header, for endpoints that must not be retried blindly
+func RequireIdempotencyKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(IdempotencyKeyHeader) == "" {
+			problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeIdempotencyKeyRequired, "The Idempotency-Key header is required"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// replayResponse writes a stored response
+func replayResponse(c *gin.Context, response *repository.IdempotencyResponse) {
+	header := c.Writer.Header()
+	for name, values := range storedHeader(response.Header) {
+		// Stored headers replace those set by earlier middleware
+		header.Del(name)
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+	c.Header(idempotentReplayedHeader, "true")
+	c.Status(response.StatusCode)
+	_, _ = c.Writer.Write(response.Body)
+	c.Abort()
+}
+
+// storedHeader returns a copy of the response header without unstoredHeaders
+func storedHeader(header http.Header) http.Header {
+	stored := header.Clone()
+	for _, name := range unstoredHeaders {
+		stored.Del(name)
+	}
+	return stored
+}
+
+// requestFingerprint returns the SHA-256 of the request body. JSON bodies are
+// canonicalized first (sorted keys, no insignificant whitespace), so formatting
+// and field order do not matter.
+func requestFingerprint(body []byte) string {
+	// Keep numbers as their exact text instead of converting them to float64
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err == nil && !decoder.More() {
+		if canonical, err := json.Marshal(value); err == nil {
+			body = canonical
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// callerFingerprint binds a request fingerprint to the caller
+func callerFingerprint(subject, requestHash string) string {
+	sum := sha256.Sum256([]byte(subject + "\x00" + requestHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// isMutatingMethod reports whether requests with the method change state
+func isMutatingMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+// isRetryableStatus reports whether a response is transient, so it is not
+// stored and the request can be retried with the same key
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= http.StatusInternalServerError
+}
+
+// responseRecorder captures the response body while writing it through
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write implements io.Writer
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements io.StringWriter
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
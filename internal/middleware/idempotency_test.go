@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"casebrief/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*repository.IdempotencyRecord
+}
+
+func newFakeIdempotencyStore() *fakeIdempotencyStore {
+	return &fakeIdempotencyStore{records: make(map[string]*repository.IdempotencyRecord)}
+}
+
+func (s *fakeIdempotencyStore) ReserveIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, requestHash, token string, lockTimeout time.Duration) (*repository.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := endpointScheme + " " + endpointName + " " + key
+	if record, ok := s.records[id]; ok {
+		return record, nil
+	}
+	s.records[id] = &repository.IdempotencyRecord{RequestHash: requestHash}
+	return nil, nil
+}
+
+func (s *fakeIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, token string, response *repository.IdempotencyResponse, validityDuration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.records[endpointScheme+" "+endpointName+" "+key]
+	record.Completed = true
+	record.Response = response
+	return nil
+}
+
+func (s *fakeIdempotencyStore) ReleaseIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, endpointScheme+" "+endpointName+" "+key)
+	return nil
+}
+
+func newIdempotentRouter(store IdempotencyStore, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Idempotency(store, IdempotencyConfig{Validity: time.Minute, LockTimeout: time.Minute, RetryAfter: time.Second}, zap.NewNop()))
+	router.POST("/orders", handler)
+	return router
+}
+
+func doRequest(router http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotency_ReplaysStoredResponse(t *testing.T) {
+	calls := 0
+	router := newIdempotentRouter(newFakeIdempotencyStore(), func(c *gin.Context) {
+		calls++
+		c.Header("Location", "/orders/order-1")
+		c.JSON(http.StatusCreated, gin.H{"id": "order-1"})
+	})
+	hitsBefore := testutil.ToFloat64(idempotencyRequests.WithLabelValues(idempotencyHit))
+	missesBefore := testutil.ToFloat64(idempotencyRequests.WithLabelValues(idempotencyMiss))
+
+	first := doRequest(router, "key-1", `{"customer_id": "customer-1", "quantity": 1}`)
+	// Same body with different formatting and field order
+	second := doRequest(router, "key-1", `{"quantity":1,"customer_id":"customer-1"}`)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "/orders/order-1", second.Header().Get("Location"))
+	assert.Equal(t, "true", second.Header().Get(idempotentReplayedHeader))
+	assert.Empty(t, first.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, float64(1), testutil.ToFloat64(idempotencyRequests.WithLabelValues(idempotencyHit))-hitsBefore)
+	assert.Equal(t, float64(1), testutil.ToFloat64(idempotencyRequests.WithLabelValues(idempotencyMiss))-missesBefore)
+}
+
+func TestIdempotency_ReplaysCurrentRateLimitHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	remaining := 10
+	// Stands in for the rate limiter, which runs before the middleware
+	router.Use(func(c *gin.Context) {
+		remaining--
+		c.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+	})
+	router.Use(Idempotency(newFakeIdempotencyStore(), IdempotencyConfig{Validity: time.Minute, LockTimeout: time.Minute, RetryAfter: time.Second}, zap.NewNop()))
+	router.POST("/orders", func(c *gin.Context) {
+		c.Header("Location", "/orders/order-1")
+		c.JSON(http.StatusCreated, gin.H{"id": "order-1"})
+	})
+
+	doRequest(router, "key-1", `{}`)
+	second := doRequest(router, "key-1", `{}`)
+
+	assert.Equal(t, "true", second.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, []string{"8"}, second.Header().Values("RateLimit-Remaining"))
+	assert.Equal(t, []string{"/orders/order-1"}, second.Header().Values("Location"))
+	assert.Equal(t, []string{"application/json; charset=utf-8"}, second.Header().Values("Content-Type"))
+}
+
+func TestIdempotency_RejectsDifferentRequest(t *testing.T) {
+	router := newIdempotentRouter(newFakeIdempotencyStore(), func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"id": "order-1"})
+	})
+
+	doRequest(router, "key-1", `{"quantity": 1}`)
+	rec := doRequest(router, "key-1", `{"quantity": 2}`)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestIdempotency_RejectsConcurrentRequest(t *testing.T) {
+	store := newFakeIdempotencyStore()
+	router := newIdempotentRouter(store, func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"id": "order-1"})
+	})
+
+	// A reservation without a response belongs to a request in progress
+	_, _ = store.ReserveIdempotencyKey(context.Background(), "/orders", http.MethodPost, "key-1", requestFingerprint([]byte(`{}`)), "token", time.Minute)
+	rec := doRequest(router, "key-1", `{}`)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+}
+
+func TestIdempotency_ReleasesKeyOnServerError(t *testing.T) {
+	calls := 0
+	router := newIdempotentRouter(newFakeIdempotencyStore(), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "boom"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": "order-1"})
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, doRequest(router, "key-1", `{}`).Code)
+	assert.Equal(t, http.StatusCreated, doRequest(router, "key-1", `{}`).Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotency_PassesThroughWithoutKey(t *testing.T) {
+	calls := 0
+	router := newIdempotentRouter(newFakeIdempotencyStore(), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{"id": "order-1"})
+	})
+
+	doRequest(router, "", `{}`)
+	doRequest(router, "", `{}`)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	hash := requestFingerprint([]byte(`{"customer_id": "customer-1", "items": [{"unit_price": 9.99}]}`))
+	assert.Len(t, hash, 64)
+
+	assert.Equal(t, hash, requestFingerprint([]byte(`{"items":[{"unit_price":9.99}],"customer_id":"customer-1"}`)))
+	assert.NotEqual(t, hash, requestFingerprint([]byte(`{"customer_id": "customer-1", "items": [{"unit_price": 9.990000000000001}]}`)))
+
+	// Bodies that are not JSON are hashed as they are
+	assert.NotEqual(t, requestFingerprint([]byte("a")), requestFingerprint([]byte("b")))
+}
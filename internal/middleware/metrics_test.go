@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_CountsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Metrics())
+	router.GET("/orders/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	found := httpRequests.WithLabelValues(http.MethodGet, "/orders/:id", "204")
+	unmatched := httpRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")
+	foundBefore := testutil.ToFloat64(found)
+	unmatchedBefore := testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/orders/1", "/orders/2", "/unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(found)-foundBefore)
+	assert.Equal(t, float64(1), testutil.ToFloat64(unmatched)-unmatchedBefore)
+}
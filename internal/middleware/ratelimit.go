@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/problem"
+	"casebrief/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Rate limit results
+const (
+	rateLimitAllowed = "allowed"
+	rateLimitLimited = "limited"
+	rateLimitError   = "error"
+)
+
+var rateLimitRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rate_limit_requests_total",
+	Help: "Number of rate limited requests by route and result (allowed, limited when answered with 429, error when the store failed and the request was let through).",
+}, []string{"route", "result"})
+
+// RateLimit returns a gin middleware that limits the requests of every client
+// per route with the token buckets of the policy. Clients are identified by
+// the authenticated caller, or the client IP for anonymous requests, so it
+// must run after Authenticate. Responses carry RateLimit-Limit,
+// RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers; requests
+// over the limit get 429 Too Many Requests with Retry-After. If the store
+// fails, requests are let through.
+func RateLimit(store ratelimit.Store, policy ratelimit.Policy, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		limit := policy.LimitFor(c.Request.Method, route)
+		if limit.IsZero() {
+			c.Next()
+			return
+		}
+
+		client := "ip:" + c.ClientIP()
+		if principal, ok := auth.FromContext(c.Request.Context()); ok {
+			client = principal.Method + ":" + principal.Subject
+		}
+
+		result, err := store.Take(c.Request.Context(), c.Request.Method+" "+route+" "+client, limit)
+		if err != nil {
+			logger.Warn("Failed to check rate limit, request let through",
+				zap.Error(err),
+				zap.String("route", route),
+			)
+			rateLimitRequests.WithLabelValues(route, rateLimitError).Inc()
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Period)))
+
+		if !result.Allowed {
+			logger.Info("Rate limit exceeded",
+				zap.String("route", route),
+				zap.String("client", client),
+			)
+			rateLimitRequests.WithLabelValues(route, rateLimitLimited).Inc()
+			retryAfter := ceilSeconds(result.RetryAfter)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			problem.Write(c, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, fmt.Sprintf("Rate limit of %d requests per %s exceeded, retry in %d seconds", limit.Requests, limit.Period, retryAfter)))
+			return
+		}
+
+		rateLimitRequests.WithLabelValues(route, rateLimitAllowed).Inc()
+		c.Next()
+	}
+}
+
+// ceilSeconds rounds a duration up to whole seconds, at least 1 for positive
+// durations, as used in the rate limit headers
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// failingRateLimitStore fails every request
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func newRateLimitedRouter(store ratelimit.Store) *gin.Engine {
+	policy := ratelimit.Policy{
+		Default: ratelimit.Limit{Requests: 100, Period: time.Minute},
+		Routes:  map[string]ratelimit.Limit{"POST /orders": {Requests: 2, Period: time.Minute}},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// Stands in for Authenticate
+	router.Use(func(c *gin.Context) {
+		if caller := c.GetHeader("X-Caller"); caller != "" {
+			c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), &auth.Principal{Subject: caller, Method: auth.MethodAPIKey}))
+		}
+	})
+	router.Use(RateLimit(store, policy, zap.NewNop()))
+	router.POST("/orders", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	router.GET("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func doRateLimitedRequest(router http.Handler, method, caller string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/orders", nil)
+	if caller != "" {
+		req.Header.Set("X-Caller", caller)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimit_RejectsRequestsOverTheLimit(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.NewMemoryStore())
+	limited := rateLimitRequests.WithLabelValues("/orders", rateLimitLimited)
+	limitedBefore := testutil.ToFloat64(limited)
+
+	first := doRateLimitedRequest(router, http.MethodPost, "checkout")
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "2", first.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", first.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", first.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", first.Header().Get("RateLimit-Policy"))
+
+	assert.Equal(t, http.StatusCreated, doRateLimitedRequest(router, http.MethodPost, "checkout").Code)
+
+	rec := doRateLimitedRequest(router, http.MethodPost, "checkout")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), `"code":"rate_limited"`)
+	assert.Equal(t, float64(1), testutil.ToFloat64(limited)-limitedBefore)
+}
+
+func TestRateLimit_LimitsPerClientAndRoute(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.NewMemoryStore())
+
+	for i := 0; i < 2; i++ {
+		doRateLimitedRequest(router, http.MethodPost, "checkout")
+	}
+
+	// Other callers, anonymous clients and other routes have their own buckets
+	assert.Equal(t, http.StatusCreated, doRateLimitedRequest(router, http.MethodPost, "billing").Code)
+	assert.Equal(t, http.StatusCreated, doRateLimitedRequest(router, http.MethodPost, "").Code)
+	rec := doRateLimitedRequest(router, http.MethodGet, "checkout")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "100", rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimit_LetsRequestsThroughWhenStoreFails(t *testing.T) {
+	router := newRateLimitedRouter(failingRateLimitStore{})
+
+	rec := doRateLimitedRequest(router, http.MethodPost, "checkout")
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimit_IgnoresForwardedForFromUntrustedClients(t *testing.T) {
+	doForwardedRequest := func(router http.Handler, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Without trusted proxies a spoofed X-Forwarded-For does not change the
+	// bucket of the client
+	router := newRateLimitedRouter(ratelimit.NewMemoryStore())
+	assert.NoError(t, router.SetTrustedProxies(nil))
+	assert.Equal(t, http.StatusCreated, doForwardedRequest(router, "203.0.113.1"))
+	assert.Equal(t, http.StatusCreated, doForwardedRequest(router, "203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, doForwardedRequest(router, "203.0.113.3"))
+
+	// Behind a trusted proxy, the forwarded client IP identifies the client
+	router = newRateLimitedRouter(ratelimit.NewMemoryStore())
+	assert.NoError(t, router.SetTrustedProxies([]string{"192.0.2.0/24"}))
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusCreated, doForwardedRequest(router, "203.0.113.1"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, doForwardedRequest(router, "203.0.113.1"))
+	assert.Equal(t, http.StatusCreated, doForwardedRequest(router, "203.0.113.2"))
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/problem"
+	"casebrief/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tenant returns a gin middleware that resolves the tenant of the request and
+// attaches it to the request context (see tenant.FromContext), where the
+// repositories scope every query by it. Callers bound to a tenant act on their
+// tenant; an X-Tenant-ID header naming another tenant is rejected with 403.
+// Callers granted the tenants:any scope, and anonymous requests if
+// authentication is disabled, select the tenant with the X-Tenant-ID header, or
+// act on defaultTenant without it. Without a default tenant the header is
+// required. Other callers are rejected with 403. It must run after
+// Authenticate.
+func Tenant(defaultTenant string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(tenant.Header)
+		if id != "" && !tenant.Valid(id) {
+			problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeInvalidTenant, "The "+tenant.Header+" header is not a valid tenant ID"))
+			return
+		}
+
+		if principal, ok := auth.FromContext(c.Request.Context()); ok {
+			switch {
+			case principal.Tenant != "":
+				if id != "" && id != principal.Tenant {
+					problem.Write(c, problem.New(http.StatusForbidden, problem.CodeTenantForbidden, "The caller may not act on tenant "+id))
+					return
+				}
+				id = principal.Tenant
+			case !principal.HasScope(auth.ScopeAnyTenant):
+				problem.Write(c, problem.New(http.StatusForbidden, problem.CodeTenantForbidden, "The caller is not bound to a tenant and lacks the "+auth.ScopeAnyTenant+" scope"))
+				return
+			}
+		}
+		if id == "" {
+			id = defaultTenant
+		}
+		if id == "" {
+			problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeTenantRequired, "The "+tenant.Header+" header is required"))
+			return
+		}
+
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("tenant.id", id))
+		c.Request = c.Request.WithContext(tenant.NewContext(c.Request.Context(), id))
+		c.Next()
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"casebrief/internal/auth"
+	"casebrief/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTenantRouter answers GET /orders with the tenant of the request
+func newTenantRouter(defaultTenant string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// Stands in for Authenticate; X-Bound-Tenant binds the caller to a tenant,
+	// X-Scope grants it a scope
+	router.Use(func(c *gin.Context) {
+		bound, scope := c.GetHeader("X-Bound-Tenant"), c.GetHeader("X-Scope")
+		if bound != "" || scope != "" {
+			c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), &auth.Principal{Subject: "checkout", Method: auth.MethodAPIKey, Scopes: []string{scope}, Tenant: bound}))
+		}
+	})
+	router.Use(Tenant(defaultTenant))
+	router.GET("/orders", func(c *gin.Context) {
+		id, _ := tenant.FromContext(c.Request.Context())
+		c.String(http.StatusOK, id)
+	})
+	return router
+}
+
+func doTenantRequest(router http.Handler, bound, header string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	if bound != "" {
+		req.Header.Set("X-Bound-Tenant", bound)
+	}
+	if header != "" {
+		req.Header.Set(tenant.Header, header)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTenant_ResolvesTenant(t *testing.T) {
+	router := newTenantRouter("default")
+
+	tests := map[string]struct {
+		bound, header, want string
+	}{
+		"default":             {want: "default"},
+		"header":              {header: "acme", want: "acme"},
+		"bound caller":        {bound: "globex", want: "globex"},
+		"bound caller header": {bound: "globex", header: "globex", want: "globex"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := doTenantRequest(router, tt.bound, tt.header)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.want, rec.Body.String())
+		})
+	}
+}
+
+func TestTenant_RejectsOtherTenantOfBoundCaller(t *testing.T) {
+	rec := doTenantRequest(newTenantRouter("default"), "globex", "acme")
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"tenant_forbidden"`)
+}
+
+func TestTenant_RejectsInvalidAndMissingTenant(t *testing.T) {
+	rec := doTenantRequest(newTenantRouter("default"), "", "acme corp")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"invalid_tenant"`)
+
+	rec = doTenantRequest(newTenantRouter(""), "", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"tenant_required"`)
+}
+
+func TestTenant_RequiresScopeOfUnboundCaller(t *testing.T) {
+	router := newTenantRouter("default")
+	do := func(scope, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set("X-Scope", scope)
+		if header != "" {
+			req.Header.Set(tenant.Header, header)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Without the scope, neither a tenant of its choice nor the default one
+	for _, header := range []string{"acme", ""} {
+		rec := do(auth.ScopeOrdersRead, header)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"code":"tenant_forbidden"`)
+	}
+
+	rec := do(auth.ScopeAnyTenant, "acme")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "acme", rec.Body.String())
+	rec = do(auth.ScopeAnyTenant, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "default", rec.Body.String())
+}
@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"fmt"
 	"time"
 
+	"casebrief/internal/auth"
+	"casebrief/internal/problem"
+
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -21,7 +25,7 @@ func ZapLogger(logger *zap.Logger) gin.HandlerFunc {
 		latency := time.Since(start)
 		end := time.Now()
 
-		logger.Info("HTTP Request",
+		fields := []zap.Field{
 			zap.Int("status", c.Writer.Status()),
 			zap.String("method", c.Request.Method),
 			zap.String("path", path),
@@ -31,7 +35,11 @@ func ZapLogger(logger *zap.Logger) gin.HandlerFunc {
 			zap.Duration("latency", latency),
 			zap.Time("timestamp", end),
 			zap.Int("body_size", c.Writer.Size()),
-		)
+		}
+		// The authentication middleware replaces the request with one whose
+		// context carries the caller
+		fields = append(fields, auth.LogFields(c.Request.Context())...)
+		logger.Info("HTTP Request", fields...)
 	}
 }
 
@@ -43,7 +51,7 @@ func ZapRecovery(logger *zap.Logger) gin.HandlerFunc {
 			zap.String("path", c.Request.URL.Path),
 			zap.String("method", c.Request.Method),
 		)
-		c.AbortWithStatus(500)
+		problem.Write(c, problem.FromError(fmt.Errorf("panic: %v", recovered)))
 	})
 }
 
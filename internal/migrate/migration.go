@@ -0,0 +1,144 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidMigrationName is returned for scripts not named V<version>__<description>.sql
+var ErrInvalidMigrationName = errors.New("invalid migration name")
+
+// Migration is a versioned SQL migration script
+type Migration struct {
+	Version     string
+	Description string
+	Script      string
+	Checksum    int32
+	SQL         string
+
+	// versionParts is the numeric version used for ordering
+	versionParts []int
+}
+
+// loadMigrations reads the versioned migrations of fsys, ordered by version
+func loadMigrations(fsys fs.FS) ([]*Migration, error) {
+	scripts, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]*Migration, 0, len(scripts))
+	versions := make(map[string]string, len(scripts))
+	for _, script := range scripts {
+		content, err := fs.ReadFile(fsys, script)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, err := parseMigration(script, content)
+		if err != nil {
+			return nil, err
+		}
+		key := normalizeVersion(migration.versionParts)
+		if other, ok := versions[key]; ok {
+			return nil, fmt.Errorf("found more than one migration with version %s: %s and %s", migration.Version, other, script)
+		}
+		versions[key] = script
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return compareVersions(migrations[i].versionParts, migrations[j].versionParts) < 0
+	})
+	return migrations, nil
+}
+
+// parseMigration builds a migration from a script named the way Flyway
+// expects, e.g. V2__add_orders_list_indexes.sql or V2_1__fix.sql
+func parseMigration(script string, content []byte) (*Migration, error) {
+	name := path.Base(script)
+	versionText, description, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), "__")
+	if !ok || !strings.HasPrefix(versionText, "V") || !strings.HasSuffix(name, ".sql") {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMigrationName, name)
+	}
+
+	version := strings.ReplaceAll(strings.TrimPrefix(versionText, "V"), "_", ".")
+	parts, err := parseVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMigrationName, name)
+	}
+
+	return &Migration{
+		Version:      version,
+		Description:  strings.ReplaceAll(description, "_", " "),
+		Script:       name,
+		Checksum:     checksum(content),
+		SQL:          string(content),
+		versionParts: parts,
+	}, nil
+}
+
+// parseVersion splits a dotted version such as "2.1" into its numbers
+func parseVersion(version string) ([]int, error) {
+	fields := strings.Split(version, ".")
+	parts := make([]int, len(fields))
+	for i, field := range fields {
+		part, err := strconv.Atoi(field)
+		if err != nil || part < 0 {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		parts[i] = part
+	}
+	return parts, nil
+}
+
+// compareVersions compares two versions numerically, treating missing
+// trailing parts as zero
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// checksum computes the checksum Flyway stores for SQL migrations: the CRC32
+// of the script's lines without line terminators or byte order mark
+func checksum(content []byte) int32 {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+
+	hash := crc32.NewIEEE()
+	for len(content) > 0 {
+		end := bytes.IndexAny(content, "\r\n")
+		if end < 0 {
+			end = len(content)
+		}
+		hash.Write(content[:end])
+		content = content[end:]
+		// Skip the terminator: \n, \r or \r\n
+		if bytes.HasPrefix(content, []byte("\r\n")) {
+			content = content[2:]
+		} else if len(content) > 0 {
+			content = content[1:]
+		}
+	}
+	return int32(hash.Sum32())
+}
@@ -0,0 +1,144 @@
+package migrate
+
+import (
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	"casebrief/migrations"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations_OrdersByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"V10__add_index.sql":        {Data: []byte("CREATE INDEX a ON t (a);")},
+		"V2__create_table.sql":      {Data: []byte("CREATE TABLE t (a INT);")},
+		"V2_1__add_column.sql":      {Data: []byte("ALTER TABLE t ADD COLUMN b INT;")},
+		"V1__create_orders_tbl.sql": {Data: []byte("SELECT 1;")},
+	}
+
+	loaded, err := loadMigrations(fsys)
+	require.NoError(t, err)
+
+	var versions []string
+	for _, migration := range loaded {
+		versions = append(versions, migration.Version)
+	}
+	assert.Equal(t, []string{"1", "2", "2.1", "10"}, versions)
+	assert.Equal(t, "add column", loaded[2].Description)
+	assert.Equal(t, "V2_1__add_column.sql", loaded[2].Script)
+}
+
+func TestLoadMigrations_RejectsInvalidNames(t *testing.T) {
+	for _, name := range []string{"create_table.sql", "V1_create_table.sql", "Vx__create_table.sql", "R__view.sql"} {
+		_, err := loadMigrations(fstest.MapFS{name: {Data: []byte("SELECT 1;")}})
+		assert.ErrorIs(t, err, ErrInvalidMigrationName, name)
+	}
+
+	_, err := loadMigrations(fstest.MapFS{
+		"V1__a.sql":   {Data: []byte("SELECT 1;")},
+		"V1_0__b.sql": {Data: []byte("SELECT 1;")},
+	})
+	assert.Error(t, err, "1 and 1.0 are the same version")
+}
+
+func TestLoadMigrations_Embedded(t *testing.T) {
+	loaded, err := loadMigrations(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+
+	assert.Equal(t, "1", loaded[0].Version)
+	assert.Equal(t, "create orders table", loaded[0].Description)
+	for _, migration := range loaded {
+		assert.NotEmpty(t, migration.SQL, migration.Script)
+	}
+}
+
+func TestChecksum_IgnoresLineTerminatorsAndBOM(t *testing.T) {
+	unix := checksum([]byte("CREATE TABLE t (\n  a INT\n);\n"))
+
+	assert.Equal(t, unix, checksum([]byte("CREATE TABLE t (\r\n  a INT\r\n);\r\n")))
+	assert.Equal(t, unix, checksum([]byte("\xef\xbb\xbfCREATE TABLE t (\n  a INT\n);")))
+	assert.NotEqual(t, unix, checksum([]byte("CREATE TABLE t (\n  a BIGINT\n);\n")))
+}
+
+func TestDescribe(t *testing.T) {
+	loaded, err := loadMigrations(fstest.MapFS{
+		"V1__one.sql":   {Data: []byte("SELECT 1;")},
+		"V2__two.sql":   {Data: []byte("SELECT 2;")},
+		"V3__three.sql": {Data: []byte("SELECT 3;")},
+		"V4__four.sql":  {Data: []byte("SELECT 4;")},
+	})
+	require.NoError(t, err)
+
+	applied := func(version string, checksum int32) *appliedMigration {
+		parts, err := parseVersion(version)
+		require.NoError(t, err)
+		return &appliedMigration{
+			version:       version,
+			migrationType: "SQL",
+			checksum:      sql.NullInt32{Int32: checksum, Valid: true},
+			success:       true,
+			versionParts:  parts,
+		}
+	}
+
+	t.Run("fresh database", func(t *testing.T) {
+		infos := describe(loaded, nil)
+		require.Len(t, infos, 4)
+		for _, info := range infos {
+			assert.Equal(t, StatePending, info.State)
+		}
+		assert.NoError(t, validate(infos, false))
+		assert.ErrorIs(t, validate(infos, true), ErrValidation)
+	})
+
+	t.Run("partially migrated", func(t *testing.T) {
+		infos := describe(loaded, []*appliedMigration{applied("1", loaded[0].Checksum), applied("2", loaded[1].Checksum)})
+		assert.Equal(t, []string{StateSuccess, StateSuccess, StatePending, StatePending}, states(infos))
+		assert.NoError(t, validate(infos, false))
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		infos := describe(loaded, []*appliedMigration{applied("1", loaded[0].Checksum+1)})
+		assert.Equal(t, StateMismatch, infos[0].State)
+		assert.ErrorIs(t, validate(infos, false), ErrValidation)
+	})
+
+	t.Run("out of order", func(t *testing.T) {
+		infos := describe(loaded, []*appliedMigration{applied("1", loaded[0].Checksum), applied("3", loaded[2].Checksum)})
+		assert.Equal(t, []string{StateSuccess, StateIgnored, StateSuccess, StatePending}, states(infos))
+		assert.ErrorIs(t, validate(infos, false), ErrValidation)
+	})
+
+	t.Run("missing and future", func(t *testing.T) {
+		infos := describe(loaded[1:], []*appliedMigration{
+			applied("1", loaded[0].Checksum),
+			applied("2", loaded[1].Checksum),
+			applied("3", loaded[2].Checksum),
+			applied("4", loaded[3].Checksum),
+			applied("5", 0),
+		})
+		assert.Equal(t, []string{StateSuccess, StateSuccess, StateSuccess, StateMissing, StateFuture}, states(infos))
+		assert.ErrorIs(t, validate(infos, false), ErrValidation)
+	})
+
+	t.Run("baseline", func(t *testing.T) {
+		baseline := applied("2", 0)
+		baseline.migrationType = "BASELINE"
+		baseline.checksum = sql.NullInt32{}
+		infos := describe(loaded, []*appliedMigration{baseline})
+		assert.Equal(t, []string{StateBelow, StateBaseline, StatePending, StatePending}, states(infos))
+		assert.NoError(t, validate(infos, false))
+	})
+}
+
+func states(infos []MigrationInfo) []string {
+	result := make([]string, len(infos))
+	for i, info := range infos {
+		result[i] = info.State
+	}
+	return result
+}
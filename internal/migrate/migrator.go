@@ -0,0 +1,387 @@
+// Package migrate applies the embedded SQL migrations and records them in a
+// Flyway-compatible schema history table, so databases migrated by Flyway
+// keep working and can be migrated further by the service itself.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// historyTable is the table Flyway records applied migrations in
+const historyTable = "flyway_schema_history"
+
+// migrateLockID is the Postgres advisory lock held while migrating, so
+// replicas starting at the same time do not apply migrations twice
+const migrateLockID int64 = 0x6d696772617465 // "migrate"
+
+// Migration states, named like Flyway's
+const (
+	StateSuccess  = "Success"
+	StatePending  = "Pending"
+	StateFailed   = "Failed"
+	StateMismatch = "Checksum Mismatch"
+	StateMissing  = "Missing"
+	StateFuture   = "Future"
+	StateIgnored  = "Ignored"
+	StateBaseline = "Baseline"
+	StateBelow    = "Below Baseline"
+)
+
+// ErrValidation is returned when the applied migrations do not match the embedded ones
+var ErrValidation = errors.New("migration validation failed")
+
+// MigrationInfo describes the state of a migration
+type MigrationInfo struct {
+	Version     string
+	Description string
+	Script      string
+	State       string
+	InstalledOn time.Time
+}
+
+// appliedMigration is a row of the schema history table
+type appliedMigration struct {
+	version       string
+	description   string
+	migrationType string
+	script        string
+	checksum      sql.NullInt32
+	installedOn   time.Time
+	success       bool
+	versionParts  []int
+}
+
+// Migrator applies versioned migrations to a Postgres database
+type Migrator struct {
+	db     *sql.DB
+	fsys   fs.FS
+	logger *zap.Logger
+}
+
+// NewMigrator creates a new migrator for the migrations in fsys
+func NewMigrator(db *sql.DB, fsys fs.FS, logger *zap.Logger) *Migrator {
+	return &Migrator{
+		db:     db,
+		fsys:   fsys,
+		logger: logger,
+	}
+}
+
+// Up validates the applied migrations and applies the pending ones in
+// version order, each in its own transaction. It returns the number of
+// migrations applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	migrations, err := loadMigrations(m.fsys)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrateLockID); err != nil {
+		return 0, err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrateLockID)
+
+	if err := createHistoryTable(ctx, conn); err != nil {
+		return 0, err
+	}
+
+	applied, err := loadApplied(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	infos := describe(migrations, applied)
+	if err := validate(infos, false); err != nil {
+		return 0, err
+	}
+
+	// Unversioned entries (e.g. Flyway's schema creation) also take a rank
+	var rank int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(installed_rank), 0) FROM `+historyTable).Scan(&rank); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i, migration := range migrations {
+		if infos[i].State != StatePending {
+			continue
+		}
+
+		rank++
+		if err := m.apply(ctx, conn, migration, rank); err != nil {
+			return count, fmt.Errorf("migration %s failed: %w", migration.Script, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Status reports the state of every embedded and applied migration
+func (m *Migrator) Status(ctx context.Context) ([]MigrationInfo, error) {
+	migrations, err := loadMigrations(m.fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.loadAppliedIfExists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return describe(migrations, applied), nil
+}
+
+// Validate checks that the applied migrations match the embedded ones and
+// that none are pending
+func (m *Migrator) Validate(ctx context.Context) error {
+	infos, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return validate(infos, true)
+}
+
+// apply runs a migration and records it in the schema history table
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration *Migration, rank int) error {
+	m.logger.Info("Applying migration",
+		zap.String("version", migration.Version),
+		zap.String("script", migration.Script),
+	)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	start := time.Now()
+	if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+		return err
+	}
+	executionTime := time.Since(start)
+
+	insertQuery := `
+		INSERT INTO ` + historyTable + ` (installed_rank, version, description, type, script, checksum, installed_by, execution_time, success)
+		VALUES ($1, $2, $3, 'SQL', $4, $5, current_user, $6, TRUE)
+	`
+	if _, err := tx.ExecContext(ctx, insertQuery,
+		rank, migration.Version, migration.Description, migration.Script, migration.Checksum, executionTime.Milliseconds(),
+	); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	m.logger.Info("Migration applied",
+		zap.String("version", migration.Version),
+		zap.Duration("execution_time", executionTime),
+	)
+	return nil
+}
+
+// loadAppliedIfExists reads the schema history, which is empty if the table
+// has not been created yet
+func (m *Migrator) loadAppliedIfExists(ctx context.Context) ([]*appliedMigration, error) {
+	var exists bool
+	if err := m.db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, historyTable).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return loadApplied(ctx, conn)
+}
+
+// createHistoryTable creates the schema history table with Flyway's layout
+func createHistoryTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+historyTable+` (
+			installed_rank INTEGER NOT NULL,
+			version VARCHAR(50),
+			description VARCHAR(200) NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			script VARCHAR(1000) NOT NULL,
+			checksum INTEGER,
+			installed_by VARCHAR(100) NOT NULL,
+			installed_on TIMESTAMP NOT NULL DEFAULT now(),
+			execution_time INTEGER NOT NULL,
+			success BOOLEAN NOT NULL,
+			CONSTRAINT `+historyTable+`_pk PRIMARY KEY (installed_rank)
+		);
+		CREATE INDEX IF NOT EXISTS `+historyTable+`_s_idx ON `+historyTable+` (success);
+	`)
+	return err
+}
+
+// loadApplied reads the versioned entries of the schema history table
+func loadApplied(ctx context.Context, conn *sql.Conn) ([]*appliedMigration, error) {
+	query := `
+		SELECT version, description, type, script, checksum, installed_on, success
+		FROM ` + historyTable + `
+		WHERE version IS NOT NULL
+		ORDER BY installed_rank
+	`
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := []*appliedMigration{}
+	for rows.Next() {
+		record := &appliedMigration{}
+		if err := rows.Scan(
+			&record.version,
+			&record.description,
+			&record.migrationType,
+			&record.script,
+			&record.checksum,
+			&record.installedOn,
+			&record.success,
+		); err != nil {
+			return nil, err
+		}
+		record.versionParts, err = parseVersion(record.version)
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, record)
+	}
+
+	return applied, rows.Err()
+}
+
+// describe matches the embedded migrations with the applied ones. The result
+// starts with one entry per embedded migration, in the same order, followed by
+// applied migrations that are not embedded.
+func describe(migrations []*Migration, applied []*appliedMigration) []MigrationInfo {
+	byVersion := make(map[string]*appliedMigration, len(applied))
+	var baseline, latest []int
+	for _, record := range applied {
+		if record.migrationType == "BASELINE" {
+			baseline = record.versionParts
+		}
+		if record.success && compareVersions(record.versionParts, latest) > 0 {
+			latest = record.versionParts
+		}
+		byVersion[normalizeVersion(record.versionParts)] = record
+	}
+
+	infos := make([]MigrationInfo, 0, len(migrations)+len(applied))
+	embedded := make(map[string]bool, len(migrations))
+	var newest []int
+	for _, migration := range migrations {
+		key := normalizeVersion(migration.versionParts)
+		embedded[key] = true
+		newest = migration.versionParts
+
+		info := MigrationInfo{
+			Version:     migration.Version,
+			Description: migration.Description,
+			Script:      migration.Script,
+		}
+
+		record, ok := byVersion[key]
+		switch {
+		case ok && record.migrationType == "BASELINE":
+			info.State = StateBaseline
+			info.InstalledOn = record.installedOn
+		case ok && !record.success:
+			info.State = StateFailed
+			info.InstalledOn = record.installedOn
+		case ok && record.checksum.Valid && record.checksum.Int32 != migration.Checksum:
+			info.State = StateMismatch
+			info.InstalledOn = record.installedOn
+		case ok:
+			info.State = StateSuccess
+			info.InstalledOn = record.installedOn
+		case baseline != nil && compareVersions(migration.versionParts, baseline) <= 0:
+			info.State = StateBelow
+		case latest != nil && compareVersions(migration.versionParts, latest) < 0:
+			// Flyway does not apply migrations older than the latest applied one
+			info.State = StateIgnored
+		default:
+			info.State = StatePending
+		}
+		infos = append(infos, info)
+	}
+
+	for _, record := range applied {
+		if embedded[normalizeVersion(record.versionParts)] {
+			continue
+		}
+		state := StateMissing
+		if compareVersions(record.versionParts, newest) > 0 {
+			state = StateFuture
+		}
+		if record.migrationType == "BASELINE" {
+			state = StateBaseline
+		}
+		infos = append(infos, MigrationInfo{
+			Version:     record.version,
+			Description: record.description,
+			Script:      record.script,
+			State:       state,
+			InstalledOn: record.installedOn,
+		})
+	}
+
+	return infos
+}
+
+// validate reports migrations in a state that prevents migrating. Future
+// migrations (applied by a newer release) are tolerated so rollbacks work.
+func validate(infos []MigrationInfo, failOnPending bool) error {
+	var problems []string
+	for _, info := range infos {
+		switch {
+		case info.State == StateSuccess, info.State == StateBaseline, info.State == StateBelow, info.State == StateFuture:
+		case info.State == StatePending && !failOnPending:
+		default:
+			problems = append(problems, fmt.Sprintf("V%s %s: %s", info.Version, info.Script, info.State))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrValidation, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// normalizeVersion formats a version without trailing zero parts, so that
+// "1" and "1.0" are the same version
+func normalizeVersion(parts []int) string {
+	end := len(parts)
+	for end > 1 && parts[end-1] == 0 {
+		end--
+	}
+	text := make([]string, end)
+	for i := 0; i < end; i++ {
+		text[i] = fmt.Sprint(parts[i])
+	}
+	return strings.Join(text, ".")
+}
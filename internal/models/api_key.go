@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// APIKey is a static API key of a service client. Only the SHA-256 of the
+// key is stored.
+type APIKey struct {
+	ID      string   `json:"id" db:"id"`
+	Name    string   `json:"name" db:"name"`
+	KeyHash string   `json:"-" db:"key_hash"`
+	Scopes  []string `json:"scopes" db:"scopes"`
+	// TenantID binds the key to a tenant; keys without tenant select the
+	// tenant per request
+	TenantID  string     `json:"tenant_id,omitempty" db:"tenant_id"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Active reports whether the key may be used at the given time
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil && !k.RevokedAt.After(now) {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
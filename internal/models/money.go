@@ -0,0 +1,204 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// moneyScale is the number of fractional digits kept by Money. Four digits
+// cover the minor units of every ISO 4217 currency.
+const moneyScale = 4
+
+// moneyFactor is 10^moneyScale
+const moneyFactor = 10000
+
+// MaxMoney is the largest amount, 922337203685477.5807. Amounts between
+// -MaxMoney and MaxMoney fit the NUMERIC(19, 4) money columns.
+const MaxMoney = Money(math.MaxInt64)
+
+var (
+	// ErrInvalidMoney is returned when an amount cannot be parsed exactly
+	ErrInvalidMoney = errors.New("invalid money amount")
+	// ErrMoneyOverflow is returned when the result of a calculation is out of
+	// the range of Money
+	ErrMoneyOverflow = errors.New("money amount out of range")
+	// ErrInvalidQuantity is returned when an amount is divided by a quantity
+	// that is not positive
+	ErrInvalidQuantity = errors.New("invalid quantity")
+)
+
+// Money is an exact decimal amount stored as an integer number of
+// ten-thousandths. It is encoded in JSON as a number and in the database as
+// a NUMERIC string, so no precision is lost on the way.
+type Money int64
+
+// ParseMoney parses a decimal string such as "12.34" or "-0.5"
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	if len(fraction) > moneyScale {
+		// Extra digits are only accepted if they are zeros
+		if strings.Trim(fraction[moneyScale:], "0") != "" {
+			return 0, fmt.Errorf("%w: more than %d decimal places", ErrInvalidMoney, moneyScale)
+		}
+		fraction = fraction[:moneyScale]
+	}
+
+	digits := whole + fraction + strings.Repeat("0", moneyScale-len(fraction))
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+		}
+	}
+
+	value, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	if negative {
+		value = -value
+	}
+	return Money(value), nil
+}
+
+// Mul multiplies the amount by a quantity. It returns ErrMoneyOverflow if the
+// product is out of range.
+func (m Money) Mul(quantity int) (Money, error) {
+	if m == 0 || quantity == 0 {
+		return 0, nil
+	}
+	product := m * Money(quantity)
+	if !m.valid() || !Money(quantity).valid() || !product.valid() || product/Money(quantity) != m {
+		return 0, fmt.Errorf("%w: %s × %d", ErrMoneyOverflow, m, quantity)
+	}
+	return product, nil
+}
+
+// Add adds two amounts. It returns ErrMoneyOverflow if the sum is out of
+// range.
+func (m Money) Add(other Money) (Money, error) {
+	if !m.valid() || !other.valid() || (other > 0 && m > MaxMoney-other) || (other < 0 && m < -MaxMoney-other) {
+		return 0, fmt.Errorf("%w: %s + %s", ErrMoneyOverflow, m, other)
+	}
+	return m + other, nil
+}
+
+// Div divides the amount by a quantity, rounding half away from zero to the
+// given number of decimal places. It returns ErrInvalidQuantity if the
+// quantity is not positive.
+func (m Money) Div(quantity int, decimals int) (Money, error) {
+	step := Money(pow10(moneyScale - decimals))
+	if quantity <= 0 || Money(quantity) > MaxMoney/step {
+		return 0, fmt.Errorf("%w: %d", ErrInvalidQuantity, quantity)
+	}
+	divisor := Money(quantity) * step
+	quotient, remainder := m/divisor, m%divisor
+	if remainder*2 >= divisor {
+		quotient++
+	} else if remainder*2 <= -divisor {
+		quotient--
+	}
+	return quotient * step, nil
+}
+
+// HasDecimals reports whether the amount can be written with at most the
+// given number of decimal places
+func (m Money) HasDecimals(decimals int) bool {
+	return int64(m)%pow10(moneyScale-decimals) == 0
+}
+
+// String formats the amount with at least two decimal places
+func (m Money) String() string {
+	value := int64(m)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	fraction := fmt.Sprintf("%04d", value%moneyFactor)
+	fraction = strings.TrimRight(fraction, "0")
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+	return sign + strconv.FormatInt(value/moneyFactor, 10) + "." + fraction
+}
+
+// MarshalJSON encodes the amount as a JSON number
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number or string without going through float64
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("%w: exponent notation is not supported", ErrInvalidMoney)
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		parsed, err := ParseMoney(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case int64:
+		if v > int64(MaxMoney)/moneyFactor || v < -int64(MaxMoney)/moneyFactor {
+			return fmt.Errorf("%w: %d", ErrMoneyOverflow, v)
+		}
+		*m = Money(v * moneyFactor)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer, sending the exact decimal text
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// valid reports whether the amount is in the range of Money; the smallest
+// int64 is not, as its negation overflows
+func (m Money) valid() bool {
+	return m >= -MaxMoney
+}
+
+// pow10 returns 10^n for small non-negative n
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Money
+	}{
+		{"0", 0},
+		{"12.34", 123400},
+		{"-0.5", -5000},
+		{".25", 2500},
+		{"100", 1000000},
+		{"1.23450000", 12345},
+		{"999999999999.9999", 9999999999999999},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.input)
+		assert.NoError(t, err, tt.input)
+		assert.Equal(t, tt.want, got, tt.input)
+	}
+
+	for _, input := range []string{"", "-", "abc", "1.2.3", "1.23456", "1e5"} {
+		_, err := ParseMoney(input)
+		assert.ErrorIs(t, err, ErrInvalidMoney, input)
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	assert.Equal(t, "0.00", Money(0).String())
+	assert.Equal(t, "12.30", Money(123000).String())
+	assert.Equal(t, "1.2345", Money(12345).String())
+	assert.Equal(t, "-0.05", Money(-500).String())
+	assert.Equal(t, "100000000.00", Money(1000000000000).String())
+}
+
+func TestMoney_Div(t *testing.T) {
+	div := func(m Money, quantity, decimals int) string {
+		quotient, err := m.Div(quantity, decimals)
+		require.NoError(t, err)
+		return quotient.String()
+	}
+	assert.Equal(t, "33.33", div(1000000, 3, 2))
+	assert.Equal(t, "66.67", div(2000000, 3, 2))
+	assert.Equal(t, "33.00", div(1000000, 3, 0))
+	assert.Equal(t, "-66.67", div(-2000000, 3, 2))
+
+	_, err := Money(1000000).Div(0, 2)
+	assert.ErrorIs(t, err, ErrInvalidQuantity)
+	_, err = Money(1000000).Div(-3, 2)
+	assert.ErrorIs(t, err, ErrInvalidQuantity)
+}
+
+func TestMoney_Overflow(t *testing.T) {
+	product, err := Money(MaxMoney / 3).Mul(3)
+	require.NoError(t, err)
+	assert.Equal(t, MaxMoney/3*3, product)
+	product, err = Money(-20000).Mul(3)
+	require.NoError(t, err)
+	assert.Equal(t, Money(-60000), product)
+
+	_, err = Money(MaxMoney/3 + 1).Mul(3)
+	assert.ErrorIs(t, err, ErrMoneyOverflow)
+	_, err = Money(-MaxMoney).Mul(-1)
+	require.NoError(t, err)
+	_, err = (-MaxMoney - 1).Mul(-1)
+	assert.ErrorIs(t, err, ErrMoneyOverflow)
+
+	sum, err := (MaxMoney - 1).Add(1)
+	require.NoError(t, err)
+	assert.Equal(t, MaxMoney, sum)
+	_, err = MaxMoney.Add(1)
+	assert.ErrorIs(t, err, ErrMoneyOverflow)
+	_, err = (-MaxMoney).Add(-1)
+	assert.ErrorIs(t, err, ErrMoneyOverflow)
+
+	// The largest amount still parses, the next one does not
+	parsed, err := ParseMoney("922337203685477.5807")
+	require.NoError(t, err)
+	assert.Equal(t, MaxMoney, parsed)
+	_, err = ParseMoney("922337203685477.5808")
+	assert.ErrorIs(t, err, ErrInvalidMoney)
+
+	var scanned Money
+	assert.ErrorIs(t, scanned.Scan(int64(1)<<60), ErrMoneyOverflow)
+}
+
+func TestMoney_HasDecimals(t *testing.T) {
+	assert.True(t, Money(123400).HasDecimals(2))
+	assert.False(t, Money(123450).HasDecimals(2))
+	assert.True(t, Money(1000000).HasDecimals(0))
+	assert.False(t, Money(1000500).HasDecimals(0))
+}
+
+func TestMoney_JSON(t *testing.T) {
+	var item OrderItem
+	require.NoError(t, json.Unmarshal([]byte(`{"unit_price": 0.1, "line_total": "123456789012.34"}`), &item))
+	assert.Equal(t, Money(1000), item.UnitPrice)
+	assert.Equal(t, Money(1234567890123400), item.LineTotal)
+
+	data, err := json.Marshal(item)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"product_id": "", "quantity": 0, "unit_price": 0.10, "line_total": 123456789012.34}`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"unit_price": 1e3}`), &item))
+}
+
+func TestMoney_Scan(t *testing.T) {
+	var m Money
+	require.NoError(t, m.Scan([]byte("123456789.1200")))
+	assert.Equal(t, Money(1234567891200), m)
+
+	value, err := m.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "123456789.12", value)
+}
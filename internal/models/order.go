@@ -4,25 +4,155 @@ import (
 	"time"
 )
 
-// Order represents an order in the system
+// Order statuses
+const (
+	OrderStatusCreated   = "created"
+	OrderStatusConfirmed = "confirmed"
+	OrderStatusPaid      = "paid"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
+// Cancellation reason codes
+const (
+	CancelReasonCustomerRequest = "customer_request"
+	CancelReasonPaymentFailed   = "payment_failed"
+	CancelReasonOutOfStock      = "out_of_stock"
+	CancelReasonFraudSuspected  = "fraud_suspected"
+	CancelReasonOther           = "other"
+)
+
+// Order represents an order in the system.
+// ProductID and Quantity summarize the line items for clients predating
+// multi-line orders: the product of the first line and the total number of units.
+// Version starts at 1 and is incremented by every change of the order.
 type Order struct {
-	ID         string    `json:"id" db:"id"`
-	CustomerID string    `json:"customer_id" db:"customer_id"`
-	ProductID  string    `json:"product_id" db:"product_id"`
-	Quantity   int       `json:"quantity" db:"quantity"`
-	TotalPrice float64   `json:"total_price" db:"total_price"`
-	Status     string    `json:"status" db:"status"`
-	OrderTime  time.Time `json:"order_time" db:"order_time"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
-}
-
-// CreateOrderRequest represents the request to create an order
+	ID              string           `json:"id" db:"id"`
+	TenantID        string           `json:"tenant_id" db:"tenant_id"`
+	CustomerID      string           `json:"customer_id" db:"customer_id"`
+	ProductID       string           `json:"product_id" db:"product_id"`
+	Quantity        int              `json:"quantity" db:"quantity"`
+	TotalPrice      Money            `json:"total_price" db:"total_price" swaggertype:"number"`
+	Currency        string           `json:"currency" db:"currency"`
+	Status          string           `json:"status" db:"status"`
+	ShippingAddress *ShippingAddress `json:"shipping_address,omitempty" db:"shipping_address"`
+	Version         int64            `json:"version" db:"version"`
+	OrderTime       time.Time        `json:"order_time" db:"order_time"`
+	CreatedAt       time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at" db:"updated_at"`
+	Items           []OrderItem      `json:"items"`
+}
+
+// Clone returns a copy of the order that shares no memory with it
+func (o *Order) Clone() *Order {
+	clone := *o
+	clone.Items = append([]OrderItem{}, o.Items...)
+	if o.ShippingAddress != nil {
+		address := *o.ShippingAddress
+		clone.ShippingAddress = &address
+	}
+	return &clone
+}
+
+// ShippingAddress is the address an order is shipped to
+type ShippingAddress struct {
+	Name       string `json:"name" binding:"required"`
+	Line1      string `json:"line1" binding:"required"`
+	Line2      string `json:"line2,omitempty"`
+	PostalCode string `json:"postal_code" binding:"required"`
+	City       string `json:"city" binding:"required"`
+	// Country is an ISO 3166-1 alpha-2 code
+	Country string `json:"country" binding:"required,len=2"`
+}
+
+// OrderItem represents a line of an order
+type OrderItem struct {
+	ProductID string `json:"product_id" db:"product_id"`
+	Quantity  int    `json:"quantity" db:"quantity"`
+	UnitPrice Money  `json:"unit_price" db:"unit_price" swaggertype:"number"`
+	LineTotal Money  `json:"line_total" db:"line_total" swaggertype:"number"`
+}
+
+// CreateOrderRequest represents the request to create an order.
+// Either Items or the single product fields (ProductID, Quantity and
+// TotalPrice) must be given; the total price is always computed by the server.
+// Currency is an ISO 4217 code and defaults to DefaultCurrency.
 type CreateOrderRequest struct {
-	CustomerID     string    `json:"customer_id" binding:"required"`
-	ProductID      string    `json:"product_id" binding:"required"`
-	Quantity       int       `json:"quantity" binding:"required,min=1"`
-	TotalPrice     float64   `json:"total_price" binding:"required,min=0"`
-	OrderTime      time.Time `json:"order_time,omitempty" binding:"required"`
-	IdempotencyKey string    `json:"idempotency_key" binding:"required"`
+	CustomerID string                   `json:"customer_id" binding:"required"`
+	Items      []CreateOrderItemRequest `json:"items,omitempty" binding:"omitempty,min=1,dive"`
+	ProductID  string                   `json:"product_id,omitempty" binding:"required_without=Items"`
+	Quantity   int                      `json:"quantity,omitempty" binding:"required_without=Items,omitempty,min=1,max=2147483647"`
+	TotalPrice Money                    `json:"total_price,omitempty" binding:"required_without=Items,omitempty,min=0" swaggertype:"number"`
+	Currency   string                   `json:"currency,omitempty" binding:"omitempty,len=3"`
+	OrderTime  time.Time                `json:"order_time,omitempty" binding:"required"`
+
+	ShippingAddress *ShippingAddress `json:"shipping_address,omitempty"`
+}
+
+// CreateOrderItemRequest represents a line of the request to create an order
+type CreateOrderItemRequest struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,min=1,max=2147483647"`
+	UnitPrice Money  `json:"unit_price" binding:"min=0" swaggertype:"number"`
+}
+
+// UpdateOrderRequest is the changeable part of an order. PATCH /orders/{id}
+// applies a JSON merge patch (RFC 7396) to it: items replace all lines of the
+// order, shipping_address fields are merged and null removes the address.
+// The totals are recomputed from the lines in the order's currency.
+type UpdateOrderRequest struct {
+	Items           []CreateOrderItemRequest `json:"items" binding:"required,min=1,dive"`
+	ShippingAddress *ShippingAddress         `json:"shipping_address"`
+}
+
+// ListOrdersRequest represents the query parameters for listing orders
+type ListOrdersRequest struct {
+	CustomerID    string    `form:"customer_id"`
+	ProductID     string    `form:"product_id"`
+	Status        string    `form:"status"`
+	OrderTimeFrom time.Time `form:"order_time_from"`
+	OrderTimeTo   time.Time `form:"order_time_to"`
+	CreatedFrom   time.Time `form:"created_from"`
+	CreatedTo     time.Time `form:"created_to"`
+	Cursor        string    `form:"cursor"`
+	Limit         int       `form:"limit" binding:"omitempty,min=1,max=100"`
+	IncludeTotal  bool      `form:"include_total"`
+}
+
+// OrderListResponse represents a single page of orders
+type OrderListResponse struct {
+	Orders     []*Order `json:"orders"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+	TotalCount *int64   `json:"total_count,omitempty"`
+}
+
+// TransitionOrderRequest represents the request to move an order to a new status
+type TransitionOrderRequest struct {
+	Status string `json:"status" binding:"required"`
+	// ChangedBy names who changes the status. The authenticated caller is
+	// recorded instead; it is only required for anonymous requests.
+	ChangedBy string `json:"changed_by,omitempty" binding:"max=255"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// CancelOrderRequest represents the request to cancel an order
+type CancelOrderRequest struct {
+	ReasonCode string `json:"reason_code" binding:"required,oneof=customer_request payment_failed out_of_stock fraud_suspected other"`
+	Reason     string `json:"reason,omitempty"`
+	// CancelledBy names who cancels the order. The authenticated caller is
+	// recorded instead; it is only required for anonymous requests.
+	CancelledBy string `json:"cancelled_by,omitempty" binding:"max=255"`
+}
+
+// OrderStatusChange represents an entry of an order's status history
+type OrderStatusChange struct {
+	ID         int64     `json:"id" db:"id"`
+	OrderID    string    `json:"order_id" db:"order_id"`
+	FromStatus string    `json:"from_status" db:"from_status"`
+	ToStatus   string    `json:"to_status" db:"to_status"`
+	ChangedBy  string    `json:"changed_by" db:"changed_by"`
+	Reason     string    `json:"reason,omitempty" db:"reason"`
+	ChangedAt  time.Time `json:"changed_at" db:"changed_at"`
 }
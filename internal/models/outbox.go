@@ -0,0 +1,19 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent represents an event stored in the transactional outbox
+type OutboxEvent struct {
+	ID          int64           `json:"id" db:"id"`
+	EventType   string          `json:"event_type" db:"event_type"`
+	AggregateID string          `json:"aggregate_id" db:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload" db:"payload"`
+	Attempts    int             `json:"attempts" db:"attempts"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	// TraceContext holds the W3C traceparent, tracestate and baggage of the
+	// request that emitted the event
+	TraceContext map[string]string `json:"trace_context,omitempty" db:"trace_context"`
+}
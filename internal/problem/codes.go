@@ -0,0 +1,79 @@
+package problem
+
+import (
+	"errors"
+	"net/http"
+
+	"casebrief/internal/repository"
+	"casebrief/internal/service"
+)
+
+// Error codes. They are part of the API and must not change.
+const (
+	CodeMalformedRequest         = "malformed_request"
+	CodeValidationFailed         = "validation_failed"
+	CodeInvalidCursor            = "invalid_cursor"
+	CodeUnknownStatus            = "unknown_status"
+	CodeUnsupportedCurrency      = "unsupported_currency"
+	CodeInvalidAmount            = "invalid_amount"
+	CodeInvalidActor             = "invalid_actor"
+	CodeOrderNotFound            = "order_not_found"
+	CodeIllegalTransition        = "illegal_transition"
+	CodeStatusConflict           = "status_conflict"
+	CodeOrderNotEditable         = "order_not_editable"
+	CodePreconditionRequired     = "precondition_required"
+	CodePreconditionFailed       = "precondition_failed"
+	CodeUnsupportedMediaType     = "unsupported_media_type"
+	CodeIdempotencyKeyRequired   = "idempotency_key_required"
+	CodeIdempotencyKeyTooLong    = "idempotency_key_too_long"
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	CodeUnauthorized             = "unauthorized"
+	CodeInsufficientScope        = "insufficient_scope"
+	CodeRateLimited              = "rate_limited"
+	CodeTenantRequired           = "tenant_required"
+	CodeInvalidTenant            = "invalid_tenant"
+	CodeTenantForbidden          = "tenant_forbidden"
+	CodeWatcherTooSlow           = "watcher_too_slow"
+	CodeShuttingDown             = "shutting_down"
+	CodeRouteNotFound            = "route_not_found"
+	CodeMethodNotAllowed         = "method_not_allowed"
+	CodeInternal                 = "internal_error"
+)
+
+// domainError maps a domain error of the repository or service layer to HTTP
+type domainError struct {
+	err    error
+	status int
+	code   string
+}
+
+// domainErrors is the central mapping of domain errors to HTTP. Errors
+// wrapping one of them are mapped the same way.
+var domainErrors = []domainError{
+	{service.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidCursor},
+	{service.ErrUnknownStatus, http.StatusBadRequest, CodeUnknownStatus},
+	{service.ErrUnsupportedCurrency, http.StatusBadRequest, CodeUnsupportedCurrency},
+	{service.ErrInvalidAmount, http.StatusBadRequest, CodeInvalidAmount},
+	{service.ErrInvalidActor, http.StatusBadRequest, CodeInvalidActor},
+	{repository.ErrOrderNotFound, http.StatusNotFound, CodeOrderNotFound},
+	{service.ErrIllegalTransition, http.StatusConflict, CodeIllegalTransition},
+	{repository.ErrOrderStatusConflict, http.StatusConflict, CodeStatusConflict},
+	{service.ErrOrderNotEditable, http.StatusConflict, CodeOrderNotEditable},
+	{repository.ErrOrderVersionMismatch, http.StatusPreconditionFailed, CodePreconditionFailed},
+}
+
+// FromError maps an error to a problem. Domain errors keep their message as
+// detail; any other error becomes a 500 whose detail does not leak internals.
+func FromError(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	for _, mapping := range domainErrors {
+		if errors.Is(err, mapping.err) {
+			return New(mapping.status, mapping.code, err.Error())
+		}
+	}
+	return New(http.StatusInternalServerError, CodeInternal, "The request could not be processed, quote the trace ID when reporting the problem")
+}
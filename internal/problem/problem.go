@@ -0,0 +1,75 @@
+// Package problem renders errors as RFC 7807 problem details
+// (application/problem+json) with a stable, machine-readable code.
+package problem
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// typePrefix prefixes the code to build the problem type URI
+const typePrefix = "urn:orders-service:problem:"
+
+// Problem is an RFC 7807 problem details object, extended with a stable
+// error code, per-field validation errors and the trace ID of the request
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	TraceID  string       `json:"trace_id,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes why a single request field is invalid
+type FieldError struct {
+	// Field is the JSON path of the field, e.g. items[0].quantity
+	Field string `json:"field"`
+	// Code is the violated rule, e.g. required or min
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// New creates a problem with the given status, code and detail. The title
+// is the status text.
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   typePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Error implements error
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Code + ": " + p.Detail
+	}
+	return p.Code
+}
+
+// Write renders the problem for the request, adding the request path and
+// trace ID, and aborts the handler chain
+func Write(c *gin.Context, p *Problem) {
+	p.Instance = c.Request.URL.Path
+	if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.HasTraceID() {
+		p.TraceID = spanContext.TraceID().String()
+	}
+
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// Error renders err as a problem, see FromError
+func Error(c *gin.Context, err error) {
+	Write(c, FromError(err))
+}
@@ -0,0 +1,116 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"casebrief/internal/models"
+	"casebrief/internal/repository"
+	"casebrief/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{repository.ErrOrderNotFound, http.StatusNotFound, CodeOrderNotFound},
+		{fmt.Errorf("%w: created -> shipped", service.ErrIllegalTransition), http.StatusConflict, CodeIllegalTransition},
+		{repository.ErrOrderStatusConflict, http.StatusConflict, CodeStatusConflict},
+		{fmt.Errorf("%w: XXX", service.ErrUnsupportedCurrency), http.StatusBadRequest, CodeUnsupportedCurrency},
+		{service.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidCursor},
+		{New(http.StatusConflict, CodeIdempotencyKeyInProgress, ""), http.StatusConflict, CodeIdempotencyKeyInProgress},
+		{fmt.Errorf("pq: connection refused"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			p := FromError(tt.err)
+			assert.Equal(t, tt.status, p.Status)
+			assert.Equal(t, tt.code, p.Code)
+			assert.Equal(t, typePrefix+tt.code, p.Type)
+			assert.Equal(t, http.StatusText(tt.status), p.Title)
+		})
+	}
+
+	// Internal errors are not leaked
+	assert.NotContains(t, FromError(fmt.Errorf("pq: connection refused")).Detail, "pq")
+}
+
+func bind(t *testing.T, body string) error {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+
+	var createReq models.CreateOrderRequest
+	err := c.ShouldBindJSON(&createReq)
+	require.Error(t, err)
+	return err
+}
+
+func TestFromBindingError_ValidationErrors(t *testing.T) {
+	err := bind(t, `{"items": [{"product_id": "product-1", "quantity": 0}], "currency": "EURO"}`)
+
+	p := FromBindingError(err)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, CodeValidationFailed, p.Code)
+	assert.ElementsMatch(t, []FieldError{
+		{Field: "customer_id", Code: "required", Message: "is required"},
+		{Field: "items[0].quantity", Code: "required", Message: "is required"},
+		{Field: "currency", Code: "len", Message: "must have length 3"},
+		{Field: "order_time", Code: "required", Message: "is required"},
+	}, p.Errors)
+}
+
+func TestFromBindingError_TypeAndSyntaxErrors(t *testing.T) {
+	p := FromBindingError(bind(t, `{"customer_id": 42}`))
+	assert.Equal(t, CodeValidationFailed, p.Code)
+	assert.Equal(t, []FieldError{{Field: "customer_id", Code: "type", Message: "must be a string"}}, p.Errors)
+
+	p = FromBindingError(bind(t, `{"customer_id": `))
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, CodeMalformedRequest, p.Code)
+	assert.Empty(t, p.Errors)
+}
+
+func TestWrite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID})
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/orders/order-1", nil).
+		WithContext(trace.ContextWithSpanContext(context.Background(), spanContext))
+
+	Error(c, repository.ErrOrderNotFound)
+
+	assert.True(t, c.IsAborted())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "urn:orders-service:problem:order_not_found", body["type"])
+	assert.Equal(t, "Not Found", body["title"])
+	assert.Equal(t, float64(404), body["status"])
+	assert.Equal(t, "order not found", body["detail"])
+	assert.Equal(t, "/orders/order-1", body["instance"])
+	assert.Equal(t, "order_not_found", body["code"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", body["trace_id"])
+}
@@ -0,0 +1,127 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report validation errors with the field names clients use
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(fieldName)
+	}
+}
+
+// fieldName returns the JSON (or query) name of a struct field
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// FromBindingError maps an error of gin's request binding to a 400 problem.
+// Validation failures list every invalid field.
+func FromBindingError(err error) *Problem {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		p := New(http.StatusBadRequest, CodeValidationFailed, "The request has invalid fields")
+		for _, fieldError := range validationErrors {
+			p.Errors = append(p.Errors, FieldError{
+				Field:   fieldPath(fieldError.Namespace()),
+				Code:    fieldError.Tag(),
+				Message: validationMessage(fieldError),
+			})
+		}
+		return p
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		p := New(http.StatusBadRequest, CodeValidationFailed, "The request has invalid fields")
+		p.Errors = []FieldError{{
+			Field:   typeError.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("must be a %s", jsonType(typeError.Type)),
+		}}
+		return p
+	}
+
+	return New(http.StatusBadRequest, CodeMalformedRequest, err.Error())
+}
+
+// fieldPath strips the struct name from a validator namespace, e.g.
+// CreateOrderRequest.items[0].quantity becomes items[0].quantity
+func fieldPath(namespace string) string {
+	_, path, found := strings.Cut(namespace, ".")
+	if !found {
+		return namespace
+	}
+	return path
+}
+
+// validationMessage describes a validation failure
+func validationMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return fmt.Sprintf("is required when %s is not given", toSnakeCase(fieldError.Param()))
+	case "min":
+		return fmt.Sprintf("must be at least %s", fieldError.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s", fieldError.Param())
+	case "len":
+		return fmt.Sprintf("must have length %s", fieldError.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(fieldError.Param(), " ", ", "))
+	default:
+		return fmt.Sprintf("failed the %s rule", fieldError.Tag())
+	}
+}
+
+// toSnakeCase converts a Go field name referenced by a rule parameter, such as
+// ProductID, to its JSON name product_id
+func toSnakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		upper := r >= 'A' && r <= 'Z'
+		if upper && i > 0 && (runes[i-1] < 'A' || runes[i-1] > 'Z' || (i+1 < len(runes) && runes[i+1] >= 'a' && runes[i+1] <= 'z')) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToLower(b.String())
+}
+
+// jsonType names the JSON type expected for a Go type
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
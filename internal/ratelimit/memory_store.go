@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the token buckets in process. Every replica limits on its
+// own, so clients get up to the limit times the number of replicas.
+type MemoryStore struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastPurge time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore creates a new empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tats: make(map[string]time.Time),
+		now:  time.Now,
+	}
+}
+
+// Take takes a token from the bucket of the key
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.purge(now)
+
+	tat := s.tats[key]
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(limit.interval())
+	if newTat.Sub(now) > limit.Period {
+		return deniedResult(tat, now, limit), nil
+	}
+	s.tats[key] = newTat
+	return allowedResult(newTat, now, limit), nil
+}
+
+// purge drops the buckets that are full again, at most once per purgeInterval
+func (s *MemoryStore) purge(now time.Time) {
+	if now.Sub(s.lastPurge) < purgeInterval {
+		return
+	}
+	s.lastPurge = now
+	for key, tat := range s.tats {
+		if !tat.After(now) {
+			delete(s.tats, key)
+		}
+	}
+}
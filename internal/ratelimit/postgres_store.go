@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// tracerName is the instrumentation name of the rate limit spans
+const tracerName = "casebrief/internal/ratelimit"
+
+// purgeBatchSize bounds the number of idle buckets deleted per purge
+const purgeBatchSize = 1000
+
+// takeQuery takes a token in a single statement, so concurrent requests of
+// all replicas are serialized by the row lock. The TAT is stored in
+// microseconds and computed from the database clock, so the clocks of the
+// replicas do not matter. No row is returned if the request is not allowed.
+// $2 is the interval and $3 the period of the limit in microseconds.
+const takeQuery = `
+	WITH clock AS (
+		SELECT (EXTRACT(EPOCH FROM clock_timestamp()) * 1000000)::BIGINT AS now
+	)
+	INSERT INTO rate_limits AS r (key, tat)
+	SELECT $1, clock.now + $2 FROM clock
+	ON CONFLICT (key) DO UPDATE
+	SET tat = GREATEST(r.tat, EXCLUDED.tat - $2) + $2
+	WHERE GREATEST(r.tat, EXCLUDED.tat - $2) + $2 - $3 <= EXCLUDED.tat - $2
+	RETURNING r.tat, (SELECT now FROM clock)
+`
+
+// deniedQuery reads the TAT of a bucket whose request was not allowed
+const deniedQuery = `
+	SELECT tat, (EXTRACT(EPOCH FROM clock_timestamp()) * 1000000)::BIGINT
+	FROM rate_limits
+	WHERE key = $1
+`
+
+// purgeQuery deletes buckets that are full again
+const purgeQuery = `
+	DELETE FROM rate_limits
+	WHERE key IN (
+		SELECT key
+		FROM rate_limits
+		WHERE tat < (EXTRACT(EPOCH FROM clock_timestamp()) * 1000000)::BIGINT
+		LIMIT $1
+	)
+`
+
+// PostgresStore keeps the token buckets in the rate_limits table, so the
+// limits hold across replicas
+type PostgresStore struct {
+	db        *sql.DB
+	logger    *zap.Logger
+	lastPurge atomic.Int64
+}
+
+// NewPostgresStore creates a new Postgres-backed store
+func NewPostgresStore(db *sql.DB, logger *zap.Logger) *PostgresStore {
+	return &PostgresStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Take takes a token from the bucket of the key
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (_ Result, err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "UPSERT rate_limits",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperation("UPSERT"),
+			semconv.DBSQLTable("rate_limits"),
+			semconv.DBStatement(strings.Join(strings.Fields(takeQuery), " ")),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	s.maybePurge()
+
+	interval := limit.interval().Microseconds()
+	period := limit.Period.Microseconds()
+
+	var tat, now int64
+	for attempt := 1; ; attempt++ {
+		err = s.db.QueryRowContext(ctx, takeQuery, key, interval, period).Scan(&tat, &now)
+		if err == nil {
+			return allowedResult(time.UnixMicro(tat), time.UnixMicro(now), limit), nil
+		}
+		if err != sql.ErrNoRows {
+			return Result{}, err
+		}
+
+		err = s.db.QueryRowContext(ctx, deniedQuery, key).Scan(&tat, &now)
+		if err == sql.ErrNoRows && attempt < 2 {
+			// Purged in the meantime, take a token from the new bucket
+			continue
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		return deniedResult(time.UnixMicro(tat), time.UnixMicro(now), limit), nil
+	}
+}
+
+// maybePurge deletes idle buckets in the background, at most once per
+// purgeInterval per replica
+func (s *PostgresStore) maybePurge() {
+	now := time.Now()
+	last := s.lastPurge.Load()
+	if now.Sub(time.Unix(0, last)) < purgeInterval || !s.lastPurge.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), purgeInterval)
+		defer cancel()
+		if _, err := s.db.ExecContext(ctx, purgeQuery, purgeBatchSize); err != nil {
+			s.logger.Warn("Failed to purge rate limit buckets", zap.Error(err))
+		}
+	}()
+}
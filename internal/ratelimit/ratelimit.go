@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"casebrief/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// Rate limit stores
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+// purgeInterval is how often the stores drop the state of idle clients
+const purgeInterval = time.Minute
+
+// Limit is a token bucket holding Requests tokens, refilled at Requests per
+// Period. A client can thus send Requests requests at once and then one every
+// Period/Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// IsZero reports whether the limit is unset, i.e. requests are not limited
+func (l Limit) IsZero() bool {
+	return l.Requests == 0
+}
+
+// interval is the time it takes to refill one token
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// String formats the limit like ParseLimit expects it
+func (l Limit) String() string {
+	return strconv.Itoa(l.Requests) + "/" + l.Period.String()
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	// Allowed is true if a token was taken
+	Allowed bool
+	// Limit is the size of the bucket
+	Limit int
+	// Remaining is the number of tokens left
+	Remaining int
+	// ResetAfter is the time until the bucket is full again
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next token is available, if the
+	// request was not allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets by key
+type Store interface {
+	// Take takes a token from the bucket of the key
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// NewStore creates the store selected by cfg.RateLimitStore. The Postgres
+// store shares the limits across replicas and requires a database.
+func NewStore(cfg *config.Config, db *sql.DB, logger *zap.Logger) (Store, error) {
+	switch cfg.RateLimitStore {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		if db == nil {
+			return nil, errors.New("rate limit store postgres requires the postgres storage backend")
+		}
+		return NewPostgresStore(db, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimitStore)
+	}
+}
+
+// The buckets are implemented with the generic cell rate algorithm (GCRA),
+// which is equivalent to a token bucket but only stores the theoretical
+// arrival time (TAT) of the next request: the time at which the bucket would
+// be full again. A request is allowed if the TAT it results in is at most
+// Period ahead of now.
+
+// allowedResult returns the result of a request that moved the TAT to tat
+func allowedResult(tat, now time.Time, limit Limit) Result {
+	remaining := int(now.Sub(tat.Add(-limit.Period)) / limit.interval())
+	return Result{
+		Allowed:    true,
+		Limit:      limit.Requests,
+		Remaining:  min(remaining, limit.Requests-1),
+		ResetAfter: tat.Sub(now),
+	}
+}
+
+// deniedResult returns the result of a request rejected at the TAT tat
+func deniedResult(tat, now time.Time, limit Limit) Result {
+	return Result{
+		Limit:      limit.Requests,
+		ResetAfter: tat.Sub(now),
+		RetryAfter: tat.Add(limit.interval() - limit.Period).Sub(now),
+	}
+}
+
+// Policy holds the limits of the routes
+type Policy struct {
+	// Default applies to routes without a limit of their own; requests are
+	// not limited if it is zero
+	Default Limit
+	// Routes holds limits by method and route template, e.g. "POST /orders"
+	Routes map[string]Limit
+}
+
+// LimitFor returns the limit of a route
+func (p Policy) LimitFor(method, route string) Limit {
+	if limit, ok := p.Routes[method+" "+route]; ok {
+		return limit
+	}
+	return p.Default
+}
+
+// ParsePolicy parses the default limit and the comma-separated route limits,
+// e.g. "POST /orders=60/1m, POST /orders/:id/cancel=10/1m". An empty default
+// leaves other routes unlimited.
+func ParsePolicy(defaultLimit, routeLimits string) (Policy, error) {
+	policy := Policy{Routes: make(map[string]Limit)}
+	if strings.TrimSpace(defaultLimit) != "" {
+		limit, err := ParseLimit(defaultLimit)
+		if err != nil {
+			return Policy{}, err
+		}
+		policy.Default = limit
+	}
+
+	for _, entry := range strings.Split(routeLimits, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		route, spec, ok := strings.Cut(entry, "=")
+		method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || !hasPath || method == "" || !strings.HasPrefix(strings.TrimSpace(path), "/") {
+			return Policy{}, fmt.Errorf("invalid route limit %q, expected METHOD /route=requests/period", entry)
+		}
+		limit, err := ParseLimit(spec)
+		if err != nil {
+			return Policy{}, err
+		}
+		policy.Routes[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = limit
+	}
+	return policy, nil
+}
+
+// ParseLimit parses a limit written as requests/period, e.g. "100/1m"
+func ParseLimit(spec string) (Limit, error) {
+	requests, period, ok := strings.Cut(strings.TrimSpace(spec), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected requests/period", spec)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: requests must be a positive number", spec)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: period must be a positive duration", spec)
+	}
+	if d/time.Duration(n) < time.Microsecond {
+		return Limit{}, fmt.Errorf("invalid limit %q: more than one request per microsecond", spec)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
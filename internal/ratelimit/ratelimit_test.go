@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("600/1m", "POST /orders=60/1m, post /orders/:id/cancel=10/30s")
+	require.NoError(t, err)
+
+	assert.Equal(t, Limit{Requests: 60, Period: time.Minute}, policy.LimitFor("POST", "/orders"))
+	assert.Equal(t, Limit{Requests: 10, Period: 30 * time.Second}, policy.LimitFor("POST", "/orders/:id/cancel"))
+	assert.Equal(t, Limit{Requests: 600, Period: time.Minute}, policy.LimitFor("GET", "/orders"))
+
+	unlimited, err := ParsePolicy("", "")
+	require.NoError(t, err)
+	assert.True(t, unlimited.LimitFor("GET", "/orders").IsZero())
+}
+
+func TestParsePolicy_RejectsInvalidLimits(t *testing.T) {
+	for _, tc := range []struct{ defaultLimit, routeLimits string }{
+		{"100", ""},
+		{"0/1m", ""},
+		{"10/0s", ""},
+		{"10/minute", ""},
+		{"10000000/1s", ""},
+		{"", "POST /orders"},
+		{"", "/orders=10/1m"},
+		{"", "POST orders=10/1m"},
+	} {
+		_, err := ParsePolicy(tc.defaultLimit, tc.routeLimits)
+		assert.Error(t, err, "%q %q", tc.defaultLimit, tc.routeLimits)
+	}
+}
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+	ctx := context.Background()
+
+	// The full bucket allows a burst of 3 requests
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := store.Take(ctx, "client", limit)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+
+	result, err := store.Take(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.ResetAfter)
+
+	// Other keys have their own bucket
+	result, err = store.Take(ctx, "other-client", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// One token is refilled per second
+	now = now.Add(time.Second)
+	result, err = store.Take(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result, err = store.Take(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+}
+
+func TestMemoryStore_PurgesFullBuckets(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 10, Period: time.Second}
+
+	_, err := store.Take(context.Background(), "idle-client", limit)
+	require.NoError(t, err)
+
+	now = now.Add(purgeInterval)
+	_, err = store.Take(context.Background(), "client", limit)
+	require.NoError(t, err)
+
+	assert.NotContains(t, store.tats, "idle-client")
+	assert.Contains(t, store.tats, "client")
+}
+
+func TestPostgresStore_Take(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewPostgresStore(db, zap.NewNop())
+	store.lastPurge.Store(time.Now().UnixNano())
+	limit := Limit{Requests: 10, Period: 10 * time.Second}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Allowed: the TAT moved to now + 3s, so 7 tokens are left
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO rate_limits")).
+		WithArgs("client", int64(time.Second/time.Microsecond), int64(10*time.Second/time.Microsecond)).
+		WillReturnRows(sqlmock.NewRows([]string{"tat", "now"}).AddRow(now.Add(3*time.Second).UnixMicro(), now.UnixMicro()))
+
+	result, err := store.Take(context.Background(), "client", limit)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Limit: 10, Remaining: 7, ResetAfter: 3 * time.Second}, result)
+
+	// Denied: the update is skipped and the TAT is read
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO rate_limits")).
+		WillReturnRows(sqlmock.NewRows([]string{"tat", "now"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT tat")).
+		WithArgs("client").
+		WillReturnRows(sqlmock.NewRows([]string{"tat", "now"}).AddRow(now.Add(10*time.Second).UnixMicro(), now.UnixMicro()))
+
+	result, err = store.Take(context.Background(), "client", limit)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Limit: 10, ResetAfter: 10 * time.Second, RetryAfter: time.Second}, result)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
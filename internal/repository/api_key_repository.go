@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"casebrief/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// APIKeyRepository handles database operations for API keys
+type APIKeyRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *sql.DB, logger *zap.Logger) *APIKeyRepository {
+	return &APIKeyRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreateAPIKey stores a new API key. The caller hashes the key.
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) (err error) {
+	query := `
+		INSERT INTO api_keys (id, name, key_hash, scopes, tenant_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	ctx, span := startSpan(ctx, "INSERT", "api_keys", query)
+	defer func() { endSpan(span, err) }()
+
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	key.CreatedAt = time.Now()
+
+	if _, err := r.db.ExecContext(ctx, query,
+		key.ID,
+		key.Name,
+		key.KeyHash,
+		pq.Array(key.Scopes),
+		sql.NullString{String: key.TenantID, Valid: key.TenantID != ""},
+		key.ExpiresAt,
+		key.CreatedAt,
+	); err != nil {
+		r.logger.Error("Failed to create API key",
+			zap.Error(err),
+			zap.String("api_key_name", key.Name),
+		)
+		return err
+	}
+	setRowCount(span, 1)
+
+	return nil
+}
+
+// GetAPIKeyByHash retrieves the API key with the given SHA-256 hash,
+// including expired and revoked keys
+func (r *APIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (_ *models.APIKey, err error) {
+	query := `
+		SELECT id, name, key_hash, scopes, COALESCE(tenant_id, ''), expires_at, revoked_at, created_at
+		FROM api_keys
+		WHERE key_hash = $1
+	`
+
+	ctx, span := startSpan(ctx, "SELECT", "api_keys", query)
+	defer func() { endSpan(span, err) }()
+
+	key := &models.APIKey{}
+	err = r.db.QueryRowContext(ctx, query, keyHash).Scan(
+		&key.ID,
+		&key.Name,
+		&key.KeyHash,
+		pq.Array(&key.Scopes),
+		&key.TenantID,
+		&key.ExpiresAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		setRowCount(span, 0)
+		return nil, ErrAPIKeyNotFound
+	}
+
+	if err != nil {
+		r.logger.Error("Failed to get API key",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	setRowCount(span, 1)
+
+	return key, nil
+}
@@ -5,7 +5,11 @@ import "errors"
 var (
 	// ErrOrderNotFound is returned when an order is not found
 	ErrOrderNotFound = errors.New("order not found")
-	// ErrIdempotencyNotFound is returned when an idempotency record is not found or expired
-	ErrIdempotencyNotFound = errors.New("idempotency record not found")
+	// ErrOrderStatusConflict is returned when an order's status changed since it was read
+	ErrOrderStatusConflict = errors.New("order status changed concurrently")
+	// ErrOrderVersionMismatch is returned when an order changed since the version the caller read
+	ErrOrderVersionMismatch = errors.New("order version does not match")
+	// ErrAPIKeyNotFound is returned when no API key has the given hash
+	ErrAPIKeyNotFound = errors.New("API key not found")
 )
 
@@ -0,0 +1,300 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"casebrief/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// Idempotency key statuses
+const (
+	idempotencyStatusProcessing = "processing"
+	idempotencyStatusCompleted  = "completed"
+)
+
+// ErrIdempotencyReservationLost is returned when a request completes or
+// releases an idempotency key it no longer holds, because its reservation
+// expired and another request took the key over
+var ErrIdempotencyReservationLost = errors.New("idempotency key reservation lost")
+
+// reserveAttempts bounds how often a reservation is retried when the key
+// disappears between the insert and the lookup
+const reserveAttempts = 3
+
+// IdempotencyResponse is a stored HTTP response replayed for an idempotency key
+type IdempotencyResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// IdempotencyRecord is a request stored under an idempotency key
+type IdempotencyRecord struct {
+	// RequestHash is the fingerprint of the request
+	RequestHash string
+	// Completed is false while the request is still being processed
+	Completed bool
+	// Response is the stored response of a completed request
+	Response *IdempotencyResponse
+}
+
+// IdempotencyRepository handles database operations for idempotency keys
+type IdempotencyRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewIdempotencyRepository creates a new idempotency repository
+func NewIdempotencyRepository(db *sql.DB, logger *zap.Logger) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ReserveIdempotencyKey atomically claims an idempotency key before the request
+// is processed. It returns a nil record if the key was reserved for the caller,
+// who must then call CompleteIdempotencyKey or ReleaseIdempotencyKey with the
+// same token, a value unique to the request. Otherwise
+// it returns the record of the request holding the key, which is either completed
+// and can be replayed, or still in progress. A reservation that is neither
+// completed nor released within lockTimeout (e.g. because the process crashed)
+// is taken over by the next request. Keys are scoped to the tenant of the
+// context; it returns tenant.ErrMissing if there is none.
+func (r *IdempotencyRepository) ReserveIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, requestHash, token string, lockTimeout time.Duration) (*IdempotencyRecord, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
+	}
+
+	reserveQuery := `
+		INSERT INTO idempotency_keys (tenant_id, endpoint_name, endpoint_scheme, key, request_hash, status, reservation_token, locked_at, valid_to, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $8)
+		ON CONFLICT (tenant_id, endpoint_name, endpoint_scheme, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status = EXCLUDED.status,
+			reservation_token = EXCLUDED.reservation_token, locked_at = EXCLUDED.locked_at,
+			response_status = NULL, response_headers = NULL, response_body = NULL,
+			valid_to = EXCLUDED.valid_to, created_at = EXCLUDED.created_at
+		WHERE idempotency_keys.valid_to <= EXCLUDED.created_at
+		RETURNING key
+	`
+
+	existingQuery := `
+		SELECT status, COALESCE(request_hash, ''), response_status, response_headers, response_body
+		FROM idempotency_keys
+		WHERE tenant_id = $1 AND endpoint_name = $2 AND endpoint_scheme = $3 AND key = $4
+	`
+
+	for attempt := 1; ; attempt++ {
+		now := time.Now()
+		var reserved string
+		err := r.db.QueryRowContext(ctx, reserveQuery,
+			tenantID, endpointName, endpointScheme, key, requestHash, idempotencyStatusProcessing, token, now, now.Add(lockTimeout),
+		).Scan(&reserved)
+		if err == nil {
+			return nil, nil
+		}
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to reserve idempotency key",
+				zap.Error(err),
+				zap.String("endpoint_name", endpointName),
+				zap.String("endpoint_scheme", endpointScheme),
+				zap.String("idempotency_key", key),
+			)
+			return nil, err
+		}
+
+		// The key is held by a live record, either completed or still processing
+		var (
+			status         string
+			responseStatus sql.NullInt64
+			headersJSON    []byte
+			body           []byte
+		)
+		record := &IdempotencyRecord{}
+		err = r.db.QueryRowContext(ctx, existingQuery, tenantID, endpointName, endpointScheme, key).
+			Scan(&status, &record.RequestHash, &responseStatus, &headersJSON, &body)
+		if err == sql.ErrNoRows && attempt < reserveAttempts {
+			// Released in the meantime, try to reserve it again
+			continue
+		}
+		if err != nil {
+			r.logger.Error("Failed to get idempotency record",
+				zap.Error(err),
+				zap.String("endpoint_name", endpointName),
+				zap.String("endpoint_scheme", endpointScheme),
+				zap.String("idempotency_key", key),
+			)
+			return nil, err
+		}
+
+		record.Completed = status == idempotencyStatusCompleted
+		if record.Completed {
+			record.Response = &IdempotencyResponse{
+				StatusCode: int(responseStatus.Int64),
+				Body:       body,
+			}
+			if headersJSON != nil {
+				if err := json.Unmarshal(headersJSON, &record.Response.Header); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return record, nil
+	}
+}
+
+// CompleteIdempotencyKey stores the response of a key reserved with token,
+// which is then replayed for validityDuration. It returns
+// ErrIdempotencyReservationLost if the key is no longer reserved with token.
+func (r *IdempotencyRepository) CompleteIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, token string, response *IdempotencyResponse, validityDuration time.Duration) error {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return tenant.ErrMissing
+	}
+
+	headersJSON, err := json.Marshal(response.Header)
+	if err != nil {
+		r.logger.Error("Failed to marshal response headers for idempotency",
+			zap.Error(err),
+		)
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status = $6, response_status = $7, response_headers = $8, response_body = $9, valid_to = $10, locked_at = NULL
+		WHERE tenant_id = $1 AND endpoint_name = $2 AND endpoint_scheme = $3 AND key = $4
+			AND reservation_token = $5 AND status = $11
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		tenantID, endpointName, endpointScheme, key, token, idempotencyStatusCompleted,
+		response.StatusCode, headersJSON, response.Body, time.Now().Add(validityDuration), idempotencyStatusProcessing,
+	)
+	if err == nil {
+		err = reservationHeld(result)
+	}
+	if err != nil {
+		r.logger.Error("Failed to store idempotency response",
+			zap.Error(err),
+			zap.String("endpoint_name", endpointName),
+			zap.String("endpoint_scheme", endpointScheme),
+			zap.String("idempotency_key", key),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a reservation made with token whose request
+// failed, so the client can retry with the same key. It returns
+// ErrIdempotencyReservationLost if the key is no longer reserved with token.
+func (r *IdempotencyRepository) ReleaseIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, token string) error {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return tenant.ErrMissing
+	}
+
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE tenant_id = $1 AND endpoint_name = $2 AND endpoint_scheme = $3 AND key = $4
+			AND reservation_token = $5 AND status = $6
+	`
+
+	result, err := r.db.ExecContext(ctx, query, tenantID, endpointName, endpointScheme, key, token, idempotencyStatusProcessing)
+	if err == nil {
+		err = reservationHeld(result)
+	}
+	if err != nil {
+		r.logger.Error("Failed to release idempotency key",
+			zap.Error(err),
+			zap.String("endpoint_name", endpointName),
+			zap.String("endpoint_scheme", endpointScheme),
+			zap.String("idempotency_key", key),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// reservationHeld returns ErrIdempotencyReservationLost if a statement
+// conditional on the reservation token changed no row
+func reservationHeld(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrIdempotencyReservationLost
+	}
+	return nil
+}
+
+// idempotencyPurgeLockID is the Postgres advisory lock held while expired
+// idempotency keys are purged, so only one replica purges at a time
+const idempotencyPurgeLockID int64 = 0x6964656d706f74 // "idempot"
+
+// TryLockIdempotencyPurge tries to take the advisory lock coordinating purges
+// across replicas without waiting for it. If acquired is true the caller must
+// call unlock once done.
+func (r *IdempotencyRepository) TryLockIdempotencyPurge(ctx context.Context) (unlock func(), acquired bool, err error) {
+	// Session-level advisory locks belong to a connection, so keep one aside
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, idempotencyPurgeLockID).Scan(&acquired); err != nil || !acquired {
+		conn.Close()
+		return nil, false, err
+	}
+
+	unlock = func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, idempotencyPurgeLockID); err != nil {
+			r.logger.Warn("Failed to release idempotency purge lock, discarding connection",
+				zap.Error(err),
+			)
+			// Returning the connection to the pool would keep the lock held
+			_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+	return unlock, true, nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes at most limit keys that expired before
+// the given time, across all tenants, and returns the number of rows deleted
+func (r *IdempotencyRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE (tenant_id, endpoint_name, endpoint_scheme, key) IN (
+			SELECT tenant_id, endpoint_name, endpoint_scheme, key
+			FROM idempotency_keys
+			WHERE valid_to < $1
+			ORDER BY valid_to
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		r.logger.Error("Failed to delete expired idempotency keys",
+			zap.Error(err),
+		)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
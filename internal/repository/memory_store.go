@@ -0,0 +1,538 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"casebrief/internal/models"
+	"casebrief/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+// memoryOutboxEvent is an outbox event with its delivery state
+type memoryOutboxEvent struct {
+	event        models.OutboxEvent
+	lockedUntil  time.Time
+	processedAt  time.Time
+	deadLettered bool
+}
+
+// memoryIdempotencyKey is an idempotency key with its stored response
+type memoryIdempotencyKey struct {
+	record  IdempotencyRecord
+	validTo time.Time
+	// token identifies the request holding the reservation
+	token string
+}
+
+// MemoryStore is a thread-safe in-memory implementation of OrderStore,
+// OutboxStore, IdempotencyStore and APIKeyStore with the same semantics as
+// the Postgres repositories, including the scoping of orders and idempotency
+// keys by the tenant of the context. It is meant for tests and local
+// development; nothing survives a restart.
+type MemoryStore struct {
+	mu              sync.Mutex
+	orders          map[string]*models.Order
+	history         []*models.OrderStatusChange
+	outbox          []*memoryOutboxEvent
+	outboxSeq       int64
+	idempotencyKeys map[string]*memoryIdempotencyKey
+	apiKeys         map[string]*models.APIKey
+	purgeMu         sync.Mutex
+}
+
+// NewMemoryStore creates a new empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		orders:          make(map[string]*models.Order),
+		idempotencyKeys: make(map[string]*memoryIdempotencyKey),
+		apiKeys:         make(map[string]*models.APIKey),
+	}
+}
+
+// CreateOrder stores a new order with its items and the optional outbox event
+func (s *MemoryStore) CreateOrder(ctx context.Context, order *models.Order, event *models.OutboxEvent) error {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return tenant.ErrMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if order.ID == "" {
+		order.ID = uuid.New().String()
+	}
+	if _, exists := s.orders[order.ID]; exists {
+		return fmt.Errorf("order %s already exists", order.ID)
+	}
+	if order.OrderTime.IsZero() {
+		order.OrderTime = now
+	}
+	order.TenantID = tenantID
+	order.CreatedAt = now
+	order.UpdatedAt = now
+	order.Status = models.OrderStatusCreated
+	order.Version = 1
+
+	s.orders[order.ID] = order.Clone()
+	if event != nil {
+		s.appendOutboxEvent(event, now)
+	}
+	return nil
+}
+
+// GetOrderByID retrieves an order with its items by its ID
+func (s *MemoryStore) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.tenantOrder(tenantID, id)
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return order.Clone(), nil
+}
+
+// ListOrders retrieves a page of orders matching the filter, newest first
+func (s *MemoryStore) ListOrders(ctx context.Context, filter OrderFilter) ([]*models.Order, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := s.filterOrders(tenantID, filter, true)
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].CreatedAt.After(orders[j].CreatedAt)
+		}
+		return orders[i].ID > orders[j].ID
+	})
+	if filter.Limit > 0 && len(orders) > filter.Limit {
+		orders = orders[:filter.Limit]
+	}
+
+	page := make([]*models.Order, 0, len(orders))
+	for _, order := range orders {
+		page = append(page, order.Clone())
+	}
+	return page, nil
+}
+
+// CountOrders returns the number of orders matching the filter, ignoring the cursor and limit
+func (s *MemoryStore) CountOrders(ctx context.Context, filter OrderFilter) (int64, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return 0, tenant.ErrMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.filterOrders(tenantID, filter, false))), nil
+}
+
+// UpdateOrderStatus moves an order from one status to another, recording the
+// change in the status history together with the optional outbox event. It
+// returns ErrOrderStatusConflict if the order is no longer in the expected status.
+func (s *MemoryStore) UpdateOrderStatus(ctx context.Context, id, fromStatus, toStatus, changedBy, reason string, event *models.OutboxEvent) (*models.Order, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.tenantOrder(tenantID, id)
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	if order.Status != fromStatus {
+		return nil, ErrOrderStatusConflict
+	}
+
+	now := time.Now()
+	order.Status = toStatus
+	order.UpdatedAt = now
+	order.Version++
+	s.history = append(s.history, &models.OrderStatusChange{
+		ID:         int64(len(s.history) + 1),
+		OrderID:    id,
+		FromStatus: fromStatus,
+		ToStatus:   toStatus,
+		ChangedBy:  changedBy,
+		Reason:     reason,
+		ChangedAt:  now,
+	})
+	if event != nil {
+		s.appendOutboxEvent(event, now)
+	}
+	return order.Clone(), nil
+}
+
+// UpdateOrder replaces the lines, totals and shipping address of an order and
+// increments its version, together with the optional outbox event. It returns
+// ErrOrderVersionMismatch if the order is no longer at expectedVersion.
+func (s *MemoryStore) UpdateOrder(ctx context.Context, order *models.Order, expectedVersion int64, event *models.OutboxEvent) (*models.Order, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tenantOrder(tenantID, order.ID)
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	if stored.Version != expectedVersion {
+		return nil, ErrOrderVersionMismatch
+	}
+
+	now := time.Now()
+	changes := order.Clone()
+	stored.ProductID = changes.ProductID
+	stored.Quantity = changes.Quantity
+	stored.TotalPrice = changes.TotalPrice
+	stored.ShippingAddress = changes.ShippingAddress
+	stored.Items = changes.Items
+	stored.UpdatedAt = now
+	stored.Version++
+	if event != nil {
+		s.appendOutboxEvent(event, now)
+	}
+	return stored.Clone(), nil
+}
+
+// GetOrderStatusHistory retrieves the status changes of an order, oldest first
+func (s *MemoryStore) GetOrderStatusHistory(ctx context.Context, orderID string) ([]*models.OrderStatusChange, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := []*models.OrderStatusChange{}
+	if _, ok := s.tenantOrder(tenantID, orderID); !ok {
+		return history, nil
+	}
+	for _, change := range s.history {
+		if change.OrderID == orderID {
+			changeCopy := *change
+			history = append(history, &changeCopy)
+		}
+	}
+	return history, nil
+}
+
+// ClaimOutboxEvents reserves up to limit pending events for the lease duration
+func (s *MemoryStore) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	claimed := []*models.OutboxEvent{}
+	for _, pending := range s.outbox {
+		if len(claimed) == limit {
+			break
+		}
+		if !pending.processedAt.IsZero() || pending.deadLettered || pending.lockedUntil.After(now) {
+			continue
+		}
+		pending.lockedUntil = now.Add(lease)
+		event := pending.event
+		claimed = append(claimed, &event)
+	}
+	return claimed, nil
+}
+
+// MarkOutboxEventProcessed marks an event as delivered so it is never claimed again
+func (s *MemoryStore) MarkOutboxEventProcessed(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, pending := range s.outbox {
+		if pending.event.ID == id {
+			pending.processedAt = time.Now()
+			pending.lockedUntil = time.Time{}
+		}
+	}
+	return nil
+}
+
+// MarkOutboxEventFailed counts a failed delivery attempt of an event, see
+// OutboxRepository.MarkOutboxEventFailed
+func (s *MemoryStore) MarkOutboxEventFailed(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, pending := range s.outbox {
+		if pending.event.ID == id && pending.processedAt.IsZero() {
+			pending.event.Attempts++
+		}
+	}
+	return nil
+}
+
+// DeadLetterOutboxEvent stops the delivery of a pending event, see
+// OutboxRepository.DeadLetterOutboxEvent
+func (s *MemoryStore) DeadLetterOutboxEvent(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, pending := range s.outbox {
+		if pending.event.ID == id && pending.processedAt.IsZero() {
+			pending.deadLettered = true
+			pending.lockedUntil = time.Time{}
+		}
+	}
+	return nil
+}
+
+// DeleteProcessedOutboxEvents deletes at most limit events processed before
+// the given time
+func (s *MemoryStore) DeleteProcessedOutboxEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	kept := s.outbox[:0]
+	for _, pending := range s.outbox {
+		if deleted < int64(limit) && !pending.processedAt.IsZero() && pending.processedAt.Before(before) {
+			deleted++
+			continue
+		}
+		kept = append(kept, pending)
+	}
+	s.outbox = kept
+	return deleted, nil
+}
+
+// ReserveIdempotencyKey atomically claims an idempotency key, see
+// IdempotencyRepository.ReserveIdempotencyKey
+func (s *MemoryStore) ReserveIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, requestHash, token string, lockTimeout time.Duration) (*IdempotencyRecord, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	id := idempotencyKeyID(tenantID, endpointName, endpointScheme, key)
+	if existing, ok := s.idempotencyKeys[id]; ok && existing.validTo.After(now) {
+		record := existing.record
+		return &record, nil
+	}
+
+	s.idempotencyKeys[id] = &memoryIdempotencyKey{
+		record:  IdempotencyRecord{RequestHash: requestHash},
+		validTo: now.Add(lockTimeout),
+		token:   token,
+	}
+	return nil, nil
+}
+
+// CompleteIdempotencyKey stores the response of a key reserved with token, see
+// IdempotencyRepository.CompleteIdempotencyKey
+func (s *MemoryStore) CompleteIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, token string, response *IdempotencyResponse, validityDuration time.Duration) error {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return tenant.ErrMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.idempotencyKeys[idempotencyKeyID(tenantID, endpointName, endpointScheme, key)]
+	if !ok || stored.record.Completed || stored.token != token {
+		return ErrIdempotencyReservationLost
+	}
+	stored.record.Completed = true
+	stored.record.Response = &IdempotencyResponse{
+		StatusCode: response.StatusCode,
+		Header:     response.Header.Clone(),
+		Body:       append([]byte(nil), response.Body...),
+	}
+	stored.validTo = time.Now().Add(validityDuration)
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a reservation made with token whose request
+// failed, see IdempotencyRepository.ReleaseIdempotencyKey
+func (s *MemoryStore) ReleaseIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, token string) error {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return tenant.ErrMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := idempotencyKeyID(tenantID, endpointName, endpointScheme, key)
+	stored, ok := s.idempotencyKeys[id]
+	if !ok || stored.record.Completed || stored.token != token {
+		return ErrIdempotencyReservationLost
+	}
+	delete(s.idempotencyKeys, id)
+	return nil
+}
+
+// TryLockIdempotencyPurge serializes purges within the process
+func (s *MemoryStore) TryLockIdempotencyPurge(ctx context.Context) (func(), bool, error) {
+	if !s.purgeMu.TryLock() {
+		return nil, false, nil
+	}
+	return s.purgeMu.Unlock, true, nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes at most limit keys that expired before
+// the given time and returns the number of keys deleted
+func (s *MemoryStore) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, stored := range s.idempotencyKeys {
+		if deleted == int64(limit) {
+			break
+		}
+		if stored.validTo.Before(before) {
+			delete(s.idempotencyKeys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// CreateAPIKey stores a new API key. The caller hashes the key.
+func (s *MemoryStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.apiKeys {
+		if existing.Name == key.Name || existing.KeyHash == key.KeyHash {
+			return fmt.Errorf("API key %s already exists", key.Name)
+		}
+	}
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	key.CreatedAt = time.Now()
+
+	stored := *key
+	stored.Scopes = append([]string(nil), key.Scopes...)
+	s.apiKeys[key.KeyHash] = &stored
+	return nil
+}
+
+// GetAPIKeyByHash retrieves the API key with the given SHA-256 hash
+func (s *MemoryStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.apiKeys[keyHash]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	key := *stored
+	key.Scopes = append([]string(nil), stored.Scopes...)
+	return &key, nil
+}
+
+// appendOutboxEvent assigns the next ID to the event and adds it to the outbox
+func (s *MemoryStore) appendOutboxEvent(event *models.OutboxEvent, now time.Time) {
+	s.outboxSeq++
+	event.ID = s.outboxSeq
+	event.CreatedAt = now
+	s.outbox = append(s.outbox, &memoryOutboxEvent{event: *event})
+}
+
+// tenantOrder returns the order with the given ID if it belongs to the tenant
+func (s *MemoryStore) tenantOrder(tenantID, id string) (*models.Order, bool) {
+	order, ok := s.orders[id]
+	if !ok || order.TenantID != tenantID {
+		return nil, false
+	}
+	return order, true
+}
+
+// filterOrders returns the orders of the tenant matching the filter, in no
+// particular order. The cursor condition is only applied when withCursor is true.
+func (s *MemoryStore) filterOrders(tenantID string, filter OrderFilter, withCursor bool) []*models.Order {
+	matches := []*models.Order{}
+	for _, order := range s.orders {
+		if order.TenantID == tenantID && filter.matches(order, withCursor) {
+			matches = append(matches, order)
+		}
+	}
+	return matches
+}
+
+// matches is the in-memory equivalent of the where clause built by where
+func (f OrderFilter) matches(order *models.Order, withCursor bool) bool {
+	if f.CustomerID != "" && order.CustomerID != f.CustomerID {
+		return false
+	}
+	if f.ProductID != "" && !hasProduct(order, f.ProductID) {
+		return false
+	}
+	if f.Status != "" && order.Status != f.Status {
+		return false
+	}
+	if !f.OrderTimeFrom.IsZero() && order.OrderTime.Before(f.OrderTimeFrom) {
+		return false
+	}
+	if !f.OrderTimeTo.IsZero() && !order.OrderTime.Before(f.OrderTimeTo) {
+		return false
+	}
+	if !f.CreatedFrom.IsZero() && order.CreatedAt.Before(f.CreatedFrom) {
+		return false
+	}
+	if !f.CreatedTo.IsZero() && !order.CreatedAt.Before(f.CreatedTo) {
+		return false
+	}
+	if withCursor && f.AfterID != "" {
+		// (created_at, id) < (AfterCreatedAt, AfterID)
+		if order.CreatedAt.After(f.AfterCreatedAt) {
+			return false
+		}
+		if order.CreatedAt.Equal(f.AfterCreatedAt) && order.ID >= f.AfterID {
+			return false
+		}
+	}
+	return true
+}
+
+// hasProduct reports whether one of the order's lines is for the product
+func hasProduct(order *models.Order, productID string) bool {
+	for _, item := range order.Items {
+		if item.ProductID == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotencyKeyID identifies a key within the idempotency key map
+func idempotencyKeyID(tenantID, endpointName, endpointScheme, key string) string {
+	return tenantID + " " + endpointScheme + " " + endpointName + " " + key
+}
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"casebrief/internal/models"
+	"casebrief/internal/tenant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_IdempotencyKeyExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	record, err := store.ReserveIdempotencyKey(ctx, "/orders", "POST", "key-1", "hash", "token-1", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	// A second request sees the reservation in progress
+	record, err = store.ReserveIdempotencyKey(ctx, "/orders", "POST", "key-1", "hash", "token-1", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.False(t, record.Completed)
+
+	response := &IdempotencyResponse{StatusCode: http.StatusCreated, Body: []byte(`{}`)}
+	require.NoError(t, store.CompleteIdempotencyKey(ctx, "/orders", "POST", "key-1", "token-1", response, time.Millisecond))
+
+	record, err = store.ReserveIdempotencyKey(ctx, "/orders", "POST", "key-1", "hash", "token-1", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.True(t, record.Completed)
+	assert.Equal(t, http.StatusCreated, record.Response.StatusCode)
+
+	// Once expired the key is purged and can be reserved again
+	time.Sleep(5 * time.Millisecond)
+	deleted, err := store.DeleteExpiredIdempotencyKeys(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	record, err = store.ReserveIdempotencyKey(ctx, "/orders", "POST", "key-1", "other-hash", "token-2", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
+
+func TestMemoryStore_ExpiredReservationIsTakenOver(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	_, err := store.ReserveIdempotencyKey(ctx, "/orders", "POST", "key-1", "hash", "slow", time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	record, err := store.ReserveIdempotencyKey(ctx, "/orders", "POST", "key-1", "hash", "retry", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	// The slow request no longer holds the key and can neither release nor
+	// complete it
+	assert.ErrorIs(t, store.ReleaseIdempotencyKey(ctx, "/orders", "POST", "key-1", "slow"), ErrIdempotencyReservationLost)
+	slow := &IdempotencyResponse{StatusCode: http.StatusInternalServerError, Body: []byte(`{}`)}
+	assert.ErrorIs(t, store.CompleteIdempotencyKey(ctx, "/orders", "POST", "key-1", "slow", slow, time.Minute), ErrIdempotencyReservationLost)
+
+	response := &IdempotencyResponse{StatusCode: http.StatusCreated, Body: []byte(`{}`)}
+	require.NoError(t, store.CompleteIdempotencyKey(ctx, "/orders", "POST", "key-1", "retry", response, time.Minute))
+
+	record, err = store.ReserveIdempotencyKey(ctx, "/orders", "POST", "key-1", "hash", "token-3", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.True(t, record.Completed)
+	assert.Equal(t, http.StatusCreated, record.Response.StatusCode)
+
+	// A completed key cannot be released
+	assert.ErrorIs(t, store.ReleaseIdempotencyKey(ctx, "/orders", "POST", "key-1", "retry"), ErrIdempotencyReservationLost)
+}
+
+func TestMemoryStore_UpdateOrderStatus(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	order := &models.Order{CustomerID: "customer-1", Items: []models.OrderItem{{ProductID: "product-1", Quantity: 1}}}
+	require.NoError(t, store.CreateOrder(ctx, order, nil))
+
+	// Returned orders do not share memory with the store
+	order.Items[0].Quantity = 5
+	stored, err := store.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.Items[0].Quantity)
+
+	_, err = store.UpdateOrderStatus(ctx, order.ID, models.OrderStatusConfirmed, models.OrderStatusPaid, "ops", "", nil)
+	assert.ErrorIs(t, err, ErrOrderStatusConflict)
+
+	_, err = store.UpdateOrderStatus(ctx, "missing", models.OrderStatusCreated, models.OrderStatusConfirmed, "ops", "", nil)
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+
+	updated, err := store.UpdateOrderStatus(ctx, order.ID, models.OrderStatusCreated, models.OrderStatusConfirmed, "ops", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusConfirmed, updated.Status)
+
+	history, err := store.GetOrderStatusHistory(ctx, order.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, models.OrderStatusCreated, history[0].FromStatus)
+}
+
+func TestMemoryStore_UpdateOrder(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	order := &models.Order{CustomerID: "customer-1", Items: []models.OrderItem{{ProductID: "product-1", Quantity: 1}}}
+	require.NoError(t, store.CreateOrder(ctx, order, nil))
+	assert.Equal(t, int64(1), order.Version)
+
+	// Status changes bump the version too
+	_, err := store.UpdateOrderStatus(ctx, order.ID, models.OrderStatusCreated, models.OrderStatusConfirmed, "ops", "", nil)
+	require.NoError(t, err)
+
+	changes := &models.Order{ID: order.ID, ProductID: "product-2", Quantity: 2, Items: []models.OrderItem{{ProductID: "product-2", Quantity: 2}}}
+	_, err = store.UpdateOrder(ctx, changes, 1, nil)
+	assert.ErrorIs(t, err, ErrOrderVersionMismatch)
+
+	_, err = store.UpdateOrder(ctx, &models.Order{ID: "missing"}, 1, nil)
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+
+	updated, err := store.UpdateOrder(ctx, changes, 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), updated.Version)
+	assert.Equal(t, "product-2", updated.ProductID)
+	assert.Equal(t, models.OrderStatusConfirmed, updated.Status)
+	assert.Equal(t, "customer-1", updated.CustomerID)
+}
+
+func TestMemoryStore_ListOrdersFilter(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	for _, customer := range []string{"customer-1", "customer-2", "customer-1"} {
+		require.NoError(t, store.CreateOrder(ctx, &models.Order{CustomerID: customer, Items: []models.OrderItem{{ProductID: "product-" + customer}}}, nil))
+	}
+
+	orders, err := store.ListOrders(ctx, OrderFilter{CustomerID: "customer-1", Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, orders, 2)
+
+	orders, err = store.ListOrders(ctx, OrderFilter{ProductID: "product-customer-2", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "customer-2", orders[0].CustomerID)
+}
+
+func TestMemoryStore_IsolatesTenants(t *testing.T) {
+	store := NewMemoryStore()
+	acme := tenant.NewContext(context.Background(), "acme")
+	globex := tenant.NewContext(context.Background(), "globex")
+
+	order := &models.Order{CustomerID: "customer-1", Items: []models.OrderItem{{ProductID: "product-1", Quantity: 1}}}
+	require.NoError(t, store.CreateOrder(acme, order, nil))
+	assert.Equal(t, "acme", order.TenantID)
+
+	_, err := store.GetOrderByID(globex, order.ID)
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+	_, err = store.UpdateOrderStatus(globex, order.ID, models.OrderStatusCreated, models.OrderStatusConfirmed, "ops", "", nil)
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+	orders, err := store.ListOrders(globex, OrderFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+
+	// The same idempotency key is independent per tenant
+	_, err = store.ReserveIdempotencyKey(acme, "/orders", "POST", "key-1", "hash-a", "token-1", time.Minute)
+	require.NoError(t, err)
+	record, err := store.ReserveIdempotencyKey(globex, "/orders", "POST", "key-1", "hash-b", "token-2", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	_, err = store.GetOrderByID(context.Background(), order.ID)
+	assert.ErrorIs(t, err, tenant.ErrMissing)
+}
+
+func TestMemoryStore_OutboxDeadLetterAndPurge(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := tenant.NewContext(context.Background(), "default")
+	for i := 0; i < 3; i++ {
+		order := &models.Order{CustomerID: "customer-1", Items: []models.OrderItem{{ProductID: "product-1", Quantity: 1}}}
+		require.NoError(t, store.CreateOrder(ctx, order, &models.OutboxEvent{EventType: "OrderCreated", AggregateID: order.ID}))
+	}
+
+	claimed, err := store.ClaimOutboxEvents(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, claimed, 3)
+	assert.Zero(t, claimed[2].Attempts)
+	require.NoError(t, store.MarkOutboxEventProcessed(ctx, claimed[0].ID))
+	require.NoError(t, store.DeadLetterOutboxEvent(ctx, claimed[1].ID))
+	require.NoError(t, store.MarkOutboxEventFailed(ctx, claimed[2].ID))
+
+	// Processed and dead-lettered events are not claimed again, and only
+	// failed deliveries count as attempts
+	claimed, err = store.ClaimOutboxEvents(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, int64(3), claimed[0].ID)
+	assert.Equal(t, 1, claimed[0].Attempts)
+
+	// Only processed events are purged
+	deleted, err := store.DeleteProcessedOutboxEvents(ctx, time.Now().Add(-time.Minute), 10)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+	deleted, err = store.DeleteProcessedOutboxEvents(ctx, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	// IDs are not reused after a purge
+	order := &models.Order{CustomerID: "customer-1", Items: []models.OrderItem{{ProductID: "product-1", Quantity: 1}}}
+	event := &models.OutboxEvent{EventType: "OrderCreated", AggregateID: "order-4"}
+	require.NoError(t, store.CreateOrder(ctx, order, event))
+	assert.Equal(t, int64(4), event.ID)
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OrderFilter holds the criteria used to list and count orders.
+// Zero values are ignored.
+type OrderFilter struct {
+	CustomerID    string
+	ProductID     string
+	Status        string
+	OrderTimeFrom time.Time
+	OrderTimeTo   time.Time
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+
+	// AfterCreatedAt and AfterID position the page right after the last
+	// order of the previous page (keyset pagination)
+	AfterCreatedAt time.Time
+	AfterID        string
+
+	Limit int
+}
+
+// where builds the WHERE clause and its positional arguments for the filter,
+// scoped to the given tenant. The cursor condition is only added when
+// withCursor is true.
+func (f OrderFilter) where(tenantID string, withCursor bool) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	add("tenant_id = ?", tenantID)
+	if f.CustomerID != "" {
+		add("customer_id = ?", f.CustomerID)
+	}
+	if f.ProductID != "" {
+		add("EXISTS (SELECT 1 FROM order_items WHERE order_items.order_id = orders.id AND order_items.product_id = ?)", f.ProductID)
+	}
+	if f.Status != "" {
+		add("status = ?", f.Status)
+	}
+	if !f.OrderTimeFrom.IsZero() {
+		add("order_time >= ?", f.OrderTimeFrom)
+	}
+	if !f.OrderTimeTo.IsZero() {
+		add("order_time < ?", f.OrderTimeTo)
+	}
+	if !f.CreatedFrom.IsZero() {
+		add("created_at >= ?", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		add("created_at < ?", f.CreatedTo)
+	}
+	if withCursor && f.AfterID != "" {
+		args = append(args, f.AfterCreatedAt, f.AfterID)
+		conditions = append(conditions, "(created_at, id) < ($"+strconv.Itoa(len(args)-1)+", $"+strconv.Itoa(len(args))+")")
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
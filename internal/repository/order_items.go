@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"casebrief/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// insertOrderItems writes the lines of an order as part of the given transaction
+func insertOrderItems(ctx context.Context, tx *sql.Tx, order *models.Order) (err error) {
+	query := `
+		INSERT INTO order_items (order_id, line_no, product_id, quantity, unit_price, line_total)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	ctx, span := startSpan(ctx, "INSERT", "order_items", query)
+	defer func() { endSpan(span, err) }()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, item := range order.Items {
+		if _, err := stmt.ExecContext(ctx,
+			order.ID,
+			i+1,
+			item.ProductID,
+			item.Quantity,
+			item.UnitPrice,
+			item.LineTotal,
+		); err != nil {
+			return err
+		}
+	}
+	setRowCount(span, int64(len(order.Items)))
+
+	return nil
+}
+
+// loadOrderItems fetches the lines of the given orders with a single query
+func loadOrderItems(ctx context.Context, q queryer, orders ...*models.Order) (err error) {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*models.Order, len(orders))
+	ids := make([]string, 0, len(orders))
+	for _, order := range orders {
+		order.Items = []models.OrderItem{}
+		byID[order.ID] = order
+		ids = append(ids, order.ID)
+	}
+
+	query := `
+		SELECT order_id, product_id, quantity, unit_price, line_total
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, line_no
+	`
+
+	ctx, span := startSpan(ctx, "SELECT", "order_items", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var count int64
+	for rows.Next() {
+		var orderID string
+		var item models.OrderItem
+		if err := rows.Scan(
+			&orderID,
+			&item.ProductID,
+			&item.Quantity,
+			&item.UnitPrice,
+			&item.LineTotal,
+		); err != nil {
+			return err
+		}
+		order := byID[orderID]
+		order.Items = append(order.Items, item)
+		count++
+	}
+	setRowCount(span, count)
+
+	return rows.Err()
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// orderChangesChannel is the channel the orders trigger notifies the
+// committed changes of orders on
+const orderChangesChannel = "order_changes"
+
+// OrderChangeNotification identifies an order version committed by any
+// replica
+type OrderChangeNotification struct {
+	TenantID string `json:"tenant_id"`
+	OrderID  string `json:"order_id"`
+	Version  int64  `json:"version"`
+	// Kind is created, updated or status_changed
+	Kind string `json:"kind"`
+}
+
+// OrderChangeListener receives the changes of orders committed by all
+// replicas with LISTEN on a dedicated connection, which is re-established
+// after connection loss. Changes committed while the connection is down are
+// not received.
+type OrderChangeListener struct {
+	listener *pq.Listener
+	logger   *zap.Logger
+}
+
+// NewOrderChangeListener creates a listener connecting to the database of
+// dsn. The connection is established in the background.
+func NewOrderChangeListener(dsn string, logger *zap.Logger) *OrderChangeListener {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("Order change listener connection failed", zap.Error(err))
+		}
+	})
+	return &OrderChangeListener{listener: listener, logger: logger}
+}
+
+// Listen passes every order change to handle until ctx is done, then closes
+// the listener
+func (l *OrderChangeListener) Listen(ctx context.Context, handle func(*OrderChangeNotification)) {
+	defer l.listener.Close()
+
+	// Listen blocks until the connection is established
+	listening := make(chan error, 1)
+	go func() { listening <- l.listener.Listen(orderChangesChannel) }()
+	select {
+	case err := <-listening:
+		if err != nil {
+			l.logger.Error("Failed to listen for order changes", zap.Error(err))
+			return
+		}
+	case <-ctx.Done():
+		return
+	}
+	l.logger.Info("Listening for order changes")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-l.listener.Notify:
+			// nil after the connection was re-established
+			if notification == nil {
+				l.logger.Warn("Order change listener reconnected, changes may have been missed")
+				continue
+			}
+			var change OrderChangeNotification
+			if err := json.Unmarshal([]byte(notification.Extra), &change); err != nil {
+				l.logger.Error("Failed to decode order change",
+					zap.Error(err),
+					zap.String("payload", notification.Extra),
+				)
+				continue
+			}
+			handle(&change)
+		}
+	}
+}
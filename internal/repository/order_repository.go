@@ -4,15 +4,64 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"strconv"
 	"time"
 
 	"casebrief/internal/models"
+	"casebrief/internal/tenant"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
+// orderColumns lists the orders table columns in the order expected by scanOrder
+const orderColumns = `id, tenant_id, customer_id, product_id, quantity, total_price, currency, status, shipping_address, version, order_time, created_at, updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOrder scans a single orders row selected with orderColumns
+func scanOrder(row rowScanner) (*models.Order, error) {
+	order := &models.Order{}
+	var shippingAddress []byte
+	err := row.Scan(
+		&order.ID,
+		&order.TenantID,
+		&order.CustomerID,
+		&order.ProductID,
+		&order.Quantity,
+		&order.TotalPrice,
+		&order.Currency,
+		&order.Status,
+		&shippingAddress,
+		&order.Version,
+		&order.OrderTime,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if shippingAddress != nil {
+		if err := json.Unmarshal(shippingAddress, &order.ShippingAddress); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// marshalShippingAddress encodes a shipping address for the JSONB column,
+// NULL if there is none
+func marshalShippingAddress(address *models.ShippingAddress) ([]byte, error) {
+	if address == nil {
+		return nil, nil
+	}
+	return json.Marshal(address)
+}
+
 // OrderRepository handles database operations for orders
 type OrderRepository struct {
 	db     *sql.DB
@@ -27,29 +76,57 @@ func NewOrderRepository(db *sql.DB, logger *zap.Logger) *OrderRepository {
 	}
 }
 
-// CreateOrder creates a new order in the database
-func (r *OrderRepository) CreateOrder(ctx context.Context, order *models.Order) error {
+// CreateOrder creates a new order with its items in the database. If event is
+// not nil it is written to the outbox in the same transaction, so the event is
+// stored if and only if the order is.
+func (r *OrderRepository) CreateOrder(ctx context.Context, order *models.Order, event *models.OutboxEvent) (err error) {
 	query := `
-		INSERT INTO orders (id, customer_id, product_id, quantity, total_price, status, order_time, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO orders (id, tenant_id, customer_id, product_id, quantity, total_price, currency, status, shipping_address, version, order_time, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
 
+	ctx, span := startSpan(ctx, "INSERT", "orders", query)
+	defer func() { endSpan(span, err) }()
+
 	now := time.Now()
-	order.ID = uuid.New().String()
+	if order.ID == "" {
+		order.ID = uuid.New().String()
+	}
 	if order.OrderTime.IsZero() {
 		order.OrderTime = now
 	}
 	order.CreatedAt = now
 	order.UpdatedAt = now
-	order.Status = "created"
+	order.Status = models.OrderStatusCreated
+	order.Version = 1
+
+	shippingAddress, err := marshalShippingAddress(order.ShippingAddress)
+	if err != nil {
+		return err
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin transaction",
+			zap.Error(err),
+			zap.String("customer_id", order.CustomerID),
+		)
+		return err
+	}
+	defer tx.Rollback()
+	order.TenantID = tenantID
 
-	_, err := r.db.ExecContext(ctx, query,
+	result, err := tx.ExecContext(ctx, query,
 		order.ID,
+		order.TenantID,
 		order.CustomerID,
 		order.ProductID,
 		order.Quantity,
 		order.TotalPrice,
+		order.Currency,
 		order.Status,
+		shippingAddress,
+		order.Version,
 		order.OrderTime,
 		order.CreatedAt,
 		order.UpdatedAt,
@@ -62,6 +139,36 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, order *models.Order)
 		)
 		return err
 	}
+	if rows, err := result.RowsAffected(); err == nil {
+		setRowCount(span, rows)
+	}
+
+	if err := insertOrderItems(ctx, tx, order); err != nil {
+		r.logger.Error("Failed to create order items",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+		)
+		return err
+	}
+
+	if event != nil {
+		if err := insertOutboxEvent(ctx, tx, event); err != nil {
+			r.logger.Error("Failed to write outbox event",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+				zap.String("event_type", event.EventType),
+			)
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit order creation",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+		)
+		return err
+	}
 
 	r.logger.Info("Order created successfully",
 		zap.String("order_id", order.ID),
@@ -69,28 +176,32 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, order *models.Order)
 	return nil
 }
 
-// GetOrderByID retrieves an order by its ID
-func (r *OrderRepository) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
+// GetOrderByID retrieves an order with its items by its ID
+func (r *OrderRepository) GetOrderByID(ctx context.Context, id string) (_ *models.Order, err error) {
 	query := `
-		SELECT id, customer_id, product_id, quantity, total_price, status, order_time, created_at, updated_at
+		SELECT ` + orderColumns + `
 		FROM orders
-		WHERE id = $1
+		WHERE tenant_id = $1 AND id = $2
 	`
 
-	order := &models.Order{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&order.ID,
-		&order.CustomerID,
-		&order.ProductID,
-		&order.Quantity,
-		&order.TotalPrice,
-		&order.Status,
-		&order.OrderTime,
-		&order.CreatedAt,
-		&order.UpdatedAt,
-	)
+	ctx, span := startSpan(ctx, "SELECT", "orders", query)
+	defer func() { endSpan(span, err) }()
+
+	// Read the order and its items from the same snapshot
+	tx, tenantID, err := beginTenantTx(ctx, r.db, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		r.logger.Error("Failed to begin transaction",
+			zap.Error(err),
+			zap.String("order_id", id),
+		)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	order, err := scanOrder(tx.QueryRowContext(ctx, query, tenantID, id))
 
 	if err == sql.ErrNoRows {
+		setRowCount(span, 0)
 		return nil, ErrOrderNotFound
 	}
 
@@ -101,66 +212,369 @@ func (r *OrderRepository) GetOrderByID(ctx context.Context, id string) (*models.
 		)
 		return nil, err
 	}
+	setRowCount(span, 1)
 
-	return order, nil
+	if err := loadOrderItems(ctx, tx, order); err != nil {
+		r.logger.Error("Failed to get order items",
+			zap.Error(err),
+			zap.String("order_id", id),
+		)
+		return nil, err
+	}
+
+	return order, tx.Commit()
 }
 
-// GetIdempotencyResponse retrieves a saved response by endpoint and idempotency key if still valid
-func (r *OrderRepository) GetIdempotencyResponse(ctx context.Context, endpointName, endpointScheme, key string) ([]byte, error) {
+// ListOrders retrieves a page of orders matching the filter, newest first.
+// Orders are sorted by (created_at, id) so the cursor fields in the filter
+// can be used for keyset pagination.
+func (r *OrderRepository) ListOrders(ctx context.Context, filter OrderFilter) (_ []*models.Order, err error) {
+	tenantID, _ := tenant.FromContext(ctx)
+	where, args := filter.where(tenantID, true)
+	args = append(args, filter.Limit)
+
 	query := `
-		SELECT response
-		FROM idempotency_keys
-		WHERE endpoint_name = $1 AND endpoint_scheme = $2 AND key = $3 AND valid_to > NOW()
-	`
+		SELECT ` + orderColumns + `
+		FROM orders
+		` + where + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT $` + strconv.Itoa(len(args))
 
-	var response []byte
-	err := r.db.QueryRowContext(ctx, query, endpointName, endpointScheme, key).Scan(&response)
+	ctx, span := startSpan(ctx, "SELECT", "orders", query)
+	defer func() { endSpan(span, err) }()
 
-	if err == sql.ErrNoRows {
-		return nil, ErrIdempotencyNotFound
+	// Read the orders and their items from the same snapshot
+	tx, _, err := beginTenantTx(ctx, r.db, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		r.logger.Error("Failed to begin transaction",
+			zap.Error(err),
+		)
+		return nil, err
 	}
+	defer tx.Rollback()
 
+	rows, err := tx.QueryContext(ctx, query, args...)
 	if err != nil {
-		r.logger.Error("Failed to get idempotency response",
+		r.logger.Error("Failed to list orders",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]*models.Order, 0, filter.Limit)
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan order",
+				zap.Error(err),
+			)
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Failed to iterate orders",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	setRowCount(span, int64(len(orders)))
+
+	if err := loadOrderItems(ctx, tx, orders...); err != nil {
+		r.logger.Error("Failed to get order items",
 			zap.Error(err),
-			zap.String("endpoint_name", endpointName),
-			zap.String("endpoint_scheme", endpointScheme),
-			zap.String("idempotency_key", key),
 		)
 		return nil, err
 	}
 
-	return response, nil
+	return orders, tx.Commit()
 }
 
-// StoreIdempotencyResponse stores an idempotency key with endpoint info and response
-func (r *OrderRepository) StoreIdempotencyResponse(ctx context.Context, endpointName, endpointScheme, key string, response interface{}, validityDuration time.Duration) error {
-	responseJSON, err := json.Marshal(response)
+// CountOrders returns the number of orders matching the filter, ignoring the cursor and limit
+func (r *OrderRepository) CountOrders(ctx context.Context, filter OrderFilter) (_ int64, err error) {
+	tenantID, _ := tenant.FromContext(ctx)
+	where, args := filter.where(tenantID, false)
+
+	query := `
+		SELECT COUNT(*)
+		FROM orders
+		` + where
+
+	ctx, span := startSpan(ctx, "SELECT", "orders", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, _, err := beginTenantTx(ctx, r.db, &sql.TxOptions{ReadOnly: true})
 	if err != nil {
-		r.logger.Error("Failed to marshal response for idempotency",
+		r.logger.Error("Failed to begin transaction",
 			zap.Error(err),
 		)
-		return err
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var count int64
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		r.logger.Error("Failed to count orders",
+			zap.Error(err),
+		)
+		return 0, err
 	}
 
-	validTo := time.Now().Add(validityDuration)
+	return count, tx.Commit()
+}
+
+// UpdateOrderStatus moves an order from one status to another and records the
+// change in the status history within a single transaction, together with the
+// optional outbox event. It returns ErrOrderStatusConflict if the order is no
+// longer in the expected status.
+func (r *OrderRepository) UpdateOrderStatus(ctx context.Context, id, fromStatus, toStatus, changedBy, reason string, event *models.OutboxEvent) (_ *models.Order, err error) {
 	query := `
-		INSERT INTO idempotency_keys (endpoint_name, endpoint_scheme, key, response, valid_to, created_at)
+		UPDATE orders
+		SET status = $4, updated_at = $5, version = version + 1
+		WHERE tenant_id = $1 AND id = $2 AND status = $3
+		RETURNING ` + orderColumns
+
+	ctx, span := startSpan(ctx, "UPDATE", "orders", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin transaction",
+			zap.Error(err),
+			zap.String("order_id", id),
+		)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	order, err := scanOrder(tx.QueryRowContext(ctx, query, tenantID, id, fromStatus, toStatus, now))
+	if err == sql.ErrNoRows {
+		setRowCount(span, 0)
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE tenant_id = $1 AND id = $2)`, tenantID, id).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrOrderNotFound
+		}
+		return nil, ErrOrderStatusConflict
+	}
+	if err != nil {
+		r.logger.Error("Failed to update order status",
+			zap.Error(err),
+			zap.String("order_id", id),
+		)
+		return nil, err
+	}
+	setRowCount(span, 1)
+
+	if err := loadOrderItems(ctx, tx, order); err != nil {
+		r.logger.Error("Failed to get order items",
+			zap.Error(err),
+			zap.String("order_id", id),
+		)
+		return nil, err
+	}
+
+	historyQuery := `
+		INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, reason, changed_at)
 		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (endpoint_name, endpoint_scheme, key) DO UPDATE
-		SET response = EXCLUDED.response, valid_to = EXCLUDED.valid_to
 	`
 
-	_, err = r.db.ExecContext(ctx, query, endpointName, endpointScheme, key, responseJSON, validTo, time.Now())
+	if _, err := tx.ExecContext(ctx, historyQuery, id, fromStatus, toStatus, changedBy, reason, now); err != nil {
+		r.logger.Error("Failed to record order status history",
+			zap.Error(err),
+			zap.String("order_id", id),
+		)
+		return nil, err
+	}
+
+	if event != nil {
+		if err := insertOutboxEvent(ctx, tx, event); err != nil {
+			r.logger.Error("Failed to write outbox event",
+				zap.Error(err),
+				zap.String("order_id", id),
+				zap.String("event_type", event.EventType),
+			)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit order status update",
+			zap.Error(err),
+			zap.String("order_id", id),
+		)
+		return nil, err
+	}
+
+	r.logger.Info("Order status updated",
+		zap.String("order_id", id),
+		zap.String("from_status", fromStatus),
+		zap.String("to_status", toStatus),
+		zap.String("changed_by", changedBy),
+	)
+	return order, nil
+}
+
+// UpdateOrder replaces the lines, totals and shipping address of an order with
+// those of the given order and increments its version, within a single
+// transaction together with the optional outbox event. It returns
+// ErrOrderVersionMismatch if the order is no longer at expectedVersion.
+func (r *OrderRepository) UpdateOrder(ctx context.Context, order *models.Order, expectedVersion int64, event *models.OutboxEvent) (_ *models.Order, err error) {
+	query := `
+		UPDATE orders
+		SET product_id = $4, quantity = $5, total_price = $6, shipping_address = $7, updated_at = $8, version = version + 1
+		WHERE tenant_id = $1 AND id = $2 AND version = $3
+		RETURNING ` + orderColumns
+
+	ctx, span := startSpan(ctx, "UPDATE", "orders", query)
+	defer func() { endSpan(span, err) }()
+
+	shippingAddress, err := marshalShippingAddress(order.ShippingAddress)
 	if err != nil {
-		r.logger.Error("Failed to store idempotency response",
+		return nil, err
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin transaction",
 			zap.Error(err),
-			zap.String("endpoint_name", endpointName),
-			zap.String("endpoint_scheme", endpointScheme),
-			zap.String("idempotency_key", key),
+			zap.String("order_id", order.ID),
 		)
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	return nil
+	updated, err := scanOrder(tx.QueryRowContext(ctx, query,
+		tenantID,
+		order.ID,
+		expectedVersion,
+		order.ProductID,
+		order.Quantity,
+		order.TotalPrice,
+		shippingAddress,
+		time.Now(),
+	))
+	if err == sql.ErrNoRows {
+		setRowCount(span, 0)
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE tenant_id = $1 AND id = $2)`, tenantID, order.ID).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrOrderNotFound
+		}
+		return nil, ErrOrderVersionMismatch
+	}
+	if err != nil {
+		r.logger.Error("Failed to update order",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+		)
+		return nil, err
+	}
+	setRowCount(span, 1)
+
+	// The lines are replaced as a whole
+	if _, err := tx.ExecContext(ctx, `DELETE FROM order_items WHERE order_id = $1`, order.ID); err != nil {
+		r.logger.Error("Failed to delete order items",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+		)
+		return nil, err
+	}
+	updated.Items = order.Items
+	if err := insertOrderItems(ctx, tx, updated); err != nil {
+		r.logger.Error("Failed to create order items",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+		)
+		return nil, err
+	}
+
+	if event != nil {
+		if err := insertOutboxEvent(ctx, tx, event); err != nil {
+			r.logger.Error("Failed to write outbox event",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+				zap.String("event_type", event.EventType),
+			)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit order update",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+		)
+		return nil, err
+	}
+
+	r.logger.Info("Order updated",
+		zap.String("order_id", order.ID),
+		zap.Int64("version", updated.Version),
+	)
+	return updated, nil
+}
+
+// GetOrderStatusHistory retrieves the status changes of an order, oldest first
+func (r *OrderRepository) GetOrderStatusHistory(ctx context.Context, orderID string) (_ []*models.OrderStatusChange, err error) {
+	query := `
+		SELECT h.id, h.order_id, h.from_status, h.to_status, h.changed_by, h.reason, h.changed_at
+		FROM order_status_history h
+		JOIN orders o ON o.id = h.order_id
+		WHERE o.tenant_id = $1 AND h.order_id = $2
+		ORDER BY h.changed_at, h.id
+	`
+
+	ctx, span := startSpan(ctx, "SELECT", "order_status_history", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		r.logger.Error("Failed to begin transaction",
+			zap.Error(err),
+			zap.String("order_id", orderID),
+		)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, tenantID, orderID)
+	if err != nil {
+		r.logger.Error("Failed to get order status history",
+			zap.Error(err),
+			zap.String("order_id", orderID),
+		)
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*models.OrderStatusChange{}
+	for rows.Next() {
+		change := &models.OrderStatusChange{}
+		if err := rows.Scan(
+			&change.ID,
+			&change.OrderID,
+			&change.FromStatus,
+			&change.ToStatus,
+			&change.ChangedBy,
+			&change.Reason,
+			&change.ChangedAt,
+		); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	setRowCount(span, int64(len(history)))
+
+	return history, tx.Commit()
 }
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"casebrief/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// OutboxRepository handles database operations for the transactional outbox
+type OutboxRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewOutboxRepository creates a new outbox repository
+func NewOutboxRepository(db *sql.DB, logger *zap.Logger) *OutboxRepository {
+	return &OutboxRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// insertOutboxEvent writes an event to the outbox as part of the given transaction
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, event *models.OutboxEvent) (err error) {
+	query := `
+		INSERT INTO outbox (event_type, aggregate_id, payload, trace_context, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	ctx, span := startSpan(ctx, "INSERT", "outbox", query)
+	defer func() { endSpan(span, err) }()
+
+	var traceContext []byte
+	if len(event.TraceContext) > 0 {
+		if traceContext, err = json.Marshal(event.TraceContext); err != nil {
+			return err
+		}
+	}
+
+	return tx.QueryRowContext(ctx, query,
+		event.EventType,
+		event.AggregateID,
+		[]byte(event.Payload),
+		traceContext,
+		time.Now(),
+	).Scan(&event.ID, &event.CreatedAt)
+}
+
+// ClaimOutboxEvents claims up to limit pending events for the given lease.
+// Rows locked by another relay are skipped, and claimed rows are not handed
+// out again until the lease expires, so a crashed relay's events are retried.
+// Dead-lettered rows are skipped.
+func (r *OutboxRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	query := `
+		UPDATE outbox
+		SET locked_until = $2
+		WHERE id IN (
+			SELECT id
+			FROM outbox
+			WHERE processed_at IS NULL AND dead_lettered_at IS NULL AND (locked_until IS NULL OR locked_until < $3)
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_type, aggregate_id, payload, attempts, created_at, trace_context
+	`
+
+	now := time.Now()
+	rows, err := r.db.QueryContext(ctx, query, limit, now.Add(lease), now)
+	if err != nil {
+		r.logger.Error("Failed to claim outbox events",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claimed []*models.OutboxEvent
+	for rows.Next() {
+		event := &models.OutboxEvent{}
+		var payload, traceContext []byte
+		if err := rows.Scan(
+			&event.ID,
+			&event.EventType,
+			&event.AggregateID,
+			&payload,
+			&event.Attempts,
+			&event.CreatedAt,
+			&traceContext,
+		); err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		if traceContext != nil {
+			if err := json.Unmarshal(traceContext, &event.TraceContext); err != nil {
+				return nil, err
+			}
+		}
+		claimed = append(claimed, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not preserve the order of the sub-select
+	sort.Slice(claimed, func(i, j int) bool {
+		return claimed[i].ID < claimed[j].ID
+	})
+	return claimed, nil
+}
+
+// MarkOutboxEventProcessed marks an event as delivered so it is never claimed again
+func (r *OutboxRepository) MarkOutboxEventProcessed(ctx context.Context, id int64) error {
+	query := `
+		UPDATE outbox
+		SET processed_at = $2, locked_until = NULL
+		WHERE id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, time.Now()); err != nil {
+		r.logger.Error("Failed to mark outbox event processed",
+			zap.Error(err),
+			zap.Int64("outbox_id", id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// MarkOutboxEventFailed counts a failed delivery attempt of an event. The
+// event stays leased, so it is retried once the lease expires.
+func (r *OutboxRepository) MarkOutboxEventFailed(ctx context.Context, id int64) error {
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1
+		WHERE id = $1 AND processed_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		r.logger.Error("Failed to mark outbox event failed",
+			zap.Error(err),
+			zap.Int64("outbox_id", id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// DeadLetterOutboxEvent stops the delivery of an event that failed too often.
+// The row is kept for inspection; clearing dead_lettered_at and attempts
+// delivers it again.
+func (r *OutboxRepository) DeadLetterOutboxEvent(ctx context.Context, id int64) error {
+	query := `
+		UPDATE outbox
+		SET dead_lettered_at = $2, locked_until = NULL
+		WHERE id = $1 AND processed_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, time.Now()); err != nil {
+		r.logger.Error("Failed to dead-letter outbox event",
+			zap.Error(err),
+			zap.Int64("outbox_id", id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteProcessedOutboxEvents deletes at most limit events processed before
+// the given time and returns the number of rows deleted. Pending and
+// dead-lettered events are kept.
+func (r *OutboxRepository) DeleteProcessedOutboxEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM outbox
+		WHERE id IN (
+			SELECT id
+			FROM outbox
+			WHERE processed_at < $1
+			ORDER BY processed_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		r.logger.Error("Failed to delete processed outbox events",
+			zap.Error(err),
+		)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"casebrief/internal/models"
+)
+
+// OrderStore persists orders, their status history and the outbox events
+// written together with them. OrderRepository implements it on top of
+// Postgres and MemoryStore in memory; MemoryStore also implements
+// OutboxStore.
+type OrderStore interface {
+	CreateOrder(ctx context.Context, order *models.Order, event *models.OutboxEvent) error
+	GetOrderByID(ctx context.Context, id string) (*models.Order, error)
+	ListOrders(ctx context.Context, filter OrderFilter) ([]*models.Order, error)
+	CountOrders(ctx context.Context, filter OrderFilter) (int64, error)
+	UpdateOrderStatus(ctx context.Context, id, fromStatus, toStatus, changedBy, reason string, event *models.OutboxEvent) (*models.Order, error)
+	UpdateOrder(ctx context.Context, order *models.Order, expectedVersion int64, event *models.OutboxEvent) (*models.Order, error)
+	GetOrderStatusHistory(ctx context.Context, orderID string) ([]*models.OrderStatusChange, error)
+}
+
+// OutboxStore is the delivery side of the outbox: the relay claims and
+// acknowledges events (events.OutboxStore) and the janitor purges them
+type OutboxStore interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error)
+	MarkOutboxEventProcessed(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64) error
+	DeadLetterOutboxEvent(ctx context.Context, id int64) error
+	DeleteProcessedOutboxEvents(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// IdempotencyStore persists idempotency keys with their stored responses
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, requestHash, token string, lockTimeout time.Duration) (*IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, token string, response *IdempotencyResponse, validityDuration time.Duration) error
+	ReleaseIdempotencyKey(ctx context.Context, endpointName, endpointScheme, key, token string) error
+	TryLockIdempotencyPurge(ctx context.Context) (unlock func(), acquired bool, err error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// APIKeyStore persists the hashed API keys of service clients
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+}
+
+var (
+	_ OrderStore       = (*OrderRepository)(nil)
+	_ OutboxStore      = (*OutboxRepository)(nil)
+	_ IdempotencyStore = (*IdempotencyRepository)(nil)
+	_ APIKeyStore      = (*APIKeyRepository)(nil)
+
+	_ OrderStore       = (*MemoryStore)(nil)
+	_ OutboxStore      = (*MemoryStore)(nil)
+	_ IdempotencyStore = (*MemoryStore)(nil)
+	_ APIKeyStore      = (*MemoryStore)(nil)
+)
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"casebrief/internal/tenant"
+)
+
+// beginTenantTx begins a transaction scoped to the tenant of the context. The
+// tenant is set as app.tenant_id for the transaction, which the row level
+// security policies of the orders tables compare against, so rows of other
+// tenants are invisible even to a query missing its tenant condition. The
+// queries still filter by the returned tenant explicitly, which lets Postgres
+// use the tenant indexes. It returns tenant.ErrMissing if the context carries
+// no tenant.
+func beginTenantTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (*sql.Tx, string, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, "", tenant.ErrMissing
+	}
+
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('app.tenant_id', $1, true)`, tenantID); err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+	return tx, tenantID, nil
+}
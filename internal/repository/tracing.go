@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the database spans
+const tracerName = "casebrief/internal/repository"
+
+// dbRowCountKey is the number of rows returned or affected by a statement
+const dbRowCountKey = attribute.Key("db.row_count")
+
+// startSpan starts a client span for a statement, named "<operation> <table>"
+// as recommended by the OpenTelemetry database conventions
+func startSpan(ctx context.Context, operation, table, statement string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, operation+" "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperation(operation),
+			semconv.DBSQLTable(table),
+			semconv.DBStatement(strings.Join(strings.Fields(statement), " ")),
+		),
+	)
+}
+
+// setRowCount records the number of rows returned or affected on the span
+func setRowCount(span trace.Span, rows int64) {
+	span.SetAttributes(dbRowCountKey.Int64(rows))
+}
+
+// endSpan records err on the span and ends it. ErrOrderNotFound,
+// ErrOrderStatusConflict, ErrOrderVersionMismatch and ErrAPIKeyNotFound are
+// expected outcomes and do not mark the span failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrOrderNotFound) && !errors.Is(err, ErrOrderStatusConflict) && !errors.Is(err, ErrOrderVersionMismatch) && !errors.Is(err, ErrAPIKeyNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
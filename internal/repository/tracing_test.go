@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"casebrief/internal/models"
+	"casebrief/internal/tenant"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func newTracedRepository(t *testing.T) (*OrderRepository, sqlmock.Sqlmock, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return NewOrderRepository(db, zap.NewNop()), mock, recorder
+}
+
+// expectTenantTx expects a transaction scoped to the tenant
+func expectTenantTx(mock sqlmock.Sqlmock, tenantID string) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT set_config\('app.tenant_id', \$1, true\)`).
+		WithArgs(tenantID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// spanAttributes returns the attributes of the ended span with the given name
+func spanAttributes(t *testing.T, recorder *tracetest.SpanRecorder, name string) (sdktrace.ReadOnlySpan, map[attribute.Key]attribute.Value) {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			attributes := map[attribute.Key]attribute.Value{}
+			for _, kv := range span.Attributes() {
+				attributes[kv.Key] = kv.Value
+			}
+			return span, attributes
+		}
+	}
+	require.Failf(t, "span not found", "no span named %q", name)
+	return nil, nil
+}
+
+func TestOrderRepository_GetOrderByIDSpans(t *testing.T) {
+	repo, mock, recorder := newTracedRepository(t)
+	now := time.Now()
+
+	expectTenantTx(mock, "acme")
+	mock.ExpectQuery(`SELECT .* FROM orders WHERE tenant_id = \$1 AND id = \$2`).
+		WithArgs("acme", "order-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tenant_id", "customer_id", "product_id", "quantity", "total_price", "currency", "status", "shipping_address", "version", "order_time", "created_at", "updated_at"}).
+			AddRow("order-1", "acme", "customer-1", "product-1", 2, "10.00", "EUR", "created", []byte(`{"name":"Ada","line1":"Main St 1","postal_code":"1011","city":"Budapest","country":"HU"}`), 3, now, now, now))
+	mock.ExpectQuery(`SELECT .* FROM order_items`).
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "product_id", "quantity", "unit_price", "line_total"}).
+			AddRow("order-1", "product-1", 2, "5.00", "10.00"))
+	mock.ExpectCommit()
+
+	order, err := repo.GetOrderByID(tenant.NewContext(context.Background(), "acme"), "order-1")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", order.TenantID)
+	assert.Equal(t, int64(3), order.Version)
+	require.NotNil(t, order.ShippingAddress)
+	assert.Equal(t, "Budapest", order.ShippingAddress.City)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	orders, attributes := spanAttributes(t, recorder, "SELECT orders")
+	assert.Equal(t, trace.SpanKindClient, orders.SpanKind())
+	assert.Equal(t, "postgresql", attributes["db.system"].AsString())
+	assert.Equal(t, "SELECT", attributes["db.operation"].AsString())
+	assert.Equal(t, "orders", attributes["db.sql.table"].AsString())
+	assert.Contains(t, attributes["db.statement"].AsString(), "FROM orders WHERE tenant_id = $1 AND id = $2")
+	assert.Equal(t, int64(1), attributes[dbRowCountKey].AsInt64())
+	assert.Equal(t, codes.Unset, orders.Status().Code)
+
+	items, attributes := spanAttributes(t, recorder, "SELECT order_items")
+	assert.Equal(t, orders.SpanContext().SpanID(), items.Parent().SpanID())
+	assert.Equal(t, int64(1), attributes[dbRowCountKey].AsInt64())
+}
+
+func TestOrderRepository_GetOrderByIDNotFoundIsNotAnError(t *testing.T) {
+	repo, mock, recorder := newTracedRepository(t)
+
+	expectTenantTx(mock, "acme")
+	mock.ExpectQuery(`SELECT .* FROM orders`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	_, err := repo.GetOrderByID(tenant.NewContext(context.Background(), "acme"), "missing")
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+
+	span, attributes := spanAttributes(t, recorder, "SELECT orders")
+	assert.Equal(t, int64(0), attributes[dbRowCountKey].AsInt64())
+	assert.Equal(t, codes.Unset, span.Status().Code)
+}
+
+func TestOrderRepository_UpdateOrderVersionMismatchIsNotAnError(t *testing.T) {
+	repo, mock, recorder := newTracedRepository(t)
+
+	expectTenantTx(mock, "acme")
+	mock.ExpectQuery(`UPDATE orders .* WHERE tenant_id = \$1 AND id = \$2 AND version = \$3`).
+		WithArgs("acme", "order-1", int64(2), "product-1", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("acme", "order-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	order := &models.Order{ID: "order-1", ProductID: "product-1", Quantity: 1}
+	_, err := repo.UpdateOrder(tenant.NewContext(context.Background(), "acme"), order, 2, nil)
+	assert.ErrorIs(t, err, ErrOrderVersionMismatch)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	span, attributes := spanAttributes(t, recorder, "UPDATE orders")
+	assert.Equal(t, int64(0), attributes[dbRowCountKey].AsInt64())
+	assert.Equal(t, codes.Unset, span.Status().Code)
+}
+
+func TestOrderRepository_RecordsErrorsOnSpans(t *testing.T) {
+	repo, mock, recorder := newTracedRepository(t)
+
+	expectTenantTx(mock, "acme")
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM orders WHERE tenant_id = \$1`).
+		WithArgs("acme").
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	_, err := repo.CountOrders(tenant.NewContext(context.Background(), "acme"), OrderFilter{})
+	assert.Error(t, err)
+
+	span, _ := spanAttributes(t, recorder, "SELECT orders")
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Equal(t, "connection reset", span.Status().Description)
+	require.Len(t, span.Events(), 1)
+	assert.Equal(t, "exception", span.Events()[0].Name)
+}
+
+func TestOrderRepository_RequiresTenant(t *testing.T) {
+	repo, mock, _ := newTracedRepository(t)
+
+	_, err := repo.GetOrderByID(context.Background(), "order-1")
+	assert.ErrorIs(t, err, tenant.ErrMissing)
+	// Nothing is sent to the database without a tenant
+	require.NoError(t, mock.ExpectationsWereMet())
+}
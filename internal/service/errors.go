@@ -0,0 +1,21 @@
+package service
+
+import "errors"
+
+var (
+	// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrUnknownStatus is returned when a requested order status is not part of the lifecycle
+	ErrUnknownStatus = errors.New("unknown order status")
+	// ErrIllegalTransition is returned when an order cannot move to the requested status
+	ErrIllegalTransition = errors.New("illegal status transition")
+	// ErrOrderNotEditable is returned when a change is not allowed in the order's status
+	ErrOrderNotEditable = errors.New("order cannot be changed in its status")
+	// ErrUnsupportedCurrency is returned when a currency is not an active ISO 4217 code
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	// ErrInvalidAmount is returned when an amount is not valid in the order's currency
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrInvalidActor is returned when an anonymous request does not name who
+	// changes an order, or an authenticated one names someone else
+	ErrInvalidActor = errors.New("invalid actor")
+)
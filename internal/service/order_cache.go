@@ -0,0 +1,91 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"casebrief/internal/models"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Order cache lookup results
+const (
+	orderCacheHit  = "hit"
+	orderCacheMiss = "miss"
+)
+
+var orderCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "order_cache_requests_total",
+	Help: "Number of orders read by ID through the order cache by result (hit when served from the cache, miss when read from the store).",
+}, []string{"result"})
+
+// orderCacheKey identifies a cached order; order IDs are unique per tenant only
+type orderCacheKey struct {
+	tenantID string
+	orderID  string
+}
+
+// OrderCache is an in-process LRU cache of orders read by ID. The service
+// invalidates an order whenever it writes it or NotifyOrderChange reports a
+// write of another replica. Notifications can be missed, so entries also
+// expire after a TTL that bounds how stale a cached order can be. A nil
+// *OrderCache caches nothing.
+type OrderCache struct {
+	orders *expirable.LRU[orderCacheKey, *models.Order]
+
+	mu sync.Mutex
+	// generation is incremented by every invalidation, so that an order read
+	// from the store concurrently with a write is not cached afterwards
+	generation uint64
+}
+
+// NewOrderCache creates a cache holding up to size orders for ttl each
+func NewOrderCache(size int, ttl time.Duration) *OrderCache {
+	return &OrderCache{
+		orders: expirable.NewLRU[orderCacheKey, *models.Order](size, nil, ttl),
+	}
+}
+
+// get returns a copy of the cached order and the generation to pass to add
+// if the order is not cached
+func (c *OrderCache) get(key orderCacheKey) (*models.Order, uint64, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+	if order, ok := c.orders.Get(key); ok {
+		orderCacheRequests.WithLabelValues(orderCacheHit).Inc()
+		return order.Clone(), 0, true
+	}
+	orderCacheRequests.WithLabelValues(orderCacheMiss).Inc()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return nil, c.generation, false
+}
+
+// add caches a copy of an order read from the store, unless an order was
+// invalidated since get returned the generation
+func (c *OrderCache) add(key orderCacheKey, order *models.Order, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == generation {
+		c.orders.Add(key, order.Clone())
+	}
+}
+
+// invalidate removes an order from the cache
+func (c *OrderCache) invalidate(key orderCacheKey) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.orders.Remove(key)
+}
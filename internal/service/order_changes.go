@@ -0,0 +1,48 @@
+package service
+
+import (
+	"slices"
+
+	"casebrief/internal/models"
+)
+
+// Names of the order fields changed by an update, as listed in the
+// changed_fields of OrderUpdated events
+const (
+	fieldItems           = "items"
+	fieldProductID       = "product_id"
+	fieldQuantity        = "quantity"
+	fieldTotalPrice      = "total_price"
+	fieldShippingAddress = "shipping_address"
+)
+
+// changedFields returns the JSON names of the changeable order fields that
+// differ between two versions of an order, including the summary fields
+// derived from the lines
+func changedFields(before, after *models.Order) []string {
+	var fields []string
+	if !slices.Equal(before.Items, after.Items) {
+		fields = append(fields, fieldItems)
+	}
+	if before.ProductID != after.ProductID {
+		fields = append(fields, fieldProductID)
+	}
+	if before.Quantity != after.Quantity {
+		fields = append(fields, fieldQuantity)
+	}
+	if before.TotalPrice != after.TotalPrice {
+		fields = append(fields, fieldTotalPrice)
+	}
+	if !equalShippingAddress(before.ShippingAddress, after.ShippingAddress) {
+		fields = append(fields, fieldShippingAddress)
+	}
+	return fields
+}
+
+// equalShippingAddress reports whether two optional addresses are equal
+func equalShippingAddress(a, b *models.ShippingAddress) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"casebrief/internal/models"
+)
+
+// orderCurrency returns the normalized currency of a create request and the
+// number of decimal places amounts in that currency may have
+func orderCurrency(req *models.CreateOrderRequest) (string, int, error) {
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
+	decimals, ok := models.CurrencyDecimals(currency)
+	if !ok {
+		return "", 0, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, req.Currency)
+	}
+	return currency, decimals, nil
+}
+
+// orderItemsFromRequest builds the order lines of a create request, computing
+// every line total. Requests without items describe a single line with the
+// product fields, where the given total price is the line total. Amounts must
+// not have more decimal places than the currency's minor unit.
+func orderItemsFromRequest(req *models.CreateOrderRequest, decimals int) ([]models.OrderItem, error) {
+	if req.Items == nil {
+		if !req.TotalPrice.HasDecimals(decimals) {
+			return nil, fmt.Errorf("%w: total_price %s has more than %d decimal places", ErrInvalidAmount, req.TotalPrice, decimals)
+		}
+		unitPrice, err := req.TotalPrice.Div(req.Quantity, decimals)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+		}
+		return []models.OrderItem{{
+			ProductID: req.ProductID,
+			Quantity:  req.Quantity,
+			UnitPrice: unitPrice,
+			LineTotal: req.TotalPrice,
+		}}, nil
+	}
+
+	return orderLines(req.Items, decimals)
+}
+
+// orderLines builds order lines from the requested lines, computing every line
+// total. Unit prices must not have more decimal places than the currency's
+// minor unit.
+func orderLines(lines []models.CreateOrderItemRequest, decimals int) ([]models.OrderItem, error) {
+	items := make([]models.OrderItem, 0, len(lines))
+	for i, line := range lines {
+		if !line.UnitPrice.HasDecimals(decimals) {
+			return nil, fmt.Errorf("%w: items[%d].unit_price %s has more than %d decimal places", ErrInvalidAmount, i, line.UnitPrice, decimals)
+		}
+		lineTotal, err := line.UnitPrice.Mul(line.Quantity)
+		if err != nil {
+			return nil, fmt.Errorf("%w: items[%d] line total is too large", ErrInvalidAmount, i)
+		}
+		items = append(items, models.OrderItem{
+			ProductID: line.ProductID,
+			Quantity:  line.Quantity,
+			UnitPrice: line.UnitPrice,
+			LineTotal: lineTotal,
+		})
+	}
+	return items, nil
+}
+
+// totalQuantity returns the number of units over all lines. It returns
+// ErrInvalidAmount if the sum does not fit the INTEGER quantity column.
+func totalQuantity(items []models.OrderItem) (int, error) {
+	total := 0
+	for _, item := range items {
+		if item.Quantity > math.MaxInt32-total {
+			return 0, fmt.Errorf("%w: total quantity exceeds %d", ErrInvalidAmount, math.MaxInt32)
+		}
+		total += item.Quantity
+	}
+	return total, nil
+}
+
+// totalPrice returns the sum of the line totals. It returns ErrInvalidAmount
+// if the sum is out of the range of Money.
+func totalPrice(items []models.OrderItem) (models.Money, error) {
+	var total models.Money
+	for _, item := range items {
+		var err error
+		if total, err = total.Add(item.LineTotal); err != nil {
+			return 0, fmt.Errorf("%w: the total price is too large", ErrInvalidAmount)
+		}
+	}
+	return total, nil
+}
@@ -2,113 +2,383 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"slices"
 	"time"
 
+	"casebrief/internal/auth"
 	"casebrief/internal/events"
 	"casebrief/internal/models"
 	"casebrief/internal/repository"
+	"casebrief/internal/tenant"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+// defaultListLimit is the page size used when the request does not specify one
+const defaultListLimit = 20
+
 // OrderService handles business logic for orders
 type OrderService struct {
-	repo      *repository.OrderRepository
-	eventChan chan *events.OrderCreatedEvent
-	logger    *zap.Logger
+	repo     repository.OrderStore
+	cache    *OrderCache
+	watchers *orderWatchers
+	logger   *zap.Logger
 }
 
-// NewOrderService creates a new order service
-func NewOrderService(repo *repository.OrderRepository, eventChan chan *events.OrderCreatedEvent, logger *zap.Logger) *OrderService {
+// NewOrderService creates a new order service. Orders read by ID are cached
+// in cache, if not nil. Write paths always read the order from the store, so
+// the checks of a write never rely on a cached order.
+func NewOrderService(repo repository.OrderStore, cache *OrderCache, logger *zap.Logger) *OrderService {
 	return &OrderService{
-		repo:      repo,
-		eventChan: eventChan,
-		logger:    logger,
+		repo:     repo,
+		cache:    cache,
+		watchers: newOrderWatchers(),
+		logger:   logger,
 	}
 }
 
-// CreateOrder creates a new order and emits an event
-func (s *OrderService) CreateOrder(ctx context.Context, endpointName, endpointScheme string, req *models.CreateOrderRequest) (*models.Order, error) {
-	// Check idempotency - if valid record exists, return saved response
-	savedResponse, err := s.repo.GetIdempotencyResponse(ctx, endpointName, endpointScheme, req.IdempotencyKey)
-	if err == nil && savedResponse != nil {
-		s.logger.Info("Idempotent request detected, returning saved response",
-			zap.String("endpoint_name", endpointName),
-			zap.String("endpoint_scheme", endpointScheme),
-			zap.String("idempotency_key", req.IdempotencyKey),
-		)
-
-		var order models.Order
-		if err := json.Unmarshal(savedResponse, &order); err != nil {
-			s.logger.Warn("Failed to unmarshal saved idempotency response, proceeding with new request",
-				zap.Error(err),
-			)
-			// Continue with normal flow if unmarshaling fails
-		} else {
-			return &order, nil
-		}
-	} else if err != nil && err != repository.ErrIdempotencyNotFound {
-		s.logger.Warn("Error checking idempotency, proceeding with new request",
-			zap.Error(err),
-		)
-		// Continue with normal flow if there's an error (but not "not found")
+// CreateOrder creates a new order for the tenant of the context and writes its
+// OrderCreated event to the outbox
+func (s *OrderService) CreateOrder(ctx context.Context, req *models.CreateOrderRequest) (*models.Order, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
 	}
 
-	// Create order
-	order := &models.Order{
-		CustomerID: req.CustomerID,
-		ProductID:  req.ProductID,
-		Quantity:   req.Quantity,
-		TotalPrice: req.TotalPrice,
-		OrderTime:  req.OrderTime,
+	// The totals are always computed from the lines
+	currency, decimals, err := orderCurrency(req)
+	if err != nil {
+		return nil, err
 	}
-
-	if err := s.repo.CreateOrder(ctx, order); err != nil {
+	items, err := orderItemsFromRequest(req, decimals)
+	if err != nil {
 		return nil, err
 	}
+	total, err := totalPrice(items)
+	if err != nil {
+		return nil, err
+	}
+	quantity, err := totalQuantity(items)
+	if err != nil {
+		return nil, err
+	}
+	order := &models.Order{
+		ID:         uuid.New().String(),
+		TenantID:   tenantID,
+		CustomerID: req.CustomerID,
+		ProductID:  items[0].ProductID,
+		Quantity:   quantity,
+		TotalPrice: total,
+		Currency:   currency,
+		OrderTime:  req.OrderTime,
+		Items:      items,
 
-	// Store idempotency response (default validity: 10 minutes)
-	validityDuration := 10 * time.Minute
-	if err := s.repo.StoreIdempotencyResponse(ctx, endpointName, endpointScheme, req.IdempotencyKey, order, validityDuration); err != nil {
-		s.logger.Warn("Failed to store idempotency response",
-			zap.Error(err),
-			zap.String("endpoint_name", endpointName),
-			zap.String("endpoint_scheme", endpointScheme),
-			zap.String("idempotency_key", req.IdempotencyKey),
-		)
-		// Don't fail the request if idempotency storage fails
+		ShippingAddress: req.ShippingAddress,
 	}
 
-	// Emit event
-	event := &events.OrderCreatedEvent{
+	// The event is stored in the outbox together with the order and
+	// delivered to the worker by the outbox relay
+	outboxEvent, err := events.NewOutboxEvent(ctx, &events.OrderCreatedEvent{
 		OrderID:    order.ID,
+		TenantID:   order.TenantID,
 		CustomerID: order.CustomerID,
 		ProductID:  order.ProductID,
 		Quantity:   order.Quantity,
 		TotalPrice: order.TotalPrice,
+		Currency:   order.Currency,
+		Items:      order.Items,
 		Timestamp:  time.Now().Unix(),
+
+		ShippingAddress: order.ShippingAddress,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	select {
-	case s.eventChan <- event:
-		s.logger.Info("OrderCreated event emitted",
-			zap.String("order_id", order.ID),
-		)
-	case <-ctx.Done():
-		s.logger.Warn("Context cancelled before event could be emitted",
-			zap.String("order_id", order.ID),
-		)
-	default:
-		s.logger.Warn("Event channel full, event not emitted",
-			zap.String("order_id", order.ID),
-		)
+	if err := s.repo.CreateOrder(ctx, order, outboxEvent); err != nil {
+		return nil, err
 	}
 
+	s.publishChange(OrderChangeCreated, order)
 	return order, nil
 }
 
-// GetOrderByID retrieves an order by ID
+// GetOrderByID retrieves an order by ID, through the cache if there is one
 func (s *OrderService) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
-	return s.repo.GetOrderByID(ctx, id)
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
+	}
+	key := orderCacheKey{tenantID: tenantID, orderID: id}
+	order, generation, ok := s.cache.get(key)
+	if ok {
+		return order, nil
+	}
+
+	order, err := s.repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.add(key, order, generation)
+	return order, nil
+}
+
+// TransitionOrder moves an order to a new status if the lifecycle allows it
+func (s *OrderService) TransitionOrder(ctx context.Context, id string, req *models.TransitionOrderRequest) (*models.Order, error) {
+	if !isKnownStatus(req.Status) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStatus, req.Status)
+	}
+	changedBy, err := actor(ctx, "changed_by", req.ChangedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := s.repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.changeStatus(ctx, order, req.Status, changedBy, models.CancelReasonOther, req.Reason)
+}
+
+// CancelOrder cancels an order and writes its OrderCancelled event to the outbox
+func (s *OrderService) CancelOrder(ctx context.Context, id string, req *models.CancelOrderRequest) (*models.Order, error) {
+	cancelledBy, err := actor(ctx, "cancelled_by", req.CancelledBy)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := s.repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.changeStatus(ctx, order, models.OrderStatusCancelled, cancelledBy, req.ReasonCode, req.Reason)
+}
+
+// actor returns who changes an order: the authenticated caller, or the one
+// named in the request field for anonymous requests. Callers cannot record a
+// change in someone else's name.
+func actor(ctx context.Context, field, named string) (string, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		if named == "" {
+			return "", fmt.Errorf("%w: %s is required", ErrInvalidActor, field)
+		}
+		return named, nil
+	}
+	if named != "" && named != principal.Subject {
+		return "", fmt.Errorf("%w: %s must be the authenticated caller %q or omitted", ErrInvalidActor, field, principal.Subject)
+	}
+	return principal.Subject, nil
+}
+
+// UpdateOrder replaces the lines and the shipping address of an order that is
+// still at the given version, recomputing its totals, and writes an
+// OrderUpdated event listing the changed fields to the outbox. It returns
+// repository.ErrOrderVersionMismatch if the order changed since that version,
+// and the order as is if the request changes nothing.
+func (s *OrderService) UpdateOrder(ctx context.Context, id string, version int64, req *models.UpdateOrderRequest) (*models.Order, error) {
+	return s.PatchOrder(ctx, id, version, func(*models.Order) (*models.UpdateOrderRequest, error) {
+		return req, nil
+	})
+}
+
+// PatchOrder is UpdateOrder with the request derived from the order by patch,
+// e.g. by applying a JSON merge patch. patch gets the order read from the
+// database, never a cached one, and only if it is at the given version, so a
+// patch cannot undo changes it was not based on.
+func (s *OrderService) PatchOrder(ctx context.Context, id string, version int64, patch func(current *models.Order) (*models.UpdateOrderRequest, error)) (*models.Order, error) {
+	order, err := s.repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order.Version != version {
+		return nil, fmt.Errorf("%w: the order is at version %d", repository.ErrOrderVersionMismatch, order.Version)
+	}
+	req, err := patch(order)
+	if err != nil {
+		return nil, err
+	}
+
+	decimals, ok := models.CurrencyDecimals(order.Currency)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, order.Currency)
+	}
+	items, err := orderLines(req.Items, decimals)
+	if err != nil {
+		return nil, err
+	}
+	total, err := totalPrice(items)
+	if err != nil {
+		return nil, err
+	}
+	quantity, err := totalQuantity(items)
+	if err != nil {
+		return nil, err
+	}
+	changed := *order
+	changed.Items = items
+	changed.ProductID = items[0].ProductID
+	changed.Quantity = quantity
+	changed.TotalPrice = total
+	changed.ShippingAddress = req.ShippingAddress
+
+	fields := changedFields(order, &changed)
+	if len(fields) == 0 {
+		return order, nil
+	}
+	if slices.Contains(fields, fieldItems) && !canChangeItems(order.Status) {
+		return nil, fmt.Errorf("%w: the items of a %s order cannot be changed", ErrOrderNotEditable, order.Status)
+	}
+	if slices.Contains(fields, fieldShippingAddress) && !canChangeShippingAddress(order.Status) {
+		return nil, fmt.Errorf("%w: the shipping address of a %s order cannot be changed", ErrOrderNotEditable, order.Status)
+	}
+
+	var updatedBy string
+	if principal, ok := auth.FromContext(ctx); ok {
+		updatedBy = principal.Subject
+	}
+	outboxEvent, err := events.NewOutboxEvent(ctx, &events.OrderUpdatedEvent{
+		OrderID:         changed.ID,
+		TenantID:        changed.TenantID,
+		CustomerID:      changed.CustomerID,
+		Version:         version + 1,
+		ChangedFields:   fields,
+		ProductID:       changed.ProductID,
+		Quantity:        changed.Quantity,
+		TotalPrice:      changed.TotalPrice,
+		Currency:        changed.Currency,
+		Items:           changed.Items,
+		ShippingAddress: changed.ShippingAddress,
+		UpdatedBy:       updatedBy,
+		Timestamp:       time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.UpdateOrder(ctx, &changed, version, outboxEvent)
+	// Failed writes invalidate too: a version mismatch means the order changed
+	s.cache.invalidate(orderCacheKey{tenantID: order.TenantID, orderID: order.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Order updated", append([]zap.Field{
+		zap.String("order_id", updated.ID),
+		zap.Int64("version", updated.Version),
+		zap.Strings("changed_fields", fields),
+	}, auth.LogFields(ctx)...)...)
+	s.publishChange(OrderChangeUpdated, updated)
+	return updated, nil
+}
+
+// changeStatus moves an order to a new status if the lifecycle allows it.
+// Cancellations also write an OrderCancelled event to the outbox, so
+// downstream systems can compensate whichever way the order was cancelled.
+func (s *OrderService) changeStatus(ctx context.Context, order *models.Order, status, changedBy, reasonCode, reason string) (*models.Order, error) {
+	if !canTransition(order.Status, status) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, order.Status, status)
+	}
+
+	var outboxEvent *models.OutboxEvent
+	if status == models.OrderStatusCancelled {
+		var err error
+		outboxEvent, err = events.NewOutboxEvent(ctx, &events.OrderCancelledEvent{
+			OrderID:        order.ID,
+			TenantID:       order.TenantID,
+			CustomerID:     order.CustomerID,
+			ProductID:      order.ProductID,
+			Quantity:       order.Quantity,
+			TotalPrice:     order.TotalPrice,
+			Currency:       order.Currency,
+			Items:          order.Items,
+			PreviousStatus: order.Status,
+			ReasonCode:     reasonCode,
+			Reason:         reason,
+			CancelledBy:    changedBy,
+			Timestamp:      time.Now().Unix(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := s.repo.UpdateOrderStatus(ctx, order.ID, order.Status, status, changedBy, reason, outboxEvent)
+	// Failed writes invalidate too: a status conflict means the order changed
+	s.cache.invalidate(orderCacheKey{tenantID: order.TenantID, orderID: order.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Order status transitioned", append([]zap.Field{
+		zap.String("order_id", updated.ID),
+		zap.String("from_status", order.Status),
+		zap.String("status", updated.Status),
+		zap.String("changed_by", changedBy),
+	}, auth.LogFields(ctx)...)...)
+	s.publishChange(OrderChangeStatusChanged, updated)
+	return updated, nil
+}
+
+// GetOrderStatusHistory retrieves the status history of an order
+func (s *OrderService) GetOrderStatusHistory(ctx context.Context, id string) ([]*models.OrderStatusChange, error) {
+	if _, err := s.repo.GetOrderByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetOrderStatusHistory(ctx, id)
+}
+
+// ListOrders retrieves a page of orders matching the request filters
+func (s *OrderService) ListOrders(ctx context.Context, req *models.ListOrdersRequest) (*models.OrderListResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	filter := repository.OrderFilter{
+		CustomerID:    req.CustomerID,
+		ProductID:     req.ProductID,
+		Status:        req.Status,
+		OrderTimeFrom: req.OrderTimeFrom,
+		OrderTimeTo:   req.OrderTimeTo,
+		CreatedFrom:   req.CreatedFrom,
+		CreatedTo:     req.CreatedTo,
+		// Fetch one extra row to know whether there is a next page
+		Limit: limit + 1,
+	}
+
+	if req.Cursor != "" {
+		createdAt, id, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.AfterCreatedAt = createdAt
+		filter.AfterID = id
+	}
+
+	orders, err := s.repo.ListOrders(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.OrderListResponse{Orders: orders}
+	if len(orders) > limit {
+		resp.Orders = orders[:limit]
+		last := resp.Orders[limit-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	if req.IncludeTotal {
+		total, err := s.repo.CountOrders(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		resp.TotalCount = &total
+	}
+
+	return resp, nil
 }
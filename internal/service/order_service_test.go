@@ -1,57 +1,652 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
+	"casebrief/internal/auth"
+	"casebrief/internal/events"
 	"casebrief/internal/models"
+	"casebrief/internal/repository"
+	"casebrief/internal/tenant"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
-// func TestOrderService_GetOrderByID(t *testing.T) {
-// 	logger, _ := zap.NewDevelopment()
-// 	eventChan := make(chan *events.OrderCreatedEvent, 10)
+func newTestOrderService() (*OrderService, *repository.MemoryStore) {
+	store := repository.NewMemoryStore()
+	return NewOrderService(store, nil, zap.NewNop()), store
+}
+
+func newCreateOrderRequest() *models.CreateOrderRequest {
+	return &models.CreateOrderRequest{
+		CustomerID: "customer-1",
+		Items: []models.CreateOrderItemRequest{
+			{ProductID: "product-1", Quantity: 2, UnitPrice: mustParseMoney("50.25")},
+			{ProductID: "product-2", Quantity: 1, UnitPrice: mustParseMoney("9.99")},
+		},
+		Currency:  "EUR",
+		OrderTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// claimEvents returns the events written to the outbox so far
+func claimEvents(t *testing.T, store *repository.MemoryStore) []events.Event {
+	t.Helper()
+
+	records, err := store.ClaimOutboxEvents(context.Background(), 100, time.Minute)
+	require.NoError(t, err)
+
+	decoded := make([]events.Event, 0, len(records))
+	for _, record := range records {
+		var event events.Event
+		switch record.EventType {
+		case events.EventTypeOrderCreated:
+			event = &events.OrderCreatedEvent{}
+		case events.EventTypeOrderCancelled:
+			event = &events.OrderCancelledEvent{}
+		case events.EventTypeOrderUpdated:
+			event = &events.OrderUpdatedEvent{}
+		default:
+			t.Fatalf("unexpected event type %q", record.EventType)
+		}
+		require.NoError(t, json.Unmarshal(record.Payload, event))
+		decoded = append(decoded, event)
+	}
+	return decoded
+}
+
+func TestOrderService_CreateOrder(t *testing.T) {
+	svc, _ := newTestOrderService()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, order.ID)
+	assert.Equal(t, models.OrderStatusCreated, order.Status)
+	assert.Equal(t, "EUR", order.Currency)
+	assert.Equal(t, "product-1", order.ProductID)
+	assert.Equal(t, 3, order.Quantity)
+	assert.Equal(t, mustParseMoney("110.49"), order.TotalPrice)
+
+	stored, err := svc.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, order.TotalPrice, stored.TotalPrice)
+	assert.Len(t, stored.Items, 2)
+}
+
+func TestOrderService_CreateOrder_InvalidAmount(t *testing.T) {
+	svc, store := newTestOrderService()
+
+	req := newCreateOrderRequest()
+	req.Currency = "JPY"
+	_, err := svc.CreateOrder(tenant.NewContext(context.Background(), "default"), req)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	// Nothing is stored for rejected requests
+	assert.Empty(t, claimEvents(t, store))
+}
+
+func TestOrderService_CreateOrder_EmitsOrderCreated(t *testing.T) {
+	svc, store := newTestOrderService()
+
+	order, err := svc.CreateOrder(tenant.NewContext(context.Background(), "acme"), newCreateOrderRequest())
+	require.NoError(t, err)
+	assert.Equal(t, "acme", order.TenantID)
+
+	emitted := claimEvents(t, store)
+	require.Len(t, emitted, 1)
+	created, ok := emitted[0].(*events.OrderCreatedEvent)
+	require.True(t, ok)
+	assert.Equal(t, order.ID, created.OrderID)
+	assert.Equal(t, "acme", created.TenantID)
+	assert.Equal(t, order.TotalPrice, created.TotalPrice)
+	assert.Equal(t, order.Items, created.Items)
+}
+
+func TestOrderService_CancelOrder_EmitsOrderCancelled(t *testing.T) {
+	svc, store := newTestOrderService()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+	require.NoError(t, err)
+
+	cancelled, err := svc.CancelOrder(ctx, order.ID, &models.CancelOrderRequest{
+		ReasonCode:  models.CancelReasonCustomerRequest,
+		CancelledBy: "customer-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCancelled, cancelled.Status)
+
+	emitted := claimEvents(t, store)
+	require.Len(t, emitted, 2)
+	event, ok := emitted[1].(*events.OrderCancelledEvent)
+	require.True(t, ok)
+	assert.Equal(t, order.ID, event.OrderID)
+	assert.Equal(t, "default", event.TenantID)
+	assert.Equal(t, models.OrderStatusCreated, event.PreviousStatus)
+	assert.Equal(t, models.CancelReasonCustomerRequest, event.ReasonCode)
+
+	history, err := svc.GetOrderStatusHistory(ctx, order.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, models.OrderStatusCancelled, history[0].ToStatus)
+
+	// A cancelled order cannot be cancelled again
+	_, err = svc.CancelOrder(ctx, order.ID, &models.CancelOrderRequest{
+		ReasonCode:  models.CancelReasonCustomerRequest,
+		CancelledBy: "customer-1",
+	})
+	assert.ErrorIs(t, err, ErrIllegalTransition)
+}
+
+func TestOrderService_TransitionOrder(t *testing.T) {
+	svc, store := newTestOrderService()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+	require.NoError(t, err)
+
+	confirmed, err := svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: models.OrderStatusConfirmed, ChangedBy: "ops"})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusConfirmed, confirmed.Status)
+
+	_, err = svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: models.OrderStatusDelivered, ChangedBy: "ops"})
+	assert.ErrorIs(t, err, ErrIllegalTransition)
+
+	_, err = svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: "lost", ChangedBy: "ops"})
+	assert.ErrorIs(t, err, ErrUnknownStatus)
 
-// 	service := NewOrderService(nil, eventChan, logger)
+	_, err = svc.TransitionOrder(ctx, "missing", &models.TransitionOrderRequest{Status: models.OrderStatusConfirmed, ChangedBy: "ops"})
+	assert.ErrorIs(t, err, repository.ErrOrderNotFound)
 
-// 	ctx := context.Background()
-// 	order, err := service.GetOrderByID(ctx, "non-existent-id")
+	// Only the creation emitted an event
+	assert.Len(t, claimEvents(t, store), 1)
+}
+
+func TestOrderService_ChangeStatus_RecordsCaller(t *testing.T) {
+	svc, store := newTestOrderService()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+	require.NoError(t, err)
+
+	// Anonymous requests must name who changes the order
+	_, err = svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: models.OrderStatusConfirmed})
+	assert.ErrorIs(t, err, ErrInvalidActor)
+
+	// Authenticated callers are recorded and cannot name someone else
+	ctx = auth.NewContext(ctx, &auth.Principal{Subject: "back-office", Method: auth.MethodAPIKey})
+	_, err = svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: models.OrderStatusConfirmed, ChangedBy: "someone-else"})
+	assert.ErrorIs(t, err, ErrInvalidActor)
+	_, err = svc.CancelOrder(ctx, order.ID, &models.CancelOrderRequest{ReasonCode: models.CancelReasonOther, CancelledBy: "someone-else"})
+	assert.ErrorIs(t, err, ErrInvalidActor)
+
+	_, err = svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: models.OrderStatusConfirmed})
+	require.NoError(t, err)
+	_, err = svc.CancelOrder(ctx, order.ID, &models.CancelOrderRequest{ReasonCode: models.CancelReasonOther, CancelledBy: "back-office"})
+	require.NoError(t, err)
+
+	history, err := svc.GetOrderStatusHistory(ctx, order.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "back-office", history[0].ChangedBy)
+	assert.Equal(t, "back-office", history[1].ChangedBy)
+
+	emitted := claimEvents(t, store)
+	require.Len(t, emitted, 2)
+	event, ok := emitted[1].(*events.OrderCancelledEvent)
+	require.True(t, ok)
+	assert.Equal(t, "back-office", event.CancelledBy)
+}
+
+func TestOrderService_UpdateOrder_EmitsOrderUpdated(t *testing.T) {
+	svc, store := newTestOrderService()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), order.Version)
+
+	address := &models.ShippingAddress{Name: "Ada", Line1: "Main St 1", PostalCode: "1011", City: "Budapest", Country: "HU"}
+	updated, err := svc.UpdateOrder(ctx, order.ID, 1, &models.UpdateOrderRequest{
+		Items: []models.CreateOrderItemRequest{
+			{ProductID: "product-1", Quantity: 3, UnitPrice: mustParseMoney("50.25")},
+			{ProductID: "product-2", Quantity: 1, UnitPrice: mustParseMoney("9.99")},
+		},
+		ShippingAddress: address,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+	assert.Equal(t, 4, updated.Quantity)
+	assert.Equal(t, mustParseMoney("160.74"), updated.TotalPrice)
+	assert.Equal(t, address, updated.ShippingAddress)
+
+	emitted := claimEvents(t, store)
+	require.Len(t, emitted, 2)
+	event, ok := emitted[1].(*events.OrderUpdatedEvent)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), event.Version)
+	assert.Equal(t, []string{"items", "quantity", "total_price", "shipping_address"}, event.ChangedFields)
+	assert.Equal(t, updated.Items, event.Items)
+
+	// Nothing changes and nothing is emitted for a request without changes
+	unchanged, err := svc.UpdateOrder(ctx, order.ID, 2, &models.UpdateOrderRequest{
+		Items: []models.CreateOrderItemRequest{
+			{ProductID: "product-1", Quantity: 3, UnitPrice: mustParseMoney("50.25")},
+			{ProductID: "product-2", Quantity: 1, UnitPrice: mustParseMoney("9.99")},
+		},
+		ShippingAddress: address,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), unchanged.Version)
+	assert.Empty(t, claimEvents(t, store))
+}
+
+func TestOrderService_UpdateOrder_Rejected(t *testing.T) {
+	svc, _ := newTestOrderService()
+	ctx := tenant.NewContext(context.Background(), "default")
 
-// 	// Should return error when repository is nil (for testing structure)
-// 	assert.Error(t, err)
-// 	assert.Nil(t, order)
-// }
+	order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+	require.NoError(t, err)
+	items := []models.CreateOrderItemRequest{{ProductID: "product-1", Quantity: 1, UnitPrice: mustParseMoney("50.25")}}
+	address := &models.ShippingAddress{Name: "Ada", Line1: "Main St 1", PostalCode: "1011", City: "Budapest", Country: "HU"}
 
-func TestOrderService_CreateOrder_Validation(t *testing.T) {
-	//logger, _ := zap.NewDevelopment()
-	//eventChan := make(chan *events.OrderCreatedEvent, 10)
+	// Status changes move the version too
+	_, err = svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: models.OrderStatusConfirmed, ChangedBy: "ops"})
+	require.NoError(t, err)
+	_, err = svc.UpdateOrder(ctx, order.ID, 1, &models.UpdateOrderRequest{Items: items})
+	assert.ErrorIs(t, err, repository.ErrOrderVersionMismatch)
+
+	_, err = svc.UpdateOrder(ctx, order.ID, 2, &models.UpdateOrderRequest{Items: []models.CreateOrderItemRequest{{ProductID: "product-1", Quantity: 1, UnitPrice: mustParseMoney("1.001")}}})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	// Paid orders keep their items but may still get a new address
+	_, err = svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: models.OrderStatusPaid, ChangedBy: "ops"})
+	require.NoError(t, err)
+	_, err = svc.UpdateOrder(ctx, order.ID, 3, &models.UpdateOrderRequest{Items: items})
+	assert.ErrorIs(t, err, ErrOrderNotEditable)
+
+	paid, err := svc.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+	updated, err := svc.UpdateOrder(ctx, order.ID, 3, &models.UpdateOrderRequest{Items: []models.CreateOrderItemRequest{
+		{ProductID: "product-1", Quantity: 2, UnitPrice: mustParseMoney("50.25")},
+		{ProductID: "product-2", Quantity: 1, UnitPrice: mustParseMoney("9.99")},
+	}, ShippingAddress: address})
+	require.NoError(t, err)
+	assert.Equal(t, paid.Items, updated.Items)
+	assert.Equal(t, address, updated.ShippingAddress)
+
+	_, err = svc.UpdateOrder(ctx, "missing", 1, &models.UpdateOrderRequest{Items: items})
+	assert.ErrorIs(t, err, repository.ErrOrderNotFound)
+}
+
+// countingStore counts the orders read by ID from the store
+type countingStore struct {
+	*repository.MemoryStore
+	reads int
+}
+
+func (s *countingStore) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
+	s.reads++
+	return s.MemoryStore.GetOrderByID(ctx, id)
+}
+
+func TestOrderService_GetOrderByID_Cache(t *testing.T) {
+	store := &countingStore{MemoryStore: repository.NewMemoryStore()}
+	svc := NewOrderService(store, NewOrderCache(10, time.Minute), zap.NewNop())
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+	require.NoError(t, err)
+
+	// The second read is served from the cache, with a copy of the order
+	first, err := svc.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+	first.Items[0].Quantity = 100
+	second, err := svc.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Items[0].Quantity)
+	assert.Equal(t, 1, store.reads)
+
+	// Orders are cached per tenant
+	_, err = svc.GetOrderByID(tenant.NewContext(context.Background(), "acme"), order.ID)
+	assert.ErrorIs(t, err, repository.ErrOrderNotFound)
+
+	// Every write invalidates the order, failed writes included
+	_, err = svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: models.OrderStatusConfirmed, ChangedBy: "ops"})
+	require.NoError(t, err)
+	current, err := svc.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusConfirmed, current.Status)
+
+	_, err = svc.UpdateOrder(ctx, order.ID, current.Version, &models.UpdateOrderRequest{Items: []models.CreateOrderItemRequest{
+		{ProductID: "product-1", Quantity: 1, UnitPrice: mustParseMoney("50.25")},
+	}})
+	require.NoError(t, err)
+	current, err = svc.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, current.Quantity)
+
+	_, err = svc.CancelOrder(ctx, order.ID, &models.CancelOrderRequest{ReasonCode: models.CancelReasonCustomerRequest, CancelledBy: "customer-1"})
+	require.NoError(t, err)
+	current, err = svc.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCancelled, current.Status)
+}
 
-	//service := NewOrderService(nil, eventChan, logger)
+func TestOrderCache_SkipsReadsRacingWithWrites(t *testing.T) {
+	cache := NewOrderCache(10, time.Minute)
+	key := orderCacheKey{tenantID: "default", orderID: "order-1"}
 
+	// The order was read from the store before a write invalidated it
+	_, generation, ok := cache.get(key)
+	require.False(t, ok)
+	cache.invalidate(orderCacheKey{tenantID: "default", orderID: "order-2"})
+	cache.add(key, &models.Order{ID: "order-1", Version: 1}, generation)
+	_, _, ok = cache.get(key)
+	assert.False(t, ok)
+
+	_, generation, _ = cache.get(key)
+	cache.add(key, &models.Order{ID: "order-1", Version: 2}, generation)
+	cached, _, ok := cache.get(key)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), cached.Version)
+
+	// A nil cache caches nothing
+	var disabled *OrderCache
+	disabled.add(key, cached, 0)
+	_, _, ok = disabled.get(key)
+	assert.False(t, ok)
+}
+
+func TestOrderService_WatchOrders(t *testing.T) {
+	svc, _ := newTestOrderService()
+	ctx := tenant.NewContext(context.Background(), "default")
+	watchCtx, cancel := context.WithCancel(ctx)
+
+	_, err := svc.WatchOrders(context.Background())
+	assert.ErrorIs(t, err, tenant.ErrMissing)
+
+	changes, err := svc.WatchOrders(watchCtx)
+	require.NoError(t, err)
+
+	_, err = svc.CreateOrder(tenant.NewContext(context.Background(), "acme"), newCreateOrderRequest())
+	require.NoError(t, err)
+	order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+	require.NoError(t, err)
+	_, err = svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: models.OrderStatusConfirmed, ChangedBy: "test"})
+	require.NoError(t, err)
+
+	// Changes of other tenants are not seen
+	change := <-changes
+	assert.Equal(t, OrderChangeCreated, change.Kind)
+	assert.Equal(t, order.ID, change.Order.ID)
+	change = <-changes
+	assert.Equal(t, OrderChangeStatusChanged, change.Kind)
+	assert.Equal(t, models.OrderStatusConfirmed, change.Order.Status)
+
+	cancel()
+	_, ok := <-changes
+	assert.False(t, ok)
+}
+
+func TestOrderService_WatchOrders_ChangeFeed(t *testing.T) {
+	svc, _ := newTestOrderService()
+	svc.UseChangeFeed()
+	ctx := tenant.NewContext(context.Background(), "default")
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Changes are only notified once, by the feed, not by the write paths
+	order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+	require.NoError(t, err)
+	changes, err := svc.WatchOrders(watchCtx)
+	require.NoError(t, err)
+	_, err = svc.TransitionOrder(ctx, order.ID, &models.TransitionOrderRequest{Status: models.OrderStatusConfirmed, ChangedBy: "test"})
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// The superseded version 1 is skipped
+	require.NoError(t, svc.NotifyOrderChange(ctx, OrderChangeCreated, order.ID, 1))
+	require.NoError(t, svc.NotifyOrderChange(ctx, OrderChangeStatusChanged, order.ID, 2))
+	change := <-changes
+	assert.Equal(t, OrderChangeStatusChanged, change.Kind)
+	assert.Equal(t, models.OrderStatusConfirmed, change.Order.Status)
+	assert.Empty(t, changes)
+
+	// Tenants without watchers are not read
+	acme := tenant.NewContext(context.Background(), "acme")
+	assert.NoError(t, svc.NotifyOrderChange(acme, OrderChangeCreated, "missing", 1))
+}
+
+func TestOrderService_NotifyOrderChange_InvalidatesCache(t *testing.T) {
+	store := &countingStore{MemoryStore: repository.NewMemoryStore()}
+	svc := NewOrderService(store, NewOrderCache(10, time.Minute), zap.NewNop())
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+	require.NoError(t, err)
+	_, err = svc.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+
+	// A change of another replica, written to the store directly, is read
+	// again once it is notified, even without watchers
+	_, err = store.UpdateOrderStatus(ctx, order.ID, models.OrderStatusCreated, models.OrderStatusConfirmed, "ops", "", nil)
+	require.NoError(t, err)
+	cached, err := svc.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCreated, cached.Status)
+
+	require.NoError(t, svc.NotifyOrderChange(ctx, OrderChangeStatusChanged, order.ID, 2))
+	current, err := svc.GetOrderByID(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusConfirmed, current.Status)
+	assert.Equal(t, 2, store.reads)
+}
+
+func TestOrderService_WatchOrders_DropsSlowWatchers(t *testing.T) {
+	svc, _ := newTestOrderService()
+	ctx, cancel := context.WithCancel(tenant.NewContext(context.Background(), "default"))
+	defer cancel()
+
+	changes, err := svc.WatchOrders(ctx)
+	require.NoError(t, err)
+	for i := 0; i <= watchBuffer; i++ {
+		_, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+		require.NoError(t, err)
+	}
+
+	received := 0
+	for range changes {
+		received++
+	}
+	assert.Equal(t, watchBuffer, received)
+	assert.NoError(t, ctx.Err())
+}
+
+func TestOrderService_ListOrders_Pagination(t *testing.T) {
+	svc, _ := newTestOrderService()
+	ctx := tenant.NewContext(context.Background(), "default")
+
+	created := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		order, err := svc.CreateOrder(ctx, newCreateOrderRequest())
+		require.NoError(t, err)
+		created[order.ID] = true
+	}
+
+	seen := map[string]bool{}
+	req := &models.ListOrdersRequest{Limit: 2, IncludeTotal: true}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5)
+
+		resp, err := svc.ListOrders(ctx, req)
+		require.NoError(t, err)
+		require.NotNil(t, resp.TotalCount)
+		assert.Equal(t, int64(5), *resp.TotalCount)
+		for _, order := range resp.Orders {
+			assert.False(t, seen[order.ID], "order listed twice")
+			seen[order.ID] = true
+		}
+
+		if resp.NextCursor == "" {
+			break
+		}
+		req.Cursor = resp.NextCursor
+	}
+	assert.Equal(t, created, seen)
+}
+
+func TestCursor_RoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+
+	cursor := encodeCursor(createdAt, "order-1")
+
+	gotCreatedAt, gotID, err := decodeCursor(cursor)
+	assert.NoError(t, err)
+	assert.True(t, createdAt.Equal(gotCreatedAt))
+	assert.Equal(t, "order-1", gotID)
+}
+
+func TestCursor_Invalid(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm8tc2VwYXJhdG9y", "eHx5"} {
+		_, _, err := decodeCursor(cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor, cursor)
+	}
+}
+
+func TestCanTransition(t *testing.T) {
 	tests := []struct {
-		name string
-		req  *models.CreateOrderRequest
+		from, to string
+		allowed  bool
 	}{
-		{
-			name: "valid request structure",
-			req: &models.CreateOrderRequest{
-				CustomerID:     "customer-1",
-				ProductID:      "product-1",
-				Quantity:       2,
-				TotalPrice:     100.50,
-				IdempotencyKey: "key-1",
-			},
-		},
+		{models.OrderStatusCreated, models.OrderStatusConfirmed, true},
+		{models.OrderStatusCreated, models.OrderStatusCancelled, true},
+		{models.OrderStatusCreated, models.OrderStatusPaid, false},
+		{models.OrderStatusConfirmed, models.OrderStatusPaid, true},
+		{models.OrderStatusPaid, models.OrderStatusShipped, true},
+		{models.OrderStatusPaid, models.OrderStatusRefunded, true},
+		{models.OrderStatusShipped, models.OrderStatusDelivered, true},
+		{models.OrderStatusShipped, models.OrderStatusCancelled, false},
+		{models.OrderStatusDelivered, models.OrderStatusRefunded, true},
+		{models.OrderStatusCancelled, models.OrderStatusCreated, false},
+		{models.OrderStatusRefunded, models.OrderStatusPaid, false},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Verify request structure is valid
-			assert.NotEmpty(t, tt.req.CustomerID)
-			assert.NotEmpty(t, tt.req.ProductID)
-			assert.Greater(t, tt.req.Quantity, 0)
-			assert.GreaterOrEqual(t, tt.req.TotalPrice, 0.0)
-			assert.NotEmpty(t, tt.req.IdempotencyKey)
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, canTransition(tt.from, tt.to))
 		})
 	}
 }
+
+func mustParseMoney(s string) models.Money {
+	m, err := models.ParseMoney(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestOrderItemsFromRequest(t *testing.T) {
+	t.Run("multiple lines", func(t *testing.T) {
+		items, err := orderItemsFromRequest(&models.CreateOrderRequest{
+			Items: []models.CreateOrderItemRequest{
+				{ProductID: "product-1", Quantity: 3, UnitPrice: mustParseMoney("0.10")},
+				{ProductID: "product-2", Quantity: 1, UnitPrice: mustParseMoney("19.99")},
+			},
+		}, 2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []models.OrderItem{
+			{ProductID: "product-1", Quantity: 3, UnitPrice: mustParseMoney("0.10"), LineTotal: mustParseMoney("0.30")},
+			{ProductID: "product-2", Quantity: 1, UnitPrice: mustParseMoney("19.99"), LineTotal: mustParseMoney("19.99")},
+		}, items)
+		quantity, err := totalQuantity(items)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, quantity)
+		total, err := totalPrice(items)
+		assert.NoError(t, err)
+		assert.Equal(t, "20.29", total.String())
+	})
+
+	t.Run("single product fields", func(t *testing.T) {
+		items, err := orderItemsFromRequest(&models.CreateOrderRequest{
+			ProductID:  "product-1",
+			Quantity:   3,
+			TotalPrice: mustParseMoney("100.00"),
+		}, 2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []models.OrderItem{
+			{ProductID: "product-1", Quantity: 3, UnitPrice: mustParseMoney("33.33"), LineTotal: mustParseMoney("100.00")},
+		}, items)
+	})
+
+	t.Run("too many decimal places for currency", func(t *testing.T) {
+		_, err := orderItemsFromRequest(&models.CreateOrderRequest{
+			Items: []models.CreateOrderItemRequest{
+				{ProductID: "product-1", Quantity: 1, UnitPrice: mustParseMoney("100.5")},
+			},
+		}, 0)
+
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+	})
+
+	t.Run("line total out of range", func(t *testing.T) {
+		_, err := orderItemsFromRequest(&models.CreateOrderRequest{
+			Items: []models.CreateOrderItemRequest{
+				{ProductID: "product-1", Quantity: 1000, UnitPrice: mustParseMoney("922337203685477.58")},
+			},
+		}, 2)
+
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+	})
+
+	t.Run("total price out of range", func(t *testing.T) {
+		items, err := orderItemsFromRequest(&models.CreateOrderRequest{
+			Items: []models.CreateOrderItemRequest{
+				{ProductID: "product-1", Quantity: 1, UnitPrice: mustParseMoney("922337203685477.00")},
+				{ProductID: "product-2", Quantity: 1, UnitPrice: mustParseMoney("1.00")},
+			},
+		}, 2)
+		require.NoError(t, err)
+
+		_, err = totalPrice(items)
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+	})
+
+	t.Run("total quantity out of range", func(t *testing.T) {
+		items, err := orderItemsFromRequest(&models.CreateOrderRequest{
+			Items: []models.CreateOrderItemRequest{
+				{ProductID: "product-1", Quantity: 2147483647, UnitPrice: mustParseMoney("0.00")},
+				{ProductID: "product-2", Quantity: 1, UnitPrice: mustParseMoney("0.00")},
+			},
+		}, 2)
+		require.NoError(t, err)
+
+		_, err = totalQuantity(items)
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+	})
+}
+
+func TestOrderCurrency(t *testing.T) {
+	currency, decimals, err := orderCurrency(&models.CreateOrderRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultCurrency, currency)
+	assert.Equal(t, 2, decimals)
+
+	currency, decimals, err = orderCurrency(&models.CreateOrderRequest{Currency: "jpy"})
+	assert.NoError(t, err)
+	assert.Equal(t, "JPY", currency)
+	assert.Equal(t, 0, decimals)
+
+	_, _, err = orderCurrency(&models.CreateOrderRequest{Currency: "XXQ"})
+	assert.ErrorIs(t, err, ErrUnsupportedCurrency)
+}
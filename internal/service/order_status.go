@@ -0,0 +1,43 @@
+package service
+
+import "casebrief/internal/models"
+
+// statusTransitions lists the statuses an order can move to from each status.
+// Statuses without outgoing transitions are terminal.
+var statusTransitions = map[string][]string{
+	models.OrderStatusCreated:   {models.OrderStatusConfirmed, models.OrderStatusCancelled},
+	models.OrderStatusConfirmed: {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:      {models.OrderStatusShipped, models.OrderStatusRefunded},
+	models.OrderStatusShipped:   {models.OrderStatusDelivered},
+	models.OrderStatusDelivered: {models.OrderStatusRefunded},
+	models.OrderStatusCancelled: {},
+	models.OrderStatusRefunded:  {},
+}
+
+// isKnownStatus reports whether status is part of the order lifecycle
+func isKnownStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// canChangeItems reports whether the lines of an order in the status may
+// change; once an order is paid its total is fixed
+func canChangeItems(status string) bool {
+	return status == models.OrderStatusCreated || status == models.OrderStatusConfirmed
+}
+
+// canChangeShippingAddress reports whether the shipping address of an order
+// in the status may change, which is until the order is shipped
+func canChangeShippingAddress(status string) bool {
+	return canChangeItems(status) || status == models.OrderStatusPaid
+}
+
+// canTransition reports whether an order may move from one status to another
+func canTransition(from, to string) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"casebrief/internal/models"
+	"casebrief/internal/tenant"
+)
+
+// watchBuffer is the number of changes buffered per watcher
+const watchBuffer = 64
+
+// Kinds of order changes
+const (
+	OrderChangeCreated       = "created"
+	OrderChangeUpdated       = "updated"
+	OrderChangeStatusChanged = "status_changed"
+)
+
+// OrderChange is a change of an order and the order after the change
+type OrderChange struct {
+	// Kind is OrderChangeCreated, OrderChangeUpdated or OrderChangeStatusChanged
+	Kind  string
+	Order *models.Order
+}
+
+// orderWatchers fans the changes of orders out to the watchers of their
+// tenant. Sending never blocks the write paths: watchers that do not keep up
+// are dropped.
+type orderWatchers struct {
+	mu       sync.Mutex
+	watchers map[string]map[chan *OrderChange]struct{}
+	// changeFeed is set if the changes are received from NotifyOrderChange
+	// rather than published by the write paths
+	changeFeed bool
+}
+
+func newOrderWatchers() *orderWatchers {
+	return &orderWatchers{watchers: make(map[string]map[chan *OrderChange]struct{})}
+}
+
+// WatchOrders returns the changes of the orders of the context's tenant made
+// from now on: those made through this service, or with UseChangeFeed those
+// notified by NotifyOrderChange. The channel is closed once ctx is done, or
+// earlier, while ctx.Err() is still nil, if the caller does not keep up.
+func (s *OrderService) WatchOrders(ctx context.Context) (<-chan *OrderChange, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
+	}
+
+	changes := make(chan *OrderChange, watchBuffer)
+	s.watchers.mu.Lock()
+	if s.watchers.watchers[tenantID] == nil {
+		s.watchers.watchers[tenantID] = make(map[chan *OrderChange]struct{})
+	}
+	s.watchers.watchers[tenantID][changes] = struct{}{}
+	s.watchers.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.watchers.remove(tenantID, changes)
+	}()
+	return changes, nil
+}
+
+// UseChangeFeed makes watchers see the changes passed to NotifyOrderChange,
+// e.g. the changes of all replicas received from the database, instead of the
+// changes made through this service. It must be called before the service is
+// used.
+func (s *OrderService) UseChangeFeed() {
+	s.watchers.changeFeed = true
+}
+
+// NotifyOrderChange invalidates the cached order of a committed change and
+// publishes the change to the watchers of the context's tenant, reading the
+// order from the store if the tenant has watchers. A change whose version was
+// superseded is skipped; the later change is notified too.
+func (s *OrderService) NotifyOrderChange(ctx context.Context, kind, id string, version int64) error {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return tenant.ErrMissing
+	}
+	// The change may have been made through another replica
+	s.cache.invalidate(orderCacheKey{tenantID: tenantID, orderID: id})
+	if !s.watchers.watching(tenantID) {
+		return nil
+	}
+
+	order, err := s.repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if order.Version == version {
+		s.watchers.publish(kind, order)
+	}
+	return nil
+}
+
+// publishChange publishes a change made through the service, unless the
+// watchers are fed by NotifyOrderChange
+func (s *OrderService) publishChange(kind string, order *models.Order) {
+	if !s.watchers.changeFeed {
+		s.watchers.publish(kind, order)
+	}
+}
+
+// publish sends a copy of the changed order to the watchers of its tenant
+func (w *orderWatchers) publish(kind string, order *models.Order) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for changes := range w.watchers[order.TenantID] {
+		select {
+		case changes <- &OrderChange{Kind: kind, Order: order.Clone()}:
+		default:
+			w.removeLocked(order.TenantID, changes)
+		}
+	}
+}
+
+// watching reports whether the tenant has watchers
+func (w *orderWatchers) watching(tenantID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.watchers[tenantID]) > 0
+}
+
+// remove closes and forgets a watcher, unless it was removed already
+func (w *orderWatchers) remove(tenantID string, changes chan *OrderChange) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.removeLocked(tenantID, changes)
+}
+
+func (w *orderWatchers) removeLocked(tenantID string, changes chan *OrderChange) {
+	if _, ok := w.watchers[tenantID][changes]; !ok {
+		return
+	}
+	delete(w.watchers[tenantID], changes)
+	if len(w.watchers[tenantID]) == 0 {
+		delete(w.watchers, tenantID)
+	}
+	close(changes)
+}
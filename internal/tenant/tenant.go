@@ -0,0 +1,36 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+// Header is the request header selecting the tenant of callers that are not
+// bound to one
+const Header = "X-Tenant-ID"
+
+// ErrMissing is returned by tenant-scoped storage when the context carries no
+// tenant
+var ErrMissing = errors.New("no tenant in context")
+
+// idPattern matches valid tenant IDs; they fit the tenant_id columns
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// Valid reports whether id is a valid tenant ID
+func Valid(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+type tenantKey struct{}
+
+// NewContext returns a copy of ctx carrying the tenant
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext returns the tenant of the request
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantKey{}).(string)
+	return id, ok && id != ""
+}
@@ -2,8 +2,15 @@ package tracing
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"casebrief/internal/config"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -12,32 +19,30 @@ import (
 	"go.uber.org/zap"
 )
 
-// InitTracing initializes OpenTelemetry tracing
-func InitTracing(serviceName string, logger *zap.Logger) (func(), error) {
-	// Create stdout exporter
-	exporter, err := stdouttrace.New(
-		stdouttrace.WithPrettyPrint(),
-	)
-	if err != nil {
-		return nil, err
-	}
+// Trace exporters selectable with config.Config.TracesExporter
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
 
-	// Create resource
-	res, err := resource.New(context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String(serviceName),
-		),
-	)
+// OTLP protocols selectable with config.Config.OTLPProtocol
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http/protobuf"
+)
+
+// otlpTracesPath is appended to the OTLP endpoint when exporting over HTTP
+const otlpTracesPath = "/v1/traces"
+
+// InitTracing initializes OpenTelemetry tracing with the exporter, sampler
+// and resource attributes of the configuration
+func InitTracing(cfg *config.Config, serviceName string, logger *zap.Logger) (func(), error) {
+	tp, err := NewTracerProvider(context.Background(), cfg, serviceName)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create trace provider
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
-
 	otel.SetTracerProvider(tp)
 	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
 		propagation.TraceContext{},
@@ -46,6 +51,8 @@ func InitTracing(serviceName string, logger *zap.Logger) (func(), error) {
 
 	logger.Info("OpenTelemetry tracing initialized",
 		zap.String("service_name", serviceName),
+		zap.String("exporter", cfg.TracesExporter),
+		zap.Float64("sample_ratio", cfg.TracesSampleRatio),
 	)
 
 	return func() {
@@ -55,3 +62,80 @@ func InitTracing(serviceName string, logger *zap.Logger) (func(), error) {
 	}, nil
 }
 
+// NewTracerProvider creates a trace provider sampling cfg.TracesSampleRatio of
+// the root spans and following the parent's decision otherwise. With
+// ExporterNone spans are still created, so trace context is propagated, but
+// they are not exported.
+func NewTracerProvider(ctx context.Context, cfg *config.Config, serviceName string) (*sdktrace.TracerProvider, error) {
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(cfg.ServiceVersion),
+			semconv.ServiceInstanceIDKey.String(cfg.ServiceInstanceID),
+			semconv.DeploymentEnvironmentKey.String(cfg.Environment),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracesSampleRatio))),
+	}
+
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	return sdktrace.NewTracerProvider(opts...), nil
+}
+
+// newExporter creates the span exporter selected by cfg.TracesExporter, or
+// nil for ExporterNone
+func newExporter(ctx context.Context, cfg *config.Config) (sdktrace.SpanExporter, error) {
+	switch cfg.TracesExporter {
+	case ExporterOTLP:
+		return newOTLPExporter(ctx, cfg)
+	case ExporterStdout:
+		return stdouttrace.New()
+	case ExporterNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown traces exporter %q", cfg.TracesExporter)
+	}
+}
+
+// newOTLPExporter creates an OTLP exporter for cfg.OTLPEndpoint, a URL such as
+// http://otel-collector:4317. Plain http endpoints are used without TLS.
+func newOTLPExporter(ctx context.Context, cfg *config.Config) (sdktrace.SpanExporter, error) {
+	endpoint, err := url.Parse(cfg.OTLPEndpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", cfg.OTLPEndpoint)
+	}
+	insecure := endpoint.Scheme == "http"
+
+	switch cfg.OTLPProtocol {
+	case ProtocolGRPC:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint.Host)}
+		if insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case ProtocolHTTP:
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(endpoint.Host),
+			otlptracehttp.WithURLPath(strings.TrimSuffix(endpoint.Path, "/") + otlpTracesPath),
+		}
+		if insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q", cfg.OTLPProtocol)
+	}
+}
@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"casebrief/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeCollector is an in-process stand-in for an OpenTelemetry collector
+// receiving OTLP traces over gRPC and HTTP
+type fakeCollector struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	mu    sync.Mutex
+	spans []*tracepb.ResourceSpans
+}
+
+func (c *fakeCollector) Export(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.spans = append(c.spans, req.ResourceSpans...)
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+func (c *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != otlpTracesPath {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &collectortrace.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, _ := c.Export(r.Context(), req)
+	payload, _ := proto.Marshal(resp)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(payload)
+}
+
+// received returns the exported spans by name with the attributes of their resource
+func (c *fakeCollector) received() map[string]map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	spans := map[string]map[string]string{}
+	for _, resourceSpans := range c.spans {
+		attributes := map[string]string{}
+		for _, attribute := range resourceSpans.Resource.Attributes {
+			attributes[attribute.Key] = attribute.Value.GetStringValue()
+		}
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				spans[span.Name] = attributes
+			}
+		}
+	}
+	return spans
+}
+
+func newTestConfig(protocol, endpoint string) *config.Config {
+	return &config.Config{
+		TracesExporter:    ExporterOTLP,
+		TracesSampleRatio: 1,
+		OTLPEndpoint:      endpoint,
+		OTLPProtocol:      protocol,
+		ServiceVersion:    "1.2.3",
+		ServiceInstanceID: "instance-1",
+		Environment:       "test",
+	}
+}
+
+// exportSpan records a span with a new trace provider and flushes it
+func exportSpan(t *testing.T, cfg *config.Config, name string) {
+	ctx := context.Background()
+	tp, err := NewTracerProvider(ctx, cfg, "orders-service")
+	require.NoError(t, err)
+
+	_, span := tp.Tracer("test").Start(ctx, name)
+	span.End()
+	require.NoError(t, tp.Shutdown(ctx))
+}
+
+func assertResource(t *testing.T, attributes map[string]string) {
+	assert.Equal(t, "orders-service", attributes["service.name"])
+	assert.Equal(t, "1.2.3", attributes["service.version"])
+	assert.Equal(t, "instance-1", attributes["service.instance.id"])
+	assert.Equal(t, "test", attributes["deployment.environment"])
+}
+
+func TestOTLPExporter_GRPC(t *testing.T) {
+	collector := &fakeCollector{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(server, collector)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	exportSpan(t, newTestConfig(ProtocolGRPC, "http://"+listener.Addr().String()), "grpc-span")
+
+	spans := collector.received()
+	require.Contains(t, spans, "grpc-span")
+	assertResource(t, spans["grpc-span"])
+}
+
+func TestOTLPExporter_HTTP(t *testing.T) {
+	collector := &fakeCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	exportSpan(t, newTestConfig(ProtocolHTTP, server.URL), "http-span")
+
+	spans := collector.received()
+	require.Contains(t, spans, "http-span")
+	assertResource(t, spans["http-span"])
+}
+
+func TestNewTracerProvider_RatioSampler(t *testing.T) {
+	cfg := newTestConfig(ProtocolGRPC, "http://localhost:4317")
+	cfg.TracesExporter = ExporterNone
+	cfg.TracesSampleRatio = 0
+	tp, err := NewTracerProvider(context.Background(), cfg, "orders-service")
+	require.NoError(t, err)
+	defer tp.Shutdown(context.Background())
+
+	// Root spans are dropped with ratio 0, but still carry a trace ID
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	assert.False(t, root.SpanContext().IsSampled())
+	assert.True(t, root.SpanContext().TraceID().IsValid())
+
+	// Children follow their parent's decision
+	_, child := tp.Tracer("test").Start(ctx, "child")
+	assert.False(t, child.SpanContext().IsSampled())
+}
+
+func TestNewTracerProvider_InvalidConfig(t *testing.T) {
+	cfg := newTestConfig(ProtocolGRPC, "http://localhost:4317")
+	cfg.TracesExporter = "jaeger"
+	_, err := NewTracerProvider(context.Background(), cfg, "orders-service")
+	assert.Error(t, err)
+
+	cfg = newTestConfig("thrift", "http://localhost:4317")
+	_, err = NewTracerProvider(context.Background(), cfg, "orders-service")
+	assert.Error(t, err)
+}
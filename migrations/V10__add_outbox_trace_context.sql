@@ -0,0 +1,3 @@
+-- Store the W3C trace context (traceparent, tracestate, baggage) of the request
+-- that wrote the event, so event delivery can be linked to it
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS trace_context JSONB;
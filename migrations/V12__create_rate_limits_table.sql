@@ -0,0 +1,10 @@
+-- Create rate_limits table holding the token buckets of the rate limiter as
+-- the theoretical arrival time (GCRA) in microseconds since the epoch. The
+-- state is short-lived and cheap to lose, so the table is not WAL-logged.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+    key VARCHAR(512) PRIMARY KEY,
+    tat BIGINT NOT NULL
+);
+
+-- Create index on tat for efficient purging of idle buckets
+CREATE INDEX IF NOT EXISTS idx_rate_limits_tat ON rate_limits(tat);
@@ -0,0 +1,41 @@
+-- Add the tenant to orders; existing orders belong to the default tenant
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE orders ALTER COLUMN tenant_id DROP DEFAULT;
+
+-- Replace the listing indexes by ones leading with the tenant
+DROP INDEX IF EXISTS idx_orders_created_at_id;
+CREATE INDEX IF NOT EXISTS idx_orders_tenant_created_at_id ON orders(tenant_id, created_at DESC, id DESC);
+DROP INDEX IF EXISTS idx_orders_customer_id;
+CREATE INDEX IF NOT EXISTS idx_orders_tenant_customer_id ON orders(tenant_id, customer_id);
+
+-- Scope idempotency keys by tenant, so tenants cannot see each other's responses
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE idempotency_keys ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (tenant_id, endpoint_name, endpoint_scheme, key);
+
+-- Bind API keys to a tenant; keys without tenant select it per request
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64);
+
+-- Enforce the tenant scope in the database: the service sets app.tenant_id
+-- for every transaction and only rows of that tenant are visible. Items and
+-- status history are visible if their order is. FORCE applies the policies
+-- to the table owner too; superusers and roles with BYPASSRLS (e.g. for
+-- maintenance) are not restricted.
+ALTER TABLE orders ENABLE ROW LEVEL SECURITY;
+ALTER TABLE orders FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON orders;
+CREATE POLICY tenant_isolation ON orders
+    USING (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE order_items ENABLE ROW LEVEL SECURITY;
+ALTER TABLE order_items FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON order_items;
+CREATE POLICY tenant_isolation ON order_items
+    USING (EXISTS (SELECT 1 FROM orders WHERE orders.id = order_items.order_id));
+
+ALTER TABLE order_status_history ENABLE ROW LEVEL SECURITY;
+ALTER TABLE order_status_history FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON order_status_history;
+CREATE POLICY tenant_isolation ON order_status_history
+    USING (EXISTS (SELECT 1 FROM orders WHERE orders.id = order_status_history.order_id));
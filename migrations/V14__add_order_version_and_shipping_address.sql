@@ -0,0 +1,6 @@
+-- Version of an order, incremented by every change and returned as its ETag,
+-- so concurrent updates can be detected (optimistic concurrency)
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+-- Address the order is shipped to, editable until the order is shipped
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_address JSONB;
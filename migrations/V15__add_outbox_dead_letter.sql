@@ -0,0 +1,11 @@
+-- Events that could not be delivered within the maximum number of attempts are
+-- dead-lettered: they are no longer claimed by the relay and are kept until
+-- they are redriven or deleted by hand
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS dead_lettered_at TIMESTAMP;
+
+-- Pending events are neither processed nor dead-lettered
+DROP INDEX IF EXISTS idx_outbox_pending;
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE processed_at IS NULL AND dead_lettered_at IS NULL;
+
+-- Processed events are purged once they are older than the retention period
+CREATE INDEX IF NOT EXISTS idx_outbox_processed_at ON outbox(processed_at) WHERE processed_at IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Identify the request holding an idempotency key: a request that outlived its
+-- reservation must not complete or release the key once another request took
+-- it over
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS reservation_token VARCHAR(36);
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_at TIMESTAMP;
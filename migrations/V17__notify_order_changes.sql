@@ -0,0 +1,23 @@
+-- Notify every replica of the committed changes of orders on the order_changes
+-- channel, so order watchers see the changes made through any replica. The
+-- payload identifies the order version; listeners read the order themselves.
+CREATE OR REPLACE FUNCTION notify_order_change() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('order_changes', json_build_object(
+        'tenant_id', NEW.tenant_id,
+        'order_id', NEW.id,
+        'version', NEW.version,
+        'kind', CASE
+            WHEN TG_OP = 'INSERT' THEN 'created'
+            WHEN OLD.status IS DISTINCT FROM NEW.status THEN 'status_changed'
+            ELSE 'updated'
+        END
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS order_changes ON orders;
+CREATE TRIGGER order_changes
+    AFTER INSERT OR UPDATE ON orders
+    FOR EACH ROW EXECUTE FUNCTION notify_order_change();
@@ -0,0 +1,4 @@
+-- The product filter of order listing matches the order lines, which
+-- idx_order_items_product_id covers; the index on the first product of an
+-- order is never used but slows down every write
+DROP INDEX IF EXISTS idx_orders_product_id;
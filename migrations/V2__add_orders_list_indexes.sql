@@ -0,0 +1,5 @@
+-- Create index on product_id for order listing filters
+CREATE INDEX IF NOT EXISTS idx_orders_product_id ON orders(product_id);
+
+-- Create composite index matching the keyset pagination order of GET /orders
+CREATE INDEX IF NOT EXISTS idx_orders_created_at_id ON orders(created_at DESC, id DESC);
@@ -0,0 +1,19 @@
+-- Create order_items table holding the lines of an order
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id VARCHAR(36) NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    line_no INTEGER NOT NULL,
+    product_id VARCHAR(255) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(10, 2) NOT NULL,
+    line_total DECIMAL(12, 2) NOT NULL,
+    PRIMARY KEY (order_id, line_no)
+);
+
+-- Create index on product_id for filtering orders by product
+CREATE INDEX IF NOT EXISTS idx_order_items_product_id ON order_items(product_id);
+
+-- Backfill a single line for orders created before multi-line orders
+INSERT INTO order_items (order_id, line_no, product_id, quantity, unit_price, line_total)
+SELECT id, 1, product_id, quantity, ROUND(total_price / quantity, 2), total_price
+FROM orders
+WHERE NOT EXISTS (SELECT 1 FROM order_items WHERE order_items.order_id = orders.id);
@@ -0,0 +1,7 @@
+-- Widen money columns so large amounts and currencies with up to four decimal places fit
+ALTER TABLE orders ALTER COLUMN total_price TYPE NUMERIC(19, 4);
+ALTER TABLE order_items ALTER COLUMN unit_price TYPE NUMERIC(19, 4);
+ALTER TABLE order_items ALTER COLUMN line_total TYPE NUMERIC(19, 4);
+
+-- Add ISO 4217 currency code of the order amounts; existing orders were in USD
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
@@ -0,0 +1,2 @@
+-- Add fingerprint of the canonicalized request that produced the stored response
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS request_hash VARCHAR(64);
@@ -0,0 +1,4 @@
+-- Track in-flight requests: keys are reserved as 'processing' before the request
+-- runs and become 'completed' with the response once it finished
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'completed';
+ALTER TABLE idempotency_keys ALTER COLUMN response DROP NOT NULL;
@@ -0,0 +1,10 @@
+-- Store complete HTTP responses (status code, headers and body) so the
+-- idempotency middleware can replay any endpoint
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS response_status INTEGER;
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS response_headers JSONB;
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS response_body BYTEA;
+
+-- Responses stored as order JSON cannot be replayed as HTTP responses; they
+-- expire within minutes anyway
+DELETE FROM idempotency_keys WHERE response_status IS NULL;
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS response;
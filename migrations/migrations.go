@@ -0,0 +1,9 @@
+// Package migrations embeds the Flyway SQL migrations into the binary
+package migrations
+
+import "embed"
+
+// FS holds the versioned migration scripts (V<version>__<description>.sql)
+//
+//go:embed *.sql
+var FS embed.FS